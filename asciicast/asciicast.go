@@ -0,0 +1,148 @@
+// Package asciicast writes terminal sessions as asciicast v2 recordings, playable with asciinema play. See
+// https://docs.asciinema.org/manual/asciicast/v2/.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header describes the recorded terminal.
+type Header struct {
+	Width  int
+	Height int
+	Title  string
+	Term   string
+}
+
+// Recorder writes the events of one session to a cast file. Its methods are safe for concurrent use, so output
+// and input can be recorded from different goroutines.
+type Recorder struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	w     *bufio.Writer
+	start time.Time
+	// output and input hold the start of a UTF-8 sequence split across writes, as events must be whole strings.
+	output []byte
+	input  []byte
+	err    error
+}
+
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Create creates a recording at path, which must not already exist, and writes its header.
+func Create(path string, h Header) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	r := &Recorder{path: path, file: file, w: bufio.NewWriter(file), start: start}
+	hdr := header{Version: 2, Width: h.Width, Height: h.Height, Timestamp: start.Unix(), Title: h.Title}
+	if h.Term != "" {
+		hdr.Env = map[string]string{"TERM": h.Term}
+	}
+	if err := json.NewEncoder(r.w).Encode(hdr); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path returns the path of the recording.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Write records p as terminal output. It never fails, so that a recording problem can't end the session it's
+// recording; the first error is kept and returned by Close instead.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("o", &r.output, p)
+	return len(p), nil
+}
+
+// Input returns a writer that records what is written to it as terminal input. Like Write, it never fails.
+func (r *Recorder) Input() *InputWriter {
+	return &InputWriter{r}
+}
+
+// InputWriter records terminal input, see Recorder.Input.
+type InputWriter struct {
+	r *Recorder
+}
+
+func (w *InputWriter) Write(p []byte) (int, error) {
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+	w.r.record("i", &w.r.input, p)
+	return len(p), nil
+}
+
+// Resize records the terminal changing size.
+func (r *Recorder) Resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// record writes p as an event of kind, holding back a trailing incomplete rune in partial until the rest of it
+// arrives.
+func (r *Recorder) record(kind string, partial *[]byte, p []byte) {
+	data := append(*partial, p...)
+	*partial = nil
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				*partial = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if len(data) > 0 {
+		r.event(kind, string(data))
+	}
+}
+
+func (r *Recorder) event(kind, data string) {
+	if r.err != nil {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	r.err = json.NewEncoder(r.w).Encode([]any{elapsed, kind, data})
+}
+
+// Close flushes the recording and closes its file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.output) > 0 {
+		r.event("o", string(r.output))
+	}
+	if len(r.input) > 0 {
+		r.event("i", string(r.input))
+	}
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
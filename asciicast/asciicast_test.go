@@ -0,0 +1,103 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readCast returns the header and events of the recording at path.
+func readCast(t *testing.T, path string) (header, [][]any) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	if !lines.Scan() {
+		t.Fatalf("recording is empty: %v", lines.Err())
+	}
+	var h header
+	if err := json.Unmarshal(lines.Bytes(), &h); err != nil {
+		t.Fatalf("header %s: %v", lines.Bytes(), err)
+	}
+	var events [][]any
+	for lines.Scan() {
+		var event []any
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("event %s: %v", lines.Bytes(), err)
+		}
+		if len(event) != 3 {
+			t.Fatalf("event %s, want [time, kind, data]", lines.Bytes())
+		}
+		events = append(events, event)
+	}
+	return h, events
+}
+
+func TestRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-1.cast")
+	r, err := Create(path, Header{Width: 80, Height: 40, Title: "web-1", Term: "xterm-256color"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("$ "))
+	r.Input().Write([]byte("ls\r"))
+	// é split across two writes is recorded whole.
+	r.Write([]byte("caf\xc3"))
+	r.Write([]byte("\xa9 <tmp>\r\n"))
+	r.Resize(120, 50)
+	// a trailing incomplete rune is flushed on close, each of its bytes encoded as a replacement character.
+	r.Write([]byte("\xe2\x82"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, events := readCast(t, path)
+	if h.Version != 2 || h.Width != 80 || h.Height != 40 || h.Title != "web-1" || h.Env["TERM"] != "xterm-256color" {
+		t.Errorf("header = %+v, want a v2 header for the 80x40 terminal", h)
+	}
+	want := [][2]string{{"o", "$ "}, {"i", "ls\r"}, {"o", "caf"}, {"o", "é <tmp>\r\n"}, {"r", "120x50"}, {"o", "\ufffd\ufffd"}}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	last := 0.0
+	for i, event := range events {
+		elapsed, _ := event[0].(float64)
+		if elapsed < last {
+			t.Errorf("event %d at %v, before the one preceding it at %v", i, elapsed, last)
+		}
+		last = elapsed
+		if event[1] != want[i][0] || event[2] != want[i][1] {
+			t.Errorf("event %d = %q %q, want %q %q", i, event[1], event[2], want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-1.cast")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, Header{Width: 80, Height: 40}); !os.IsExist(err) {
+		t.Errorf("Create over an existing recording = %v, want it refused", err)
+	}
+}
+
+// BenchmarkWrite measures what recording adds to each write of session output.
+func BenchmarkWrite(b *testing.B) {
+	r, err := Create(filepath.Join(b.TempDir(), "bench.cast"), Header{Width: 80, Height: 40})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	p := bytes.Repeat([]byte("drwxr-xr-x  2 ubuntu ubuntu 4096 Mar  1 12:00 logs\r\n"), 64)
+	b.SetBytes(int64(len(p)))
+	for i := 0; i < b.N; i++ {
+		r.Write(p)
+	}
+}
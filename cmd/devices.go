@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	"github.com/acmacalister/tssh/tailscale"
+	ts "github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// deviceJSON is what tssh devices -json prints of each device.
+type deviceJSON struct {
+	ID        string     `json:"id"`
+	Hostname  string     `json:"hostname"`
+	Name      string     `json:"name"`
+	Addresses []string   `json:"addresses"`
+	User      string     `json:"user"`
+	Tags      []string   `json:"tags"`
+	OS        string     `json:"os"`
+	LastSeen  *time.Time `json:"lastSeen"`
+	Online    bool       `json:"online"`
+}
+
+// runDevices prints the tailnet's devices as a table, or as JSON, and exits, for scripts. Like the proxy it owns no terminal, but its
+// stdout is the listing and its stderr only reports failure, so it logs to the log file as the UI does.
+func runDevices(args []string) error {
+	defaultPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	configPath := fs.String("config", defaultPath, "path to the config file")
+	apiKey := fs.String("api-key", "", "Tailscale API key (overrides TAILSCALE_API_KEY)")
+	tailnet := fs.String("tailnet", "", "Tailscale tailnet (overrides TAILSCALE_TAILNET)")
+	tagFilter := fs.String("tag", "", "only list devices with this tag (overrides TSSH_TAG_FILTER)")
+	asJSON := fs.Bool("json", false, "print the devices as a JSON array")
+	noHeader := fs.Bool("no-header", false, "leave the header line out of the table")
+	sortBy := fs.String("sort", "hostname", "sort devices by hostname, user, os or lastseen, most recent first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	less, ok := deviceOrders[*sortBy]
+	if !ok {
+		return fmt.Errorf("unknown sort order %q, want hostname, user, os or lastseen", *sortBy)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "api-key":
+			cfg.APIKey = *apiKey
+		case "tailnet":
+			cfg.Tailnet = *tailnet
+		case "tag":
+			cfg.TagFilter = *tagFilter
+		}
+	})
+
+	filter, err := tssh.ParseTagFilter(cfg.TagFilter)
+	if err != nil {
+		return err
+	}
+
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	profile := config.Profile{APIKey: cfg.APIKey, Tailnet: cfg.Tailnet}
+	if profile.APIKey == "" && profile.Tailnet == "" {
+		profile = activeProfile(cfg)
+	}
+	if err := checkCredentials(profile); err != nil {
+		return err
+	}
+	service, err := tailscale.New(profile.APIKey, profile.Tailnet, tailscale.WithTimeout(cfg.APITimeout), tailscale.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	all, err := service.Devices()
+	if err != nil {
+		return fmt.Errorf("%v failed to list devices", err)
+	}
+
+	var devices []ts.Device
+	for _, device := range all {
+		if filter.Matches(device) {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool { return less(devices[i], devices[j]) })
+
+	if *asJSON {
+		return printDevicesJSON(os.Stdout, devices, time.Now())
+	}
+	return printDevicesTable(os.Stdout, devices, !*noHeader, time.Now())
+}
+
+// deviceOrders are the orders tssh devices -sort can list devices in, each ending on the hostname for devices that
+// are otherwise equal.
+var deviceOrders = map[string]func(a, b ts.Device) bool{
+	"hostname": func(a, b ts.Device) bool { return a.Hostname < b.Hostname },
+	"user": func(a, b ts.Device) bool {
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		return a.Hostname < b.Hostname
+	},
+	"os": func(a, b ts.Device) bool {
+		if a.OS != b.OS {
+			return a.OS < b.OS
+		}
+		return a.Hostname < b.Hostname
+	},
+	"lastseen": func(a, b ts.Device) bool {
+		if !a.LastSeen.Equal(b.LastSeen.Time) {
+			return a.LastSeen.After(b.LastSeen.Time)
+		}
+		return a.Hostname < b.Hostname
+	},
+}
+
+// printDevicesTable writes devices to w as a table aligned with spaces, one device per line, with a header line
+// first if header is set. Empty fields are written as -, so that every line has the same number of fields for awk.
+func printDevicesTable(w io.Writer, devices []ts.Device, header bool, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if header {
+		fmt.Fprintln(tw, "HOSTNAME\tADDRESS\tUSER\tOS\tONLINE\tLAST SEEN\tTAGS")
+	}
+	for _, device := range devices {
+		address, lastSeen := "", ""
+		if len(device.Addresses) > 0 {
+			address = device.Addresses[0]
+		}
+		if !device.LastSeen.IsZero() {
+			lastSeen = device.LastSeen.UTC().Format(time.RFC3339)
+		}
+		online := "no"
+		if tssh.IsOnline(device, now) {
+			online = "yes"
+		}
+		fields := []string{device.Hostname, address, device.User, device.OS, online, lastSeen, strings.Join(device.Tags, ",")}
+		for i, field := range fields {
+			if field == "" {
+				fields[i] = "-"
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printDevicesJSON writes devices to w as an indented JSON array, which is empty rather than null when there are
+// no devices.
+func printDevicesJSON(w io.Writer, devices []ts.Device, now time.Time) error {
+	out := make([]deviceJSON, 0, len(devices))
+	for _, device := range devices {
+		d := deviceJSON{
+			ID:        device.ID,
+			Hostname:  device.Hostname,
+			Name:      device.Name,
+			Addresses: device.Addresses,
+			User:      device.User,
+			Tags:      device.Tags,
+			OS:        device.OS,
+			Online:    tssh.IsOnline(device, now),
+		}
+		// empty lists are printed as [] rather than null, which is easier to handle with jq.
+		if d.Addresses == nil {
+			d.Addresses = []string{}
+		}
+		if d.Tags == nil {
+			d.Tags = []string{}
+		}
+		if !device.LastSeen.IsZero() {
+			lastSeen := device.LastSeen.Time
+			d.LastSeen = &lastSeen
+		}
+		out = append(out, d)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
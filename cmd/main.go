@@ -1,23 +1,210 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	"github.com/acmacalister/tssh/localapi"
 	"github.com/acmacalister/tssh/tailscale"
 	"github.com/acmacalister/tssh/ui"
 )
 
+const (
+	pingTimeout = 10 * time.Second
+
+	// exitMissingCredentials is the exit status when no API key or tailnet is configured, distinct from the 1 of
+	// other failures and the 2 of bad flags so that scripts can tell a misconfiguration apart.
+	exitMissingCredentials = 3
+)
+
+// errMissingCredentials is returned when no API key or tailnet is configured.
+var errMissingCredentials = errors.New("set TAILSCALE_API_KEY and TAILSCALE_TAILNET, pass -api-key and -tailnet, or add a profile to the config file")
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
-	apiKey := os.Getenv("TAILSCALE_API_KEY")
-	tailnet := os.Getenv("TAILSCALE_TAILNET")
+	if len(os.Args) > 1 && os.Args[1] == "proxy" {
+		if err := runProxy(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "devices" {
+		if err := runDevices(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if errors.Is(err, errMissingCredentials) {
+				os.Exit(exitMissingCredentials)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	defaultPath, err := config.Path()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	configPath := flag.String("config", defaultPath, "path to the config file")
+	validate := flag.Bool("validate", true, "check the API key and tailnet before starting the UI")
+	apiKey := flag.String("api-key", "", "Tailscale API key (overrides TAILSCALE_API_KEY)")
+	tailnet := flag.String("tailnet", "", "Tailscale tailnet (overrides TAILSCALE_TAILNET)")
+	user := flag.String("user", "", "default SSH user (overrides TSSH_USER)")
+	tagFilter := flag.String("tag", "", "only list devices with this tag (overrides TSSH_TAG_FILTER)")
+	deviceID := flag.String("device-id", "", "open a shell on the device with this ID straight away")
+	host := flag.String("host", "", "open a shell on this host straight away, through a subnet router if it is outside the tailnet")
+	theme := flag.String("theme", "", "UI theme: adaptive, dark, light or high-contrast (overrides TSSH_THEME)")
+	noColor := flag.Bool("no-color", false, "render the UI without color (overrides NO_COLOR)")
+	flag.Parse()
+
+	// precedence is flags > env > config file > defaults.
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		log.Fatalln(err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "api-key":
+			cfg.APIKey = *apiKey
+		case "tailnet":
+			cfg.Tailnet = *tailnet
+		case "user":
+			cfg.User = *user
+		case "tag":
+			cfg.TagFilter = *tagFilter
+		case "theme":
+			cfg.Theme = *theme
+		case "no-color":
+			cfg.NoColor = *noColor
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalln(err)
+	}
 
-	tailscaleService, err := tailscale.New(apiKey, tailnet)
+	logger, closeLog, err := newLogger(cfg)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	defer closeLog()
+	slog.SetDefault(logger)
+
+	// explicit credentials take precedence over profiles.
+	profile := config.Profile{Name: cfg.Tailnet, APIKey: cfg.APIKey, Tailnet: cfg.Tailnet}
+	if profile.APIKey == "" && profile.Tailnet == "" {
+		profile = activeProfile(cfg)
+	}
+	if err := checkCredentials(profile); err != nil {
+		logger.Error("missing credentials", "error", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitMissingCredentials)
+	}
+
+	tailscaleService, err := tailscale.New(profile.APIKey, profile.Tailnet, tailscale.WithTimeout(cfg.APITimeout), tailscale.WithLogger(logger))
+	if err != nil {
+		fatal(logger, "creating tailscale client", err)
+	}
 
-	if err := ui.New(tailscaleService); err != nil {
-		log.Fatal(err)
+	if *validate {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := tailscaleService.Ping(ctx)
+		cancel()
+		switch {
+		case errors.Is(err, tailscale.ErrUnauthorized):
+			fatal(logger, "invalid API key", err)
+		case errors.Is(err, tailscale.ErrTailnetNotFound):
+			fatal(logger, "unknown tailnet", err)
+		case errors.Is(err, tailscale.ErrNetwork):
+			// the UI falls back to the last fetched devices when the API can't be reached.
+			logger.Warn("tailscale API unreachable", "error", err)
+		case err != nil:
+			fatal(logger, "validating credentials", err)
+		}
+	}
+
+	newService := func(p config.Profile) (tssh.TailscaleService, error) {
+		return tailscale.New(p.APIKey, p.Tailnet, tailscale.WithTimeout(cfg.APITimeout), tailscale.WithLogger(logger))
+	}
+
+	opts := []ui.Option{ui.WithProfiles(cfg.Profiles, profile.Name, newService), ui.WithLogger(logger)}
+	if *deviceID != "" {
+		opts = append(opts, ui.WithDeviceID(*deviceID))
+	}
+	if *host != "" {
+		opts = append(opts, ui.WithHost(*host))
+	}
+	if cfg.LocalAPI {
+		opts = append(opts, ui.WithLocalAPI(localapi.New(localapi.WithSocket(cfg.TailscaledSocket), localapi.WithLogger(logger))))
+	}
+	if err := ui.New(tailscaleService, cfg, opts...); err != nil {
+		fatal(logger, "running UI", err)
+	}
+}
+
+// newLogger opens the log file and returns a logger writing to it at the configured level. Logs go to a file
+// because anything written to the terminal while the UI is running corrupts it.
+func newLogger(cfg *config.Config) (*slog.Logger, func() error, error) {
+	level, err := cfg.Level()
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := cfg.LogPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level})), f.Close, nil
+}
+
+// fatal logs err and reports it on stderr before exiting. It must only be used while the UI isn't running.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+	os.Exit(1)
+}
+
+// checkCredentials reports which of the API key and tailnet profile is missing, before the Tailscale client fails
+// on it with a less helpful error.
+func checkCredentials(profile config.Profile) error {
+	switch {
+	case profile.APIKey == "" && profile.Tailnet == "":
+		return fmt.Errorf("no Tailscale API key or tailnet: %w", errMissingCredentials)
+	case profile.APIKey == "":
+		return fmt.Errorf("no Tailscale API key for tailnet %q: %w", profile.Tailnet, errMissingCredentials)
+	case profile.Tailnet == "":
+		return fmt.Errorf("no Tailscale tailnet for the API key: %w", errMissingCredentials)
+	}
+	return nil
+}
+
+// activeProfile returns the profile used last time, falling back to the first configured profile.
+func activeProfile(cfg *config.Config) config.Profile {
+	if last, err := config.LastProfile(); err == nil {
+		if p, ok := cfg.Profile(last); ok {
+			return p
+		}
+	}
+	if len(cfg.Profiles) > 0 {
+		return cfg.Profiles[0]
 	}
+	return config.Profile{}
 }
@@ -0,0 +1,169 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/acmacalister/tssh/config"
+	"github.com/acmacalister/tssh/sshproxy"
+	"github.com/acmacalister/tssh/tailscale"
+	"github.com/gliderlabs/ssh"
+)
+
+// runProxy runs the SSH proxy until it is interrupted. Unlike the UI it logs to stderr, as it owns no terminal.
+func runProxy(args []string) error {
+	defaultPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	configPath := fs.String("config", defaultPath, "path to the config file")
+	listen := fs.String("listen", ":2222", "address to accept SSH connections on")
+	hostKeys := fs.String("hostkeys", filepath.Join(dir, "hostkeys"), "directory holding the proxy's host keys, created with a new key if empty")
+	idleTimeout := fs.Duration("idle-timeout", 0, "close connections idle for this long, 0 for never")
+	maxTimeout := fs.Duration("max-timeout", 0, "close connections open for this long, 0 for never")
+	recordDir := fs.String("record-dir", "", "record every session to an asciicast file in this directory")
+	healthListen := fs.String("health-listen", "", "serve /healthz and /readyz over HTTP on this address, off if empty")
+	routesPath := fs.String("routes", "", "run as a bastion, sending each user to the device this file of routes maps them to")
+	passwordFile := fs.String("password-file", "", "also accept password and keyboard-interactive logins checked against this file of user:bcrypt-hash lines")
+	authorizedKeys := fs.String("authorized-keys", "", "accept public keys in this authorized_keys file from clients logging in as any user")
+	var forwardRules sshproxy.ForwardRules
+	fs.Func("forward-allow", "allow port forwards to `network[:ports]`, such as 100.64.0.0/10:22; may be repeated, and forwards are refused without it", func(s string) error {
+		rule, err := sshproxy.ParseForwardRule(s)
+		forwardRules.Allow = append(forwardRules.Allow, rule)
+		return err
+	})
+	fs.Func("forward-deny", "refuse port forwards to `network[:ports]` even if -forward-allow allows them; may be repeated", func(s string) error {
+		rule, err := sshproxy.ParseForwardRule(s)
+		forwardRules.Deny = append(forwardRules.Deny, rule)
+		return err
+	})
+	var destinationRules sshproxy.ForwardRules
+	fs.Func("destination-allow", "only proxy connections to destinations in `network[:ports]`; may be repeated, and is required without a tailnet or -routes", func(s string) error {
+		rule, err := sshproxy.ParseForwardRule(s)
+		destinationRules.Allow = append(destinationRules.Allow, rule)
+		return err
+	})
+	maxSessions := fs.Int("max-sessions", 0, "refuse connections beyond this many at once, 0 for no limit")
+	rateLimit := fs.Float64("rate-limit", 0, "connections per second each client IP may open on average, 0 for no limit")
+	rateBurst := fs.Int("rate-burst", 5, "connections each client IP may open at once before -rate-limit applies")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return err
+	}
+	level, err := cfg.Level()
+	if err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	// destinations such as Tailscale SSH let in whoever the proxy connects as, so the proxy has to check clients itself.
+	if *routesPath == "" && *passwordFile == "" && *authorizedKeys == "" {
+		return errors.New("refusing to accept any client: configure -routes, -authorized-keys or -password-file")
+	}
+
+	opts := []sshproxy.Option{
+		sshproxy.WithLogger(logger),
+		sshproxy.WithRecordDir(*recordDir),
+		sshproxy.WithHealthCheck(*healthListen),
+		sshproxy.WithMaxSessions(*maxSessions),
+		sshproxy.WithConnectionRateLimit(*rateLimit, *rateBurst),
+	}
+	if *passwordFile != "" {
+		auth, err := sshproxy.PasswordFile(*passwordFile)
+		if err != nil {
+			return fmt.Errorf("%v failed to read password file", err)
+		}
+		opts = append(opts, sshproxy.WithPasswordAuth(auth), sshproxy.WithKeyboardInteractiveAuth(auth))
+	}
+	if *authorizedKeys != "" {
+		auth, err := sshproxy.AuthorizedKeysFile(*authorizedKeys)
+		if err != nil {
+			return fmt.Errorf("%v failed to read authorized keys", err)
+		}
+		opts = append(opts, sshproxy.WithPublicKeyAuth(auth))
+	}
+	if len(forwardRules.Allow) > 0 {
+		opts = append(opts, sshproxy.WithForwardRules(forwardRules))
+	}
+	if len(destinationRules.Allow) > 0 {
+		opts = append(opts, sshproxy.WithDestinationRules(destinationRules))
+	}
+	if *routesPath != "" {
+		routes, err := sshproxy.LoadRoutes(*routesPath)
+		if err != nil {
+			return fmt.Errorf("%v failed to read routes", err)
+		}
+		opts = append(opts, sshproxy.WithRoutes(routes))
+		logger.Info("routing users to devices", "routes", *routesPath, "count", len(routes))
+	}
+	// with credentials, destinations are looked up in the tailnet; otherwise they are dialled as given.
+	profile := config.Profile{APIKey: cfg.APIKey, Tailnet: cfg.Tailnet}
+	if profile.APIKey == "" && profile.Tailnet == "" {
+		profile = activeProfile(cfg)
+	}
+	if profile.APIKey != "" && profile.Tailnet != "" {
+		ts, err := tailscale.New(profile.APIKey, profile.Tailnet, tailscale.WithTimeout(cfg.APITimeout), tailscale.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, sshproxy.WithTailscaleService(ts))
+	} else if *routesPath == "" && len(destinationRules.Allow) == 0 {
+		// without a tailnet, routes or rules, clients could have the proxy connect them to any host it can reach.
+		return errors.New("refusing to proxy to any host: configure an API key and tailnet, -routes or -destination-allow")
+	}
+
+	hostname, _ := os.Hostname()
+	shutdownC := make(chan struct{})
+	proxy, err := sshproxy.New(version, *listen, hostname, *hostKeys, shutdownC, *idleTimeout, *maxTimeout, opts...)
+	if err != nil {
+		return err
+	}
+
+	// errors are logged as they are reported, so they only need draining here.
+	go func() {
+		for range proxy.Errors() {
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Info("shutting down", "signal", sig.String())
+		close(shutdownC)
+	}()
+
+	go func() {
+		<-proxy.Ready()
+		logger.Info("proxy listening", "addr", proxy.ListenAddr().String(), "hostkeys", *hostKeys)
+		if addr := proxy.HealthAddr(); addr != nil {
+			logger.Info("serving health checks", "addr", addr.String())
+		}
+	}()
+	if err := proxy.Start(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+		return fmt.Errorf("%v failed to run proxy", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "errors"
+
+// runProxy reports that the SSH proxy can't run on windows.
+func runProxy([]string) error {
+	return errors.New("the ssh proxy is not supported on windows")
+}
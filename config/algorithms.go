@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The algorithms golang.org/x/crypto/ssh implements. Its defaults leave out the weak ones, such as the CBC
+// ciphers, arcfour and diffie-hellman-group1-sha1, which have to be listed explicitly to be used.
+var (
+	supportedCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+	}
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+)
+
+// validateAlgorithms reports the first of names that isn't in supported.
+func validateAlgorithms(key string, names, supported []string) error {
+	for _, name := range names {
+		if !slices.Contains(supported, name) {
+			return fmt.Errorf("%s: unknown algorithm %q, supported algorithms are %s", key, name, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, as the algorithm environment variables take.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,678 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	appName         = "tssh"
+	configFileName  = "config.yaml"
+	lastProfileFile = "last_profile"
+	logFileName     = "tssh.log"
+
+	// SSHClientEmbedded connects with tssh's built in SSH client.
+	SSHClientEmbedded = "embedded"
+	// SSHClientSystem runs the system ssh binary, so ~/.ssh/config and ssh's other features apply.
+	SSHClientSystem = "system"
+
+	// ColorProfileTrueColor, ColorProfileANSI256, ColorProfileANSI and ColorProfileASCII are the color profiles
+	// ColorProfile can force: 24-bit color, 256 colors, the 16 ANSI colors, or none.
+	ColorProfileTrueColor = "truecolor"
+	ColorProfileANSI256   = "ansi256"
+	ColorProfileANSI      = "ansi"
+	ColorProfileASCII     = "ascii"
+
+	// DefaultUser is the user to log in as when neither tssh's config nor ~/.ssh/config sets one, and
+	// UserFromOwner doesn't work one out.
+	DefaultUser = "ubuntu"
+)
+
+type (
+	// Profile is a named set of Tailscale API credentials.
+	Profile struct {
+		Name    string `yaml:"name"`
+		APIKey  string `yaml:"api_key"`
+		Tailnet string `yaml:"tailnet"`
+	}
+
+	// Config holds every tssh setting. It is built from Default, then overlaid with the config file, the
+	// environment, and finally command line flags, so that flags > env > config file > defaults.
+	Config struct {
+		APIKey               string        `yaml:"api_key"`
+		Tailnet              string        `yaml:"tailnet"`
+		User                 string        `yaml:"user"`
+		TagFilter            string        `yaml:"tag_filter"`
+		KeyExpiryWarningDays int           `yaml:"key_expiry_warning_days"`
+		ConnectTimeout       time.Duration `yaml:"connect_timeout"`
+		APITimeout           time.Duration `yaml:"api_timeout"`
+		FetchTimeout         time.Duration `yaml:"fetch_timeout"`
+		PoolIdleTimeout      time.Duration `yaml:"pool_idle_timeout"`
+		ReconnectAttempts    int           `yaml:"reconnect_attempts"`
+		CommandConcurrency   int           `yaml:"command_concurrency"`
+		TestAuth             bool          `yaml:"test_auth"`
+		LogLevel             string        `yaml:"log_level"`
+		LogFile              string        `yaml:"log_file"`
+		SSHClient            string        `yaml:"ssh_client"`
+		SSHBinary            string        `yaml:"ssh_binary"`
+		SFTPBinary           string        `yaml:"sftp_binary"`
+		RecordDir            string        `yaml:"record_dir"`
+		Profiles             []Profile     `yaml:"profiles"`
+		Theme                string        `yaml:"theme"`
+		SpinnerStyle         string        `yaml:"spinner_style"`
+		DisableFilter        bool          `yaml:"disable_filter"`
+		DeviceColumns        bool          `yaml:"device_columns"`
+		Colors               Colors        `yaml:"colors"`
+		Keys                 Keys          `yaml:"keys"`
+		// Jump is a ProxyJump-style chain of comma separated [user@]host[:port] hops used to reach every device.
+		Jump string `yaml:"jump"`
+		// JumpHosts sets the jump chain per device hostname, overriding Jump. An empty chain connects directly.
+		JumpHosts map[string]string `yaml:"jump_hosts"`
+		// ProxyCommand is run to reach every device, or its first jump host, with its stdin and stdout used as the
+		// connection, like ssh_config's ProxyCommand. %h, %p and %r expand to the host, port and user.
+		ProxyCommand string `yaml:"proxy_command"`
+		// ProxyCommandHosts sets the proxy command per device hostname, overriding ProxyCommand. An empty command
+		// dials directly.
+		ProxyCommandHosts map[string]string `yaml:"proxy_command_hosts"`
+		// OnConnect is a command run in place of the login shell when a session opens, such as "tmux attach".
+		OnConnect string `yaml:"on_connect"`
+		// OnConnectHosts sets the on connect command per device hostname, overriding OnConnect. An empty command
+		// opens a shell.
+		OnConnectHosts map[string]string `yaml:"on_connect_hosts"`
+		// LoginShell starts sessions in a login shell, which reads the device's profile files, rather than a plain
+		// interactive shell, which doesn't.
+		LoginShell bool `yaml:"login_shell"`
+		// LoginShellHosts sets LoginShell per device hostname.
+		LoginShellHosts map[string]bool `yaml:"login_shell_hosts"`
+		// Ciphers, MACs and KeyExchanges restrict the built in client to the listed algorithms, in order of
+		// preference. Empty lists use golang.org/x/crypto/ssh's defaults.
+		Ciphers      []string `yaml:"ciphers"`
+		MACs         []string `yaml:"macs"`
+		KeyExchanges []string `yaml:"kex_algorithms"`
+		// UserFromOwner is a regular expression matched against a device's owner, such as alice@example.com, to
+		// work out the user to log in as when neither User nor ssh_config sets one. The user is its capture groups
+		// joined together, or the whole match if it has none. Owners it doesn't match use DefaultUser.
+		UserFromOwner string `yaml:"user_from_owner"`
+		// PreConnect and PostConnect are hook commands run locally, with sh, before a session to a device opens
+		// and after it ends. PreConnectHosts and PostConnectHosts set them per device hostname, where an empty
+		// command runs no hook.
+		PreConnect       string            `yaml:"pre_connect"`
+		PreConnectHosts  map[string]string `yaml:"pre_connect_hosts"`
+		PostConnect      string            `yaml:"post_connect"`
+		PostConnectHosts map[string]string `yaml:"post_connect_hosts"`
+		// PreConnectRequired stops the session from opening when the pre connect hook fails, rather than only
+		// logging the failure.
+		PreConnectRequired bool `yaml:"pre_connect_required"`
+		// RefreshInterval is how often the device list is fetched again in the background once it has loaded. Zero
+		// turns refreshing off.
+		RefreshInterval time.Duration `yaml:"refresh_interval"`
+		// IdleTimeout closes sessions in the built in client that have had no keypress for this long, such as to
+		// match the proxy's -idle-timeout. Zero never closes them. IdleWarning is how long before closing a session
+		// a countdown is shown in it; any keypress starts the wait over.
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		IdleWarning time.Duration `yaml:"idle_warning"`
+		// SessionStats shows how long a session in the built in client lasted, the bytes it sent and received and
+		// how the remote shell exited once it ends, before returning to the menu.
+		SessionStats bool `yaml:"session_stats"`
+		// LocalAPI adds what the machine's tailscaled knows of each device, such as whether the connection to it is
+		// direct or relayed, read from its LocalAPI on TailscaledSocket. Without tailscaled, devices are listed
+		// from the control API alone.
+		LocalAPI         bool   `yaml:"local_api"`
+		TailscaledSocket string `yaml:"tailscaled_socket"`
+		// Padding is the space left around lists and panes, in cells, given as for CSS: [all sides], [top and
+		// bottom, left and right], [top, left and right, bottom] or [top, right, bottom, left]. Empty leaves none.
+		Padding []int `yaml:"padding"`
+		// Certificate is the SSH certificate the built in client presents with the matching identity, like
+		// ssh_config's CertificateFile, and CertificateHosts sets it per device hostname, overriding Certificate.
+		// Identities with a certificate next to them, named like id_ed25519-cert.pub, present it without either.
+		Certificate      string            `yaml:"certificate"`
+		CertificateHosts map[string]string `yaml:"certificate_hosts"`
+		// NoColor renders the UI without color, for terminals and users that don't want it. Selections and
+		// statuses are still marked, as they never rely on color alone.
+		NoColor bool `yaml:"no_color"`
+		// ColorProfile forces the colors the UI is rendered with to one of the ColorProfile constants, for
+		// terminals that support more or fewer colors than they claim to. Empty detects them from the terminal.
+		ColorProfile string `yaml:"color_profile"`
+		// AdminCommands are the commands offered to run on a device from its admin menu, such as rebooting it or
+		// restarting a service, each after asking to confirm.
+		AdminCommands []AdminCommand `yaml:"admin_commands"`
+	}
+
+	// AdminCommand is a named command run on a device without a pty, like a one-shot command. The %h, %r and %%
+	// tokens in Command expand to the device's hostname, the user logged in as and a literal %.
+	AdminCommand struct {
+		Name    string `yaml:"name"`
+		Command string `yaml:"command"`
+	}
+
+	// Colors overrides individual colors of the selected theme. Colors are lipgloss colors, either an ANSI
+	// color number such as "69" or a hex color such as "#04B575". Empty colors keep the theme's color.
+	Colors struct {
+		Accent      string `yaml:"accent"`
+		Success     string `yaml:"success"`
+		Title       string `yaml:"title"`
+		Text        string `yaml:"text"`
+		Muted       string `yaml:"muted"`
+		Faint       string `yaml:"faint"`
+		Subdued     string `yaml:"subdued"`
+		VerySubdued string `yaml:"very_subdued"`
+	}
+
+	// Keys overrides the UI key bindings. Each action takes a list of keys in bubbletea's notation, such as
+	// "enter", "ctrl+c" or "r". Actions left empty keep their default keys.
+	Keys struct {
+		Choose     []string `yaml:"choose"`
+		Quit       []string `yaml:"quit"`
+		Refresh    []string `yaml:"refresh"`
+		Back       []string `yaml:"back"`
+		Detail     []string `yaml:"detail"`
+		Copy       []string `yaml:"copy"`
+		Test       []string `yaml:"test"`
+		Command    []string `yaml:"command"`
+		Group      []string `yaml:"group"`
+		GroupOwner []string `yaml:"group_owner"`
+		Select     []string `yaml:"select"`
+		SystemSSH  []string `yaml:"system_ssh"`
+		Compact    []string `yaml:"compact"`
+		Admin      []string `yaml:"admin"`
+		Help       []string `yaml:"help"`
+	}
+)
+
+// Default returns the settings used when nothing else is configured.
+func Default() *Config {
+	return &Config{
+		TagFilter:            "tag:e2e",
+		KeyExpiryWarningDays: 7,
+		ConnectTimeout:       10 * time.Second,
+		APITimeout:           30 * time.Second,
+		FetchTimeout:         15 * time.Second,
+		PoolIdleTimeout:      2 * time.Minute,
+		ReconnectAttempts:    3,
+		CommandConcurrency:   8,
+		TestAuth:             true,
+		LoginShell:           true,
+		PreConnectRequired:   true,
+		RefreshInterval:      30 * time.Second,
+		IdleWarning:          time.Minute,
+		LocalAPI:             true,
+		Padding:              []int{1, 2},
+		LogLevel:             "info",
+		SSHClient:            SSHClientEmbedded,
+		SSHBinary:            "ssh",
+		SFTPBinary:           "sftp",
+		Theme:                "adaptive",
+		SpinnerStyle:         "points",
+	}
+}
+
+// Dir returns the tssh config directory, $XDG_CONFIG_HOME/tssh or the platform equivalent.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// Path returns the path of the tssh config file.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFileName), nil
+}
+
+// Load reads the config file at path over the defaults. A missing file is not an error and yields Default.
+// Unknown keys are rejected so that typos don't silently fall back to defaults.
+func Load(path string) (*Config, error) {
+	c := Default()
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// ApplyEnv overlays settings from environment variables, looked up with lookup (usually os.LookupEnv).
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	if v, ok := lookup("TAILSCALE_API_KEY"); ok {
+		c.APIKey = v
+	}
+	if v, ok := lookup("TAILSCALE_TAILNET"); ok {
+		c.Tailnet = v
+	}
+	if v, ok := lookup("TSSH_USER"); ok {
+		c.User = v
+	}
+	if v, ok := lookup("TSSH_USER_FROM_OWNER"); ok {
+		c.UserFromOwner = v
+	}
+	if v, ok := lookup("TSSH_TAG_FILTER"); ok {
+		c.TagFilter = v
+	}
+	if v, ok := lookup("TSSH_KEY_EXPIRY_WARNING_DAYS"); ok {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_KEY_EXPIRY_WARNING_DAYS: %v", err)
+		}
+		c.KeyExpiryWarningDays = days
+	}
+	if v, ok := lookup("TSSH_CONNECT_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_CONNECT_TIMEOUT: %v", err)
+		}
+		c.ConnectTimeout = d
+	}
+	if v, ok := lookup("TSSH_API_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_API_TIMEOUT: %v", err)
+		}
+		c.APITimeout = d
+	}
+	if v, ok := lookup("TSSH_FETCH_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_FETCH_TIMEOUT: %v", err)
+		}
+		c.FetchTimeout = d
+	}
+	if v, ok := lookup("TSSH_REFRESH_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_REFRESH_INTERVAL: %v", err)
+		}
+		c.RefreshInterval = d
+	}
+	if v, ok := lookup("TSSH_IDLE_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_IDLE_TIMEOUT: %v", err)
+		}
+		c.IdleTimeout = d
+	}
+	if v, ok := lookup("TSSH_IDLE_WARNING"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_IDLE_WARNING: %v", err)
+		}
+		c.IdleWarning = d
+	}
+	if v, ok := lookup("TSSH_POOL_IDLE_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_POOL_IDLE_TIMEOUT: %v", err)
+		}
+		c.PoolIdleTimeout = d
+	}
+	if v, ok := lookup("TSSH_RECONNECT_ATTEMPTS"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_RECONNECT_ATTEMPTS: %v", err)
+		}
+		c.ReconnectAttempts = n
+	}
+	if v, ok := lookup("TSSH_COMMAND_CONCURRENCY"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_COMMAND_CONCURRENCY: %v", err)
+		}
+		c.CommandConcurrency = n
+	}
+	if v, ok := lookup("TSSH_TEST_AUTH"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_TEST_AUTH: %v", err)
+		}
+		c.TestAuth = b
+	}
+	if v, ok := lookup("TSSH_LOG_LEVEL"); ok {
+		c.LogLevel = v
+	}
+	if v, ok := lookup("TSSH_SSH_CLIENT"); ok {
+		c.SSHClient = v
+	}
+	if v, ok := lookup("TSSH_LOG_FILE"); ok {
+		c.LogFile = v
+	}
+	if v, ok := lookup("TSSH_THEME"); ok {
+		c.Theme = v
+	}
+	// NO_COLOR turns color off when set to anything but the empty string, as https://no-color.org asks.
+	if v, ok := lookup("NO_COLOR"); ok && v != "" {
+		c.NoColor = true
+	}
+	if v, ok := lookup("TSSH_COLOR_PROFILE"); ok {
+		c.ColorProfile = v
+	}
+	if v, ok := lookup("TSSH_PADDING"); ok {
+		var padding []int
+		for _, item := range splitList(v) {
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("TSSH_PADDING: %v", err)
+			}
+			padding = append(padding, n)
+		}
+		c.Padding = padding
+	}
+	if v, ok := lookup("TSSH_SPINNER_STYLE"); ok {
+		c.SpinnerStyle = v
+	}
+	if v, ok := lookup("TSSH_DISABLE_FILTER"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_DISABLE_FILTER: %v", err)
+		}
+		c.DisableFilter = b
+	}
+	if v, ok := lookup("TSSH_DEVICE_COLUMNS"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_DEVICE_COLUMNS: %v", err)
+		}
+		c.DeviceColumns = b
+	}
+	if v, ok := lookup("TSSH_JUMP"); ok {
+		c.Jump = v
+	}
+	if v, ok := lookup("TSSH_PROXY_COMMAND"); ok {
+		c.ProxyCommand = v
+	}
+	if v, ok := lookup("TSSH_CERTIFICATE"); ok {
+		c.Certificate = v
+	}
+	if v, ok := lookup("TSSH_LOCAL_API"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_LOCAL_API: %v", err)
+		}
+		c.LocalAPI = b
+	}
+	if v, ok := lookup("TSSH_TAILSCALED_SOCKET"); ok {
+		c.TailscaledSocket = v
+	}
+	if v, ok := lookup("TSSH_RECORD_DIR"); ok {
+		c.RecordDir = v
+	}
+	if v, ok := lookup("TSSH_ON_CONNECT"); ok {
+		c.OnConnect = v
+	}
+	if v, ok := lookup("TSSH_PRE_CONNECT"); ok {
+		c.PreConnect = v
+	}
+	if v, ok := lookup("TSSH_POST_CONNECT"); ok {
+		c.PostConnect = v
+	}
+	if v, ok := lookup("TSSH_PRE_CONNECT_REQUIRED"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_PRE_CONNECT_REQUIRED: %v", err)
+		}
+		c.PreConnectRequired = b
+	}
+	if v, ok := lookup("TSSH_LOGIN_SHELL"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_LOGIN_SHELL: %v", err)
+		}
+		c.LoginShell = b
+	}
+	if v, ok := lookup("TSSH_SESSION_STATS"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TSSH_SESSION_STATS: %v", err)
+		}
+		c.SessionStats = b
+	}
+	if v, ok := lookup("TSSH_CIPHERS"); ok {
+		c.Ciphers = splitList(v)
+	}
+	if v, ok := lookup("TSSH_MACS"); ok {
+		c.MACs = splitList(v)
+	}
+	if v, ok := lookup("TSSH_KEX_ALGORITHMS"); ok {
+		c.KeyExchanges = splitList(v)
+	}
+	return c.Validate()
+}
+
+// KeyExpiryWarning returns KeyExpiryWarningDays as a duration.
+func (c *Config) KeyExpiryWarning() time.Duration {
+	return time.Duration(c.KeyExpiryWarningDays) * 24 * time.Hour
+}
+
+// Level parses LogLevel, one of debug, info, warn or error.
+func (c *Config) Level() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return level, fmt.Errorf("log_level: %v", err)
+	}
+	return level, nil
+}
+
+// OnConnectCommand returns the command to run when a session to hostname opens, or "" for a shell.
+func (c *Config) OnConnectCommand(hostname string) string {
+	if command, ok := c.OnConnectHosts[hostname]; ok {
+		return command
+	}
+	return c.OnConnect
+}
+
+// PreConnectCommand returns the hook to run before a session to hostname opens, or "" for none.
+func (c *Config) PreConnectCommand(hostname string) string {
+	if command, ok := c.PreConnectHosts[hostname]; ok {
+		return command
+	}
+	return c.PreConnect
+}
+
+// PostConnectCommand returns the hook to run after a session to hostname ends, or "" for none.
+func (c *Config) PostConnectCommand(hostname string) string {
+	if command, ok := c.PostConnectHosts[hostname]; ok {
+		return command
+	}
+	return c.PostConnect
+}
+
+// UseLoginShell reports whether sessions to hostname start in a login shell.
+func (c *Config) UseLoginShell(hostname string) bool {
+	if login, ok := c.LoginShellHosts[hostname]; ok {
+		return login
+	}
+	return c.LoginShell
+}
+
+// OwnerUser returns the user to log in to a device owned by owner as, worked out with UserFromOwner, or "" if it
+// isn't set or doesn't match.
+func (c *Config) OwnerUser(owner string) string {
+	if c.UserFromOwner == "" {
+		return ""
+	}
+	re, err := regexp.Compile(c.UserFromOwner)
+	if err != nil {
+		return ""
+	}
+	match := re.FindStringSubmatch(owner)
+	switch {
+	case match == nil:
+		return ""
+	case len(match) == 1:
+		return match[0]
+	default:
+		return strings.Join(match[1:], "")
+	}
+}
+
+// LogPath returns the path of the log file, LogFile if it is set and otherwise tssh.log in the config directory.
+func (c *Config) LogPath() (string, error) {
+	if c.LogFile != "" {
+		return c.LogFile, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, logFileName), nil
+}
+
+// Validate reports settings that cannot be used.
+func (c *Config) Validate() error {
+	if c.KeyExpiryWarningDays < 0 {
+		return fmt.Errorf("key_expiry_warning_days must not be negative, got %d", c.KeyExpiryWarningDays)
+	}
+	if c.ConnectTimeout < 0 {
+		return fmt.Errorf("connect_timeout must not be negative, got %s", c.ConnectTimeout)
+	}
+	if c.APITimeout < 0 {
+		return fmt.Errorf("api_timeout must not be negative, got %s", c.APITimeout)
+	}
+	if _, err := c.Level(); err != nil {
+		return err
+	}
+	if c.SSHClient != SSHClientEmbedded && c.SSHClient != SSHClientSystem {
+		return fmt.Errorf("ssh_client must be %q or %q, got %q", SSHClientEmbedded, SSHClientSystem, c.SSHClient)
+	}
+	switch c.ColorProfile {
+	case "", ColorProfileTrueColor, ColorProfileANSI256, ColorProfileANSI, ColorProfileASCII:
+	default:
+		return fmt.Errorf("color_profile must be %q, %q, %q or %q, got %q", ColorProfileTrueColor, ColorProfileANSI256, ColorProfileANSI, ColorProfileASCII, c.ColorProfile)
+	}
+	if len(c.Padding) > 4 {
+		return fmt.Errorf("padding must have at most 4 sides, got %d", len(c.Padding))
+	}
+	for _, n := range c.Padding {
+		if n < 0 {
+			return fmt.Errorf("padding must not be negative, got %v", c.Padding)
+		}
+	}
+	if c.ReconnectAttempts < 0 {
+		return fmt.Errorf("reconnect_attempts must not be negative, got %d", c.ReconnectAttempts)
+	}
+	if c.CommandConcurrency < 1 {
+		return fmt.Errorf("command_concurrency must be at least 1, got %d", c.CommandConcurrency)
+	}
+	if c.FetchTimeout < 0 {
+		return fmt.Errorf("fetch_timeout must not be negative, got %s", c.FetchTimeout)
+	}
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval must not be negative, got %s", c.RefreshInterval)
+	}
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative, got %s", c.IdleTimeout)
+	}
+	if c.IdleWarning < 0 {
+		return fmt.Errorf("idle_warning must not be negative, got %s", c.IdleWarning)
+	}
+	if c.PoolIdleTimeout < 0 {
+		return fmt.Errorf("pool_idle_timeout must not be negative, got %s", c.PoolIdleTimeout)
+	}
+	if _, err := tssh.ParseTagFilter(c.TagFilter); err != nil {
+		return fmt.Errorf("tag_filter: %v", err)
+	}
+	if _, err := regexp.Compile(c.UserFromOwner); err != nil {
+		return fmt.Errorf("user_from_owner: %v", err)
+	}
+	if err := validateAlgorithms("ciphers", c.Ciphers, supportedCiphers); err != nil {
+		return err
+	}
+	if err := validateAlgorithms("macs", c.MACs, supportedMACs); err != nil {
+		return err
+	}
+	if err := validateAlgorithms("kex_algorithms", c.KeyExchanges, supportedKeyExchanges); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(c.Profiles))
+	for i, p := range c.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile %d has no name", i+1)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("profile %q is defined more than once", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	seen = make(map[string]bool, len(c.AdminCommands))
+	for i, a := range c.AdminCommands {
+		if a.Name == "" {
+			return fmt.Errorf("admin command %d has no name", i+1)
+		}
+		if strings.TrimSpace(a.Command) == "" {
+			return fmt.Errorf("admin command %q has no command", a.Name)
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("admin command %q is defined more than once", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return nil
+}
+
+// Profile returns the profile with the given name.
+func (c *Config) Profile(name string) (Profile, bool) {
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// LastProfile returns the name of the profile used most recently, or an empty string if none was saved.
+func LastProfile() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, lastProfileFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SaveLastProfile remembers name as the most recently used profile.
+func SaveLastProfile(name string) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, lastProfileFile), []byte(name+"\n"), 0o600)
+}
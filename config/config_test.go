@@ -0,0 +1,103 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+// env returns a lookup func for ApplyEnv over vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestApplyEnvNoColor(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		vars map[string]string
+		want bool
+	}{
+		{name: "unset", vars: map[string]string{}, want: false},
+		{name: "empty", vars: map[string]string{"NO_COLOR": ""}, want: false},
+		{name: "set", vars: map[string]string{"NO_COLOR": "1"}, want: true},
+		{name: "any value", vars: map[string]string{"NO_COLOR": "false"}, want: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			if err := c.ApplyEnv(env(test.vars)); err != nil {
+				t.Fatalf("ApplyEnv: %v", err)
+			}
+			if c.NoColor != test.want {
+				t.Errorf("NoColor = %v, want %v", c.NoColor, test.want)
+			}
+		})
+	}
+}
+
+func TestColorProfile(t *testing.T) {
+	for profile, ok := range map[string]bool{"": true, ColorProfileTrueColor: true, ColorProfileANSI256: true, ColorProfileANSI: true, ColorProfileASCII: true, "256": false} {
+		c := Default()
+		err := c.ApplyEnv(env(map[string]string{"TSSH_COLOR_PROFILE": profile}))
+		if (err == nil) != ok {
+			t.Errorf("TSSH_COLOR_PROFILE=%q: ApplyEnv = %v, want ok %v", profile, err, ok)
+		}
+		if c.ColorProfile != profile {
+			t.Errorf("ColorProfile = %q, want %q from TSSH_COLOR_PROFILE", c.ColorProfile, profile)
+		}
+	}
+}
+
+func TestValidateAdminCommands(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		commands []AdminCommand
+		ok       bool
+	}{
+		{name: "none", ok: true},
+		{name: "valid", commands: []AdminCommand{{Name: "Reboot", Command: "sudo reboot"}, {Name: "Shutdown", Command: "sudo shutdown -h now"}}, ok: true},
+		{name: "no name", commands: []AdminCommand{{Command: "sudo reboot"}}},
+		{name: "no command", commands: []AdminCommand{{Name: "Reboot", Command: " "}}},
+		{name: "duplicate", commands: []AdminCommand{{Name: "Reboot", Command: "sudo reboot"}, {Name: "Reboot", Command: "reboot"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			c.AdminCommands = test.commands
+			if err := c.Validate(); (err == nil) != test.ok {
+				t.Errorf("Validate = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, test := range []struct {
+		env  string
+		want []int
+		ok   bool
+	}{
+		{env: "0", want: []int{0}, ok: true},
+		{env: "1,2", want: []int{1, 2}, ok: true},
+		{env: "1, 2, 3, 4", want: []int{1, 2, 3, 4}, ok: true},
+		{env: "1,2,3,4,5"},
+		{env: "-1"},
+	} {
+		c := Default()
+		err := c.ApplyEnv(env(map[string]string{"TSSH_PADDING": test.env}))
+		if err == nil {
+			err = c.Validate()
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("TSSH_PADDING=%q: %v, want ok %v", test.env, err, test.ok)
+		}
+		if test.ok && !slices.Equal(c.Padding, test.want) {
+			t.Errorf("TSSH_PADDING=%q: padding = %v, want %v", test.env, c.Padding, test.want)
+		}
+	}
+
+	c := Default()
+	if err := c.ApplyEnv(env(map[string]string{"TSSH_PADDING": "one"})); err == nil {
+		t.Error("TSSH_PADDING=one: ApplyEnv succeeded, want an error")
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const deviceCacheFileName = "devices.json"
+
+// CachedDevices is the device list last fetched for a tailnet, for browsing while the API can't be reached.
+type CachedDevices struct {
+	FetchedAt time.Time          `json:"fetched_at"`
+	Devices   []tailscale.Device `json:"devices"`
+}
+
+// DeviceCache holds the last fetched device list of each tailnet, keyed by profile name.
+type DeviceCache map[string]CachedDevices
+
+// LoadDeviceCache reads the device cache from the config directory. A missing file yields an empty cache.
+func LoadDeviceCache() (DeviceCache, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	c := DeviceCache{}
+	b, err := os.ReadFile(filepath.Join(dir, deviceCacheFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the device cache to the config directory.
+func (c DeviceCache) Save() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, deviceCacheFileName), b, 0o600)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	historyFileName = "history.json"
+	// MaxHistory is how many commands are remembered per device.
+	MaxHistory = 50
+)
+
+// History holds the commands run on each device, most recent first, keyed by hostname.
+type History map[string][]string
+
+// LoadHistory reads the command history from the config directory. A missing file yields an empty history.
+func LoadHistory() (History, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	h := History{}
+	b, err := os.ReadFile(filepath.Join(dir, historyFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add records command as the most recent one run on host, dropping any earlier run of the same command and the
+// oldest commands beyond MaxHistory.
+func (h History) Add(host, command string) {
+	commands := []string{command}
+	for _, c := range h[host] {
+		if c != command && len(commands) < MaxHistory {
+			commands = append(commands, c)
+		}
+	}
+	h[host] = commands
+}
+
+// Save writes the history to the config directory.
+func (h History) Save() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, historyFileName), b, 0o600)
+}
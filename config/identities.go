@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const identitiesFileName = "identities.json"
+
+// Identities holds the identity file chosen for each device, keyed by hostname.
+type Identities map[string]string
+
+// LoadIdentities reads the chosen identity files from the config directory. A missing file yields no choices.
+func LoadIdentities() (Identities, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	i := Identities{}
+	b, err := os.ReadFile(filepath.Join(dir, identitiesFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return i, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Save writes the chosen identity files to the config directory.
+func (i Identities) Save() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, identitiesFileName), b, 0o600)
+}
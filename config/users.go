@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	usersFileName = "users.json"
+	// MaxUsers is how many usernames are remembered per device.
+	MaxUsers = 10
+)
+
+// Users holds the usernames each device has been logged in to as, most recent first, keyed by hostname.
+type Users map[string][]string
+
+// LoadUsers reads the remembered usernames from the config directory. A missing file yields none.
+func LoadUsers() (Users, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	u := Users{}
+	b, err := os.ReadFile(filepath.Join(dir, usersFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Add records user as the most recent one host was logged in to as, dropping any earlier use of the same user and
+// the oldest users beyond MaxUsers.
+func (u Users) Add(host, user string) {
+	users := []string{user}
+	for _, name := range u[host] {
+		if name != user && len(users) < MaxUsers {
+			users = append(users, name)
+		}
+	}
+	u[host] = users
+}
+
+// Save writes the remembered usernames to the config directory.
+func (u Users) Save() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, usersFileName), b, 0o600)
+}
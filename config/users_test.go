@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestUsersAdd(t *testing.T) {
+	u := Users{}
+	u.Add("web-1", "ubuntu")
+	u.Add("web-1", "deploy")
+	u.Add("web-1", "ubuntu")
+	if want := []string{"ubuntu", "deploy"}; !slices.Equal(u["web-1"], want) {
+		t.Errorf("users = %q, want %q", u["web-1"], want)
+	}
+
+	for i := 0; i < MaxUsers+5; i++ {
+		u.Add("db-1", fmt.Sprint("user", i))
+	}
+	if got := len(u["db-1"]); got != MaxUsers {
+		t.Errorf("remembered %d users, want %d", got, MaxUsers)
+	}
+	if got, want := u["db-1"][0], fmt.Sprint("user", MaxUsers+4); got != want {
+		t.Errorf("most recent user = %q, want %q", got, want)
+	}
+}
+
+func TestUsersSaveLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	u, err := LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers with no file: %v", err)
+	}
+	if len(u) != 0 {
+		t.Fatalf("LoadUsers with no file = %v, want none", u)
+	}
+
+	u.Add("web-1", "deploy")
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if !slices.Equal(loaded["web-1"], []string{"deploy"}) {
+		t.Errorf("loaded users = %v, want web-1 as deploy", loaded)
+	}
+}
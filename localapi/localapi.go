@@ -0,0 +1,170 @@
+// Package localapi reads what the machine's tailscaled knows about its peers from its LocalAPI, which the control
+// API doesn't report: whether a peer is connected right now, whether directly or through a DERP relay, and how
+// long a round trip to it takes.
+package localapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultSocket is where tailscaled listens for LocalAPI requests on Linux and with the open source tailscaled
+	// on macOS.
+	DefaultSocket = "/var/run/tailscale/tailscaled.sock"
+
+	// baseURL is the host tailscaled expects LocalAPI requests to be made to, whatever the socket.
+	baseURL        = "http://local-tailscaled.sock"
+	statusURI      = "/localapi/v0/status"
+	pingURIFmt     = "/localapi/v0/ping?ip=%s&type=disco"
+	maxErrorLength = 1 << 10
+)
+
+// ErrNotRunning is returned when tailscaled isn't listening on the socket, such as on machines without Tailscale.
+var ErrNotRunning = errors.New("localapi: tailscaled is not running")
+
+type (
+	// Client makes LocalAPI requests over tailscaled's unix socket.
+	Client struct {
+		socket string
+		http   *http.Client
+		logger *slog.Logger
+	}
+
+	// Option configures optional behaviour of the client.
+	Option func(*Client)
+
+	// Status is tailscaled's view of the tailnet, as returned by the status endpoint.
+	Status struct {
+		BackendState string
+		Self         *Peer
+		// Peer holds the other devices in the tailnet, keyed by node key.
+		Peer map[string]*Peer
+	}
+
+	// Peer is what tailscaled knows of a device. Relay is the DERP region the device's connection goes through when
+	// it isn't direct, and CurAddr the endpoint of the direct connection when it is.
+	Peer struct {
+		ID            string
+		HostName      string
+		DNSName       string
+		TailscaleIPs  []string
+		Online        bool
+		Active        bool
+		Relay         string
+		CurAddr       string
+		LastHandshake time.Time
+	}
+
+	// pingResult is the ping endpoint's response.
+	pingResult struct {
+		Err            string
+		LatencySeconds float64
+	}
+)
+
+// WithSocket sets the path of tailscaled's socket. DefaultSocket is used when this option is not provided or path
+// is empty.
+func WithSocket(path string) Option {
+	return func(c *Client) {
+		if path != "" {
+			c.socket = path
+		}
+	}
+}
+
+// WithLogger sets the logger requests are recorded to. slog.Default is used when this option is not provided.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// New returns a client for the tailscaled listening on the socket. It doesn't connect until a request is made.
+func New(opts ...Option) *Client {
+	c := &Client{socket: DefaultSocket, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.http = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", c.socket)
+		},
+	}}
+	return c
+}
+
+// LocalStatus returns tailscaled's view of the tailnet and the peers in it. Without tailscaled it returns
+// ErrNotRunning.
+func (c *Client) LocalStatus(ctx context.Context) (*Status, error) {
+	start := time.Now()
+	var status Status
+	if err := c.do(ctx, http.MethodGet, statusURI, &status); err != nil {
+		return nil, c.logError("status", start, err)
+	}
+	c.logger.Debug("fetched local status", "backend_state", status.BackendState, "peers", len(status.Peer), "duration", time.Since(start))
+	return &status, nil
+}
+
+// Ping measures the round trip to the peer with the Tailscale address ip with a disco ping, which goes over the
+// same path as the peer's traffic, direct or relayed.
+func (c *Client) Ping(ctx context.Context, ip string) (time.Duration, error) {
+	start := time.Now()
+	var result pingResult
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf(pingURIFmt, url.QueryEscape(ip)), &result); err != nil {
+		return 0, c.logError("ping", start, err)
+	}
+	if result.Err != "" {
+		return 0, c.logError("ping", start, errors.New(result.Err))
+	}
+	latency := time.Duration(result.LatencySeconds * float64(time.Second))
+	c.logger.Debug("pinged peer", "ip", ip, "latency", latency)
+	return latency, nil
+}
+
+func (c *Client) do(ctx context.Context, method, uri string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+uri, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w: %v", ErrNotRunning, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return fmt.Errorf("%s (%d)", body, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%v failed to decode response", err)
+	}
+	return nil
+}
+
+// logError records a failed request and returns err. tailscaled not running is expected on many machines, so it
+// is only logged at debug level.
+func (c *Client) logError(call string, start time.Time, err error) error {
+	level := slog.LevelError
+	if errors.Is(err, ErrNotRunning) {
+		level = slog.LevelDebug
+	}
+	c.logger.Log(context.Background(), level, "tailscale LocalAPI call failed", "call", call, "socket", c.socket, "duration", time.Since(start), "error", err)
+	return err
+}
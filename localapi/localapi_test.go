@@ -0,0 +1,110 @@
+package localapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTailscaled serves handler on a unix socket as tailscaled would, and returns a client for it.
+func startTailscaled(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return New(WithSocket(socket), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+}
+
+func TestLocalStatus(t *testing.T) {
+	c := startTailscaled(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != statusURI || r.Host != "local-tailscaled.sock" {
+			t.Errorf("request = %s %s%s, want GET local-tailscaled.sock%s", r.Method, r.Host, r.URL.Path, statusURI)
+		}
+		io.WriteString(w, `{
+			"BackendState": "Running",
+			"Self": {"HostName": "laptop", "TailscaleIPs": ["100.64.0.1"]},
+			"Peer": {
+				"nodekey:1": {"ID": "n1", "HostName": "web-1", "TailscaleIPs": ["100.64.0.2", "fd7a:115c:a1e0::2"], "Online": true, "CurAddr": "192.0.2.1:41641"},
+				"nodekey:2": {"ID": "n2", "HostName": "db-1", "TailscaleIPs": ["100.64.0.3"], "Online": true, "Relay": "fra"}
+			},
+			"Version": "1.56.0"
+		}`)
+	})
+
+	status, err := c.LocalStatus(context.Background())
+	if err != nil {
+		t.Fatalf("LocalStatus: %v", err)
+	}
+	if status.BackendState != "Running" || status.Self == nil || status.Self.HostName != "laptop" {
+		t.Errorf("status = %+v, want tailscaled's own state", status)
+	}
+	web, db := status.Peer["nodekey:1"], status.Peer["nodekey:2"]
+	if web == nil || db == nil {
+		t.Fatalf("peers = %v, want both", status.Peer)
+	}
+	if !web.Online || web.CurAddr != "192.0.2.1:41641" || len(web.TailscaleIPs) != 2 {
+		t.Errorf("web-1 = %+v, want online directly with both addresses", web)
+	}
+	if db.Relay != "fra" || db.CurAddr != "" {
+		t.Errorf("db-1 = %+v, want relayed via fra", db)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := startTailscaled(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/localapi/v0/ping" || r.URL.Query().Get("type") != "disco" {
+			t.Errorf("request = %s %s, want a POSTed disco ping", r.Method, r.URL)
+		}
+		switch r.URL.Query().Get("ip") {
+		case "100.64.0.2":
+			io.WriteString(w, `{"LatencySeconds": 0.012}`)
+		default:
+			io.WriteString(w, `{"Err": "no matching peer"}`)
+		}
+	})
+
+	latency, err := c.Ping(context.Background(), "100.64.0.2")
+	if err != nil || latency != 12*time.Millisecond {
+		t.Errorf("Ping = %v, %v, want 12ms", latency, err)
+	}
+	if _, err := c.Ping(context.Background(), "100.64.0.9"); err == nil || err.Error() != "no matching peer" {
+		t.Errorf("Ping of an unknown peer = %v, want tailscaled's error", err)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	c := startTailscaled(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "access denied", http.StatusForbidden)
+	})
+	_, err := c.LocalStatus(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "access denied") || !strings.Contains(err.Error(), "403") {
+		t.Errorf("LocalStatus = %v, want tailscaled's error and status", err)
+	}
+	if errors.Is(err, ErrNotRunning) {
+		t.Errorf("LocalStatus = %v, want it told apart from tailscaled not running", err)
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	c := New(WithSocket(filepath.Join(t.TempDir(), "tailscaled.sock")), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if _, err := c.LocalStatus(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("LocalStatus = %v, want ErrNotRunning", err)
+	}
+	if _, err := c.Ping(context.Background(), "100.64.0.2"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Ping = %v, want ErrNotRunning", err)
+	}
+}
@@ -0,0 +1,126 @@
+package sshproxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gliderlabs/ssh"
+	"golang.org/x/crypto/bcrypt"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ErrBadPassword is returned by a PasswordAuthenticator for an unknown user or a wrong password.
+var ErrBadPassword = errors.New("wrong user or password")
+
+// errNoPublicKeyAuth refuses public keys when the proxy has no PublicKeyAuthenticator to check them with.
+var errNoPublicKeyAuth = errors.New("public key authentication is not configured")
+
+// PasswordAuthenticator checks the password a client gave for the user behind ctx. Returning an error refuses the
+// client.
+type PasswordAuthenticator interface {
+	Authenticate(ctx ssh.Context, password string) error
+}
+
+// PublicKeyAuthenticator checks the public key a client offered for the user behind ctx. Returning an error refuses
+// the key.
+type PublicKeyAuthenticator interface {
+	AuthenticateKey(ctx ssh.Context, key ssh.PublicKey) error
+}
+
+// PasswordAuthenticatorFunc lets an ordinary function be used as a PasswordAuthenticator.
+type PasswordAuthenticatorFunc func(ctx ssh.Context, password string) error
+
+// Authenticate calls f(ctx, password).
+func (f PasswordAuthenticatorFunc) Authenticate(ctx ssh.Context, password string) error {
+	return f(ctx, password)
+}
+
+// PublicKeyAuthenticatorFunc lets an ordinary function be used as a PublicKeyAuthenticator.
+type PublicKeyAuthenticatorFunc func(ctx ssh.Context, key ssh.PublicKey) error
+
+// AuthenticateKey calls f(ctx, key).
+func (f PublicKeyAuthenticatorFunc) AuthenticateKey(ctx ssh.Context, key ssh.PublicKey) error {
+	return f(ctx, key)
+}
+
+// authorizedKeys is the public keys clients may log in with as any user.
+type authorizedKeys []ssh.PublicKey
+
+// AuthorizedKeysFile reads a PublicKeyAuthenticator from path, a file in OpenSSH's authorized_keys format, which
+// accepts its keys whichever user a client logs in as. Options before a key are ignored.
+func AuthorizedKeysFile(path string) (PublicKeyAuthenticator, error) {
+	keys, err := readAuthorizedKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return authorizedKeys(keys), nil
+}
+
+func (a authorizedKeys) AuthenticateKey(ctx ssh.Context, key ssh.PublicKey) error {
+	for _, k := range a {
+		if ssh.KeysEqual(k, key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", gossh.FingerprintSHA256(key), ErrKeyNotAuthorized)
+}
+
+// passwordFile maps users to bcrypt hashes of their passwords.
+type passwordFile map[string][]byte
+
+// unknownUserHash is compared against for users missing from a password file, so that they take as long to
+// refuse as a wrong password does and can't be told apart by timing.
+var unknownUserHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+	return hash
+})
+
+// PasswordFile reads a PasswordAuthenticator from path, which holds one user:hash line per user, where hash is a
+// bcrypt hash such as those written by htpasswd -B. Blank lines and lines starting with # are ignored. Clients are
+// looked up by the user they log in to the destination as, without the +host suffix.
+func PasswordFile(path string) (PasswordAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := passwordFile{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		users[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (p passwordFile) Authenticate(ctx ssh.Context, password string) error {
+	hash, ok := p[destinationUser(ctx.User())]
+	if !ok {
+		hash = unknownUserHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return ErrBadPassword
+	}
+	return nil
+}
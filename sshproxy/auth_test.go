@@ -0,0 +1,206 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"golang.org/x/crypto/bcrypt"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestPasswordFile(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	auth, err := PasswordFile(write("passwords", "# proxy users\n\nalice:"+string(hash)+"\n"))
+	if err != nil {
+		t.Fatalf("PasswordFile: %v", err)
+	}
+	for _, tt := range []struct {
+		user, password string
+		want           error
+	}{
+		{"alice", "secret", nil},
+		// the +host suffix naming the destination is ignored.
+		{"alice+100.64.0.1", "secret", nil},
+		{"alice", "wrong", ErrBadPassword},
+		{"bob", "secret", ErrBadPassword},
+	} {
+		if err := auth.Authenticate(newTestContext(tt.user), tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("Authenticate(%s, %s) = %v, want %v", tt.user, tt.password, err, tt.want)
+		}
+	}
+
+	for name, contents := range map[string]string{
+		"no hash":  "alice\n",
+		"no user":  ":" + string(hash) + "\n",
+		"bad hash": "alice:secret\n",
+	} {
+		if _, err := PasswordFile(write(name, contents)); err == nil {
+			t.Errorf("PasswordFile(%s) succeeded", name)
+		}
+	}
+	if _, err := PasswordFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("PasswordFile(missing) succeeded")
+	}
+}
+
+func TestAuthorizedKeysFile(t *testing.T) {
+	authorized, other := testSigner(t), testSigner(t)
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	auth, err := AuthorizedKeysFile(write("authorized_keys", "# proxy clients\n"+string(gossh.MarshalAuthorizedKey(authorized.PublicKey()))))
+	if err != nil {
+		t.Fatalf("AuthorizedKeysFile: %v", err)
+	}
+	for _, user := range []string{"alice", "bob+100.64.0.1"} {
+		if err := auth.AuthenticateKey(newTestContext(user), authorized.PublicKey()); err != nil {
+			t.Errorf("AuthenticateKey(%s, authorized) = %v", user, err)
+		}
+		if err := auth.AuthenticateKey(newTestContext(user), other.PublicKey()); !errors.Is(err, ErrKeyNotAuthorized) {
+			t.Errorf("AuthenticateKey(%s, other) = %v, want %v", user, err, ErrKeyNotAuthorized)
+		}
+	}
+
+	for name, contents := range map[string]string{
+		"empty":   "# no keys\n",
+		"bad key": "ssh-ed25519 not-base64\n",
+	} {
+		if _, err := AuthorizedKeysFile(write(name, contents)); err == nil {
+			t.Errorf("AuthorizedKeysFile(%s) succeeded", name)
+		}
+	}
+	if _, err := AuthorizedKeysFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("AuthorizedKeysFile(missing) succeeded")
+	}
+}
+
+func TestAuthThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		io.WriteString(s, s.User()+"\n")
+		s.Exit(0)
+	}})
+	var checked atomic.Int32
+	auth := PasswordAuthenticatorFunc(func(ctx ssh.Context, password string) error {
+		checked.Add(1)
+		if destinationUser(ctx.User()) != "ubuntu" || password != "secret" {
+			return ErrBadPassword
+		}
+		return nil
+	})
+	proxy := startProxy(t, 0, 0, nil, WithPasswordAuth(auth), WithKeyboardInteractiveAuth(auth))
+
+	password := func(p string) gossh.AuthMethod { return gossh.Password(p) }
+	keyboard := func(p string) gossh.AuthMethod {
+		return gossh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			if len(questions) != 1 {
+				return nil, fmt.Errorf("asked %d questions", len(questions))
+			}
+			return []string{p}, nil
+		})
+	}
+	dial := func(methods ...gossh.AuthMethod) (*gossh.Client, error) {
+		return gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+			User:            "ubuntu+" + dest,
+			Auth:            methods,
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+	}
+
+	for _, method := range []struct {
+		name string
+		auth func(string) gossh.AuthMethod
+	}{{"password", password}, {"keyboard-interactive", keyboard}} {
+		t.Run(method.name, func(t *testing.T) {
+			if client, err := dial(method.auth("wrong")); err == nil {
+				client.Close()
+				t.Error("logged in with the wrong password")
+			}
+
+			// once the password is accepted the proxy connects to the destination as it does for a key.
+			client, err := dial(method.auth("secret"))
+			if err != nil {
+				t.Fatalf("logging in with the right password: %v", err)
+			}
+			defer client.Close()
+			session, err := client.NewSession()
+			if err != nil {
+				t.Fatalf("NewSession: %v", err)
+			}
+			defer session.Close()
+			if out, err := session.Output("whoami"); err != nil || string(out) != "ubuntu\n" {
+				t.Errorf("whoami = %q, %v", out, err)
+			}
+		})
+	}
+
+	t.Run("public key first", func(t *testing.T) {
+		// a client offering a key as well is let in with it, without being asked for its password.
+		checked.Store(0)
+		client, err := dial(gossh.PublicKeys(testSigner(t)), password("wrong"))
+		if err != nil {
+			t.Fatalf("logging in with a key: %v", err)
+		}
+		client.Close()
+		if n := checked.Load(); n != 0 {
+			t.Errorf("checked %d passwords, want none", n)
+		}
+	})
+
+	t.Run("no key authenticator", func(t *testing.T) {
+		// without a PublicKeyAuthenticator the proxy refuses every key rather than letting anyone through.
+		proxy := startProxy(t, 0, 0, nil, WithPublicKeyAuth(nil))
+		if client, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+			User:            "ubuntu+" + dest,
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t))},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		}); err == nil {
+			client.Close()
+			t.Error("logged in with a key no authenticator checked")
+		}
+	})
+
+	t.Run("refused key", func(t *testing.T) {
+		// a key the proxy refuses falls back to the password. Routes without any routes refuse every key.
+		proxy := startProxy(t, 0, 0, nil, WithPasswordAuth(auth), WithPublicKeyAuth(Routes{}))
+		client, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+			User:            "ubuntu+" + dest,
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t)), password("secret")},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("logging in with a password after a refused key: %v", err)
+		}
+		client.Close()
+	})
+}
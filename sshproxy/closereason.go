@@ -0,0 +1,68 @@
+package sshproxy
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// CloseReason is why a proxied channel ended, as logged when it closes.
+type CloseReason string
+
+const (
+	// CloseClient is a channel the client closed, or whose connection the client closed.
+	CloseClient CloseReason = "client_closed"
+	// CloseRemote is a channel the destination closed, usually as the remote command exited.
+	CloseRemote CloseReason = "remote_closed"
+	// CloseError is a channel ended by an error proxying its data or requests.
+	CloseError CloseReason = "error"
+	// CloseTimeout is a channel whose connection was open for the proxy's max timeout.
+	CloseTimeout CloseReason = "timeout"
+	// CloseIdle is a channel that, or whose connection, carried no data for the idle timeout.
+	CloseIdle CloseReason = "idle"
+)
+
+// precedence ranks reasons by how much they explain. A timeout closes both sides, which would otherwise be
+// recorded as whichever side noticed first, and an error is more telling than the close that follows it.
+func (r CloseReason) precedence() int {
+	switch r {
+	case CloseTimeout, CloseIdle:
+		return 2
+	case CloseError:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// channelClose records why a channel ended, as the goroutines proxying it notice. The first reason recorded is
+// kept unless one of higher precedence follows.
+type channelClose struct {
+	mu     sync.Mutex
+	reason CloseReason
+	err    error
+}
+
+func (c *channelClose) set(reason CloseReason, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reason == "" || reason.precedence() > c.reason.precedence() {
+		c.reason, c.err = reason, err
+	}
+}
+
+func (c *channelClose) get() (CloseReason, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason, c.err
+}
+
+// copyError returns the error io.Copy ended with, unless it ended normally. io.Copy returns nil once its source
+// is at EOF, and io.EOF when writing to a channel the other side has already closed, neither of which is an error
+// in proxying the channel.
+func copyError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
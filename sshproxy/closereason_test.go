@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+)
+
+func TestCloseReason(t *testing.T) {
+	// waitForClose blocks the session until the client or the proxy closes it.
+	waitForClose := func(s ssh.Session) { <-s.Context().Done() }
+	exit := func(s ssh.Session) {
+		io.WriteString(s, "bye\n")
+		s.Exit(0)
+	}
+
+	for _, test := range []struct {
+		name                    string
+		handler                 ssh.Handler
+		idleTimeout, maxTimeout time.Duration
+		opts                    []Option
+		closeClient             bool
+		want                    CloseReason
+	}{
+		{name: "client closed", handler: waitForClose, closeClient: true, want: CloseClient},
+		{name: "remote closed", handler: exit, want: CloseRemote},
+		{name: "channel idle", handler: waitForClose, opts: []Option{WithChannelIdleTimeout(200 * time.Millisecond)}, want: CloseIdle},
+		{name: "connection idle", handler: waitForClose, idleTimeout: 300 * time.Millisecond, want: CloseIdle},
+		{name: "max timeout", handler: waitForClose, maxTimeout: 300 * time.Millisecond, want: CloseTimeout},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dest := startDestination(t, &ssh.Server{Handler: test.handler})
+			logs := newLogRecorder()
+			proxy := startProxy(t, test.idleTimeout, test.maxTimeout, logs, test.opts...)
+			client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+			session, err := client.NewSession()
+			if err != nil {
+				t.Fatalf("NewSession: %v", err)
+			}
+			if err := session.Start("true"); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if test.closeClient {
+				session.Close()
+			}
+			if got := logs.reason(t); got != test.want {
+				t.Errorf("reason = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCopyError(t *testing.T) {
+	broken := errors.New("connection reset by peer")
+	closed := &channelClose{}
+	proxy, err := New("test", "127.0.0.1:0", "test", "", make(chan struct{}), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := collectErrors(proxy)
+
+	// EOF, from the source or from writing to a channel already closed, is how streams normally end.
+	for _, err := range []error{nil, io.EOF} {
+		proxy.copyDone(closed, "remote to local", err, newTestContext("ubuntu"))
+	}
+	if reason, _ := closed.get(); reason != "" {
+		t.Fatalf("reason after EOF = %q, want none", reason)
+	}
+
+	closed.set(CloseRemote, nil)
+	go proxy.copyDone(closed, "remote to local", broken, newTestContext("ubuntu"))
+	<-errs
+	if reason, err := closed.get(); reason != CloseError || err == nil {
+		t.Errorf("reason = %q, %v, want an error", reason, err)
+	}
+
+	// a timeout explains the errors it causes.
+	closed.set(CloseTimeout, nil)
+	closed.set(CloseError, broken)
+	if reason, _ := closed.get(); reason != CloseTimeout {
+		t.Errorf("reason = %q, want the timeout kept", reason)
+	}
+}
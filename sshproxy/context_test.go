@@ -0,0 +1,41 @@
+package sshproxy
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// testContext is an ssh.Context for a connection logged in as user, for calling handlers outside a server.
+type testContext struct {
+	context.Context
+	sync.Mutex
+	user   string
+	values map[any]any
+}
+
+func newTestContext(user string) *testContext {
+	return &testContext{Context: context.Background(), user: user, values: map[any]any{}}
+}
+
+func (c *testContext) Value(key any) any {
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *testContext) SetValue(key, value any) { c.values[key] = value }
+func (c *testContext) User() string            { return c.user }
+func (c *testContext) SessionID() string       { return "test" }
+func (c *testContext) ClientVersion() string   { return "SSH-2.0-test" }
+func (c *testContext) ServerVersion() string   { return "SSH-2.0-tssh_test" }
+func (c *testContext) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+}
+func (c *testContext) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+}
+func (c *testContext) Permissions() *ssh.Permissions { return &ssh.Permissions{} }
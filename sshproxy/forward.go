@@ -0,0 +1,50 @@
+package sshproxy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const directTCPIPChannelType = "direct-tcpip"
+
+// ErrForwardDenied is returned by a ForwardPolicy to refuse a forwarding target.
+var ErrForwardDenied = errors.New("forwarding to this destination is not allowed")
+
+// ForwardTarget is where a client asked a direct-tcpip channel to connect, as sent in the channel open request
+// (RFC 4254 section 7.2).
+type ForwardTarget struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+// String returns the target as host:port.
+func (t ForwardTarget) String() string {
+	return fmt.Sprintf("%s:%d", t.Host, t.Port)
+}
+
+// ForwardPolicy decides whether the client behind ctx may forward to target. Returning an error refuses the
+// channel, and the error's message is sent to the client.
+type ForwardPolicy func(ctx ssh.Context, target ForwardTarget) error
+
+// refuseForwarding is the ForwardPolicy of a proxy given none. It refuses every target, so that a proxy isn't an
+// open relay into whatever networks its destinations can reach until it is told where forwards may go.
+func refuseForwarding(ssh.Context, ForwardTarget) error {
+	return fmt.Errorf("%w: no forwarding rules are configured", ErrForwardDenied)
+}
+
+// parseForwardTarget decodes the extra data of a direct-tcpip channel open request.
+func parseForwardTarget(data []byte) (ForwardTarget, error) {
+	var target ForwardTarget
+	if err := gossh.Unmarshal(data, &target); err != nil {
+		return ForwardTarget{}, fmt.Errorf("%v failed to parse direct-tcpip request", err)
+	}
+	if target.Host == "" || target.Port == 0 || target.Port > 65535 {
+		return ForwardTarget{}, fmt.Errorf("invalid direct-tcpip target %s", target)
+	}
+	return target, nil
+}
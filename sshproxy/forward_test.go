@@ -0,0 +1,125 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestParseForwardTarget(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		want    ForwardTarget
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: gossh.Marshal(&ForwardTarget{Host: "100.64.0.7", Port: 22, OriginHost: "127.0.0.1", OriginPort: 50000}),
+			want: ForwardTarget{Host: "100.64.0.7", Port: 22, OriginHost: "127.0.0.1", OriginPort: 50000},
+		},
+		{name: "malformed", data: []byte{0, 0, 0, 9, 'l', 'o'}, wantErr: true},
+		{name: "empty", data: nil, wantErr: true},
+		{name: "empty host", data: gossh.Marshal(&ForwardTarget{Port: 22}), wantErr: true},
+		{name: "port 0", data: gossh.Marshal(&ForwardTarget{Host: "100.64.0.7"}), wantErr: true},
+		{name: "port above 65535", data: gossh.Marshal(&ForwardTarget{Host: "100.64.0.7", Port: 65536}), wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseForwardTarget(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseForwardTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseForwardTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// startEcho serves a TCP echo on a local port for the length of the test, as a forwarding target, and returns its
+// address.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestForwardThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{
+		Handler:                     func(s ssh.Session) { s.Exit(0) },
+		LocalPortForwardingCallback: func(ssh.Context, string, uint32) bool { return true },
+		ChannelHandlers: map[string]ssh.ChannelHandler{
+			"session":              ssh.DefaultSessionHandler,
+			directTCPIPChannelType: ssh.DirectTCPIPHandler,
+		},
+	})
+	allowed, denied := startEcho(t), startEcho(t)
+	rule, err := ParseForwardRule(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := startProxy(t, 0, 0, nil, WithForwardRules(ForwardRules{Allow: []ForwardRule{rule}}))
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	t.Run("allowed", func(t *testing.T) {
+		conn, err := client.Dial("tcp", allowed)
+		if err != nil {
+			t.Fatalf("forwarding to %s: %v", allowed, err)
+		}
+		defer conn.Close()
+
+		want := "hello through the proxy"
+		if _, err := io.WriteString(conn, want); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(conn, got); err != nil {
+			t.Fatalf("reading the echo: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("echoed %q, want %q", got, want)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		conn, err := client.Dial("tcp", denied)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("forwarded to %s, which no rule allows", denied)
+		}
+		var openErr *gossh.OpenChannelError
+		if !errors.As(err, &openErr) {
+			t.Fatalf("forwarding to %s: %v, want the channel rejected", denied, err)
+		}
+		if openErr.Reason != gossh.Prohibited {
+			t.Errorf("rejected with reason %v, want %v", openErr.Reason, gossh.Prohibited)
+		}
+		if !strings.Contains(openErr.Message, ErrForwardDenied.Error()) {
+			t.Errorf("rejected with %q, want the forward denied", openErr.Message)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package sshproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// ForwardRule matches forwarding targets whose address is in Network and whose port is between MinPort and
+// MaxPort inclusive.
+type ForwardRule struct {
+	Network netip.Prefix
+	MinPort uint16
+	MaxPort uint16
+}
+
+// ParseForwardRule parses a rule of the form network[:ports], where network is a CIDR prefix or a single IP
+// address and ports is a port, a range such as 8000-9000, or * for every port. IPv6 networks must be bracketed
+// when ports are given, e.g. [fd7a:115c:a1e0::/48]:22. Leaving out the ports matches every port.
+func ParseForwardRule(s string) (ForwardRule, error) {
+	network, ports := s, "*"
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return ForwardRule{}, fmt.Errorf("forward rule %q: missing ]", s)
+		}
+		network = s[1:end]
+		if rest := s[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return ForwardRule{}, fmt.Errorf("forward rule %q: expected :ports after ]", s)
+			}
+			ports = rest[1:]
+		}
+	} else if strings.Count(s, ":") == 1 {
+		network, ports, _ = strings.Cut(s, ":")
+	}
+
+	prefix, err := parseNetwork(network)
+	if err != nil {
+		return ForwardRule{}, fmt.Errorf("forward rule %q: %v", s, err)
+	}
+	minPort, maxPort, err := parsePortRange(ports)
+	if err != nil {
+		return ForwardRule{}, fmt.Errorf("forward rule %q: %v", s, err)
+	}
+	return ForwardRule{Network: prefix, MinPort: minPort, MaxPort: maxPort}, nil
+}
+
+func parseNetwork(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func parsePortRange(s string) (uint16, uint16, error) {
+	if s == "*" {
+		return 1, 65535, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	minPort, err := strconv.ParseUint(lo, 10, 16)
+	if err != nil || minPort == 0 {
+		return 0, 0, fmt.Errorf("invalid port %q", lo)
+	}
+	maxPort, err := strconv.ParseUint(hi, 10, 16)
+	if err != nil || maxPort < minPort {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return uint16(minPort), uint16(maxPort), nil
+}
+
+// Matches reports whether addr:port falls within the rule.
+func (r ForwardRule) Matches(addr netip.Addr, port uint32) bool {
+	return r.Network.Contains(addr.Unmap()) && port >= uint32(r.MinPort) && port <= uint32(r.MaxPort)
+}
+
+// String returns the rule in the form ParseForwardRule accepts.
+func (r ForwardRule) String() string {
+	ports := fmt.Sprintf("%d-%d", r.MinPort, r.MaxPort)
+	switch {
+	case r.MinPort == 1 && r.MaxPort == 65535:
+		ports = "*"
+	case r.MinPort == r.MaxPort:
+		ports = strconv.Itoa(int(r.MinPort))
+	}
+	if r.Network.Addr().Is6() {
+		return "[" + r.Network.String() + "]:" + ports
+	}
+	return r.Network.String() + ":" + ports
+}
+
+// ForwardRules restricts forwarding targets, or with WithDestinationRules the destinations connections are proxied
+// to. A target is refused if any Deny rule matches it, and otherwise allowed only if an Allow rule does, so with no
+// Allow rules nothing can be forwarded.
+type ForwardRules struct {
+	Allow []ForwardRule
+	Deny  []ForwardRule
+}
+
+// Policy returns a ForwardPolicy enforcing the rules. Targets given as hostnames are resolved by the proxy, and
+// are allowed only if every address they resolve to is.
+func (r ForwardRules) Policy() ForwardPolicy {
+	return func(ctx ssh.Context, target ForwardTarget) error {
+		if err := r.check(ctx, target.Host, target.Port); err != nil {
+			return fmt.Errorf("%w: %v", ErrForwardDenied, err)
+		}
+		return nil
+	}
+}
+
+// checkDestination checks the destination host:port a connection resolved to against the rules.
+func (r ForwardRules) checkDestination(ctx context.Context, hostport string) error {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDestinationDenied, err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("%w: invalid port %q", ErrDestinationDenied, port)
+	}
+	if err := r.check(ctx, host, uint32(p)); err != nil {
+		return fmt.Errorf("%w: %v", ErrDestinationDenied, err)
+	}
+	return nil
+}
+
+// check returns an error unless every address host resolves to is allowed on port. The error names the address
+// refused.
+func (r ForwardRules) check(ctx context.Context, host string, port uint32) error {
+	addrs, err := resolveTarget(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !r.allows(addr, port) {
+			return errors.New(netip.AddrPortFrom(addr, uint16(port)).String())
+		}
+	}
+	return nil
+}
+
+func (r ForwardRules) allows(addr netip.Addr, port uint32) bool {
+	for _, rule := range r.Deny {
+		if rule.Matches(addr, port) {
+			return false
+		}
+	}
+	for _, rule := range r.Allow {
+		if rule.Matches(addr, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarget returns the addresses of host, which may already be an IP address.
+func resolveTarget(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("%v failed to resolve %s", err, host)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,99 @@
+package sshproxy
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestParseForwardRule(t *testing.T) {
+	for _, test := range []struct {
+		rule, want string
+	}{
+		{rule: "100.64.0.0/10", want: "100.64.0.0/10:*"},
+		{rule: "100.64.1.2/10:22", want: "100.64.0.0/10:22"},
+		{rule: "10.0.0.5:8000-9000", want: "10.0.0.5/32:8000-9000"},
+		{rule: "[fd7a:115c:a1e0::/48]:22", want: "[fd7a:115c:a1e0::/48]:22"},
+		{rule: "[fd7a:115c:a1e0::1]", want: "[fd7a:115c:a1e0::1/128]:*"},
+		{rule: "fd7a:115c:a1e0::/48", want: "[fd7a:115c:a1e0::/48]:*"},
+	} {
+		rule, err := ParseForwardRule(test.rule)
+		if err != nil {
+			t.Errorf("ParseForwardRule(%q): %v", test.rule, err)
+			continue
+		}
+		if got := rule.String(); got != test.want {
+			t.Errorf("ParseForwardRule(%q) = %s, want %s", test.rule, got, test.want)
+		}
+	}
+
+	for _, rule := range []string{"", "web-1", "10.0.0.0/33", "10.0.0.1:0", "10.0.0.1:9000-8000", "10.0.0.1:http", "[::1", "[::1]22"} {
+		if _, err := ParseForwardRule(rule); err == nil {
+			t.Errorf("ParseForwardRule(%q) succeeded, want an error", rule)
+		}
+	}
+}
+
+func TestForwardRuleMatches(t *testing.T) {
+	rule, err := ParseForwardRule("10.1.0.0/16:8000-9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		addr string
+		port uint32
+		want bool
+	}{
+		{"10.1.2.3", 8000, true},
+		{"10.1.2.3", 9000, true},
+		{"10.1.2.3", 7999, false},
+		{"10.1.2.3", 9001, false},
+		{"10.2.0.1", 8080, false},
+		// IPv4-mapped IPv6 addresses are the IPv4 address.
+		{"::ffff:10.1.2.3", 8080, true},
+	} {
+		if got := rule.Matches(netip.MustParseAddr(test.addr), test.port); got != test.want {
+			t.Errorf("%s matches %s:%d = %v, want %v", rule, test.addr, test.port, got, test.want)
+		}
+	}
+}
+
+func TestForwardRulesPolicy(t *testing.T) {
+	parse := func(rules ...string) []ForwardRule {
+		var parsed []ForwardRule
+		for _, r := range rules {
+			rule, err := ParseForwardRule(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed = append(parsed, rule)
+		}
+		return parsed
+	}
+	policy := ForwardRules{Allow: parse("100.64.0.0/10:22", "10.0.0.0/8"), Deny: parse("10.0.0.1")}.Policy()
+	ctx := newTestContext("ubuntu")
+
+	for _, test := range []struct {
+		target ForwardTarget
+		want   bool
+	}{
+		{ForwardTarget{Host: "100.64.0.7", Port: 22}, true},
+		{ForwardTarget{Host: "100.64.0.7", Port: 80}, false},
+		{ForwardTarget{Host: "10.9.8.7", Port: 5432}, true},
+		{ForwardTarget{Host: "10.0.0.1", Port: 5432}, false},
+		{ForwardTarget{Host: "192.168.0.1", Port: 22}, false},
+		{ForwardTarget{Host: "localhost", Port: 22}, false},
+	} {
+		err := policy(ctx, test.target)
+		if got := err == nil; got != test.want {
+			t.Errorf("forward to %s allowed = %v, want %v (%v)", test.target, got, test.want, err)
+		}
+		if err != nil && !errors.Is(err, ErrForwardDenied) {
+			t.Errorf("forward to %s refused with %v, want ErrForwardDenied", test.target, err)
+		}
+	}
+
+	if err := (ForwardRules{}).Policy()(ctx, ForwardTarget{Host: "100.64.0.7", Port: 22}); !errors.Is(err, ErrForwardDenied) {
+		t.Errorf("with no rules, forward allowed (%v), want it refused", err)
+	}
+}
@@ -0,0 +1,98 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// healthStatus is the body of the health endpoints.
+type healthStatus struct {
+	Status         string `json:"status"`
+	ActiveSessions int64  `json:"active_sessions"`
+	Uptime         string `json:"uptime"`
+}
+
+// healthHandler serves /healthz, which is OK once the SSH listener is up, and /readyz, which is OK while the proxy
+// can take another connection: the listener is up, it isn't shutting down and it is below its session limit. Both
+// report the active sessions and the uptime.
+func (s *SSHProxy) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeHealth(w, s.listening())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready := s.listening() && !s.shuttingDown()
+		if s.opts.maxSessions > 0 && s.activeSessions.Load() >= int64(s.opts.maxSessions) {
+			ready = false
+		}
+		s.writeHealth(w, ready)
+	})
+	return mux
+}
+
+func (s *SSHProxy) writeHealth(w http.ResponseWriter, ok bool) {
+	status := healthStatus{Status: "ok", ActiveSessions: s.activeSessions.Load()}
+	if !s.started.IsZero() {
+		status.Uptime = time.Since(s.started).Round(time.Second).String()
+	}
+	code := http.StatusOK
+	if !ok {
+		status.Status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// listening reports whether the SSH listener is up.
+func (s *SSHProxy) listening() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// shuttingDown reports whether the proxy has been told to shut down.
+func (s *SSHProxy) shuttingDown() bool {
+	select {
+	case <-s.shutdownC:
+		return true
+	default:
+		return false
+	}
+}
+
+// startHealth starts serving the health endpoints on the configured address, until the proxy shuts down.
+func (s *SSHProxy) startHealth() error {
+	ln, err := net.Listen("tcp", s.opts.healthAddr)
+	if err != nil {
+		return fmt.Errorf("%v failed to listen for health checks", err)
+	}
+	s.healthAddr = ln.Addr()
+	srv := &http.Server{Handler: s.healthHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.reportError(fmt.Errorf("health check server failed: %v", err))
+		}
+	}()
+	go func() {
+		<-s.shutdownC
+		srv.Close()
+	}()
+	return nil
+}
+
+// HealthAddr returns the address the health endpoints are served on, or nil if they are off. Like ListenAddr it is
+// only meaningful after Ready has fired.
+func (s *SSHProxy) HealthAddr() net.Addr {
+	return s.healthAddr
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getHealth(t *testing.T, h http.Handler, path string) (int, healthStatus) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var status healthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return rec.Code, status
+}
+
+func TestHealthCheck(t *testing.T) {
+	shutdownC := make(chan struct{})
+	proxy, err := New("test", "127.0.0.1:0", "test", "", shutdownC, 0, 0, WithHealthCheck("127.0.0.1:0"), WithMaxSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := proxy.healthHandler()
+
+	// not listening yet.
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, _ := getHealth(t, h, path); code != http.StatusServiceUnavailable {
+			t.Errorf("%s before start = %d, want 503", path, code)
+		}
+	}
+
+	go proxy.Start()
+	<-proxy.Ready()
+	resp, err := http.Get("http://" + proxy.HealthAddr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz once listening = %d, want 200", resp.StatusCode)
+	}
+	if code, status := getHealth(t, h, "/readyz"); code != http.StatusOK || status.Uptime == "" {
+		t.Errorf("/readyz once listening = %d %+v, want 200 with the uptime", code, status)
+	}
+
+	// at the session limit the proxy is alive but can't take another connection.
+	proxy.activeSessions.Add(1)
+	if code, status := getHealth(t, h, "/readyz"); code != http.StatusServiceUnavailable || status.ActiveSessions != 1 {
+		t.Errorf("/readyz when full = %d %+v, want 503 with 1 session", code, status)
+	}
+	if code, _ := getHealth(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz when full = %d, want 200", code)
+	}
+	proxy.activeSessions.Add(-1)
+
+	close(shutdownC)
+	if code, _ := getHealth(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz shutting down = %d, want 503", code)
+	}
+}
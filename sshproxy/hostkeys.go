@@ -0,0 +1,65 @@
+package sshproxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// generatedHostKeyFile is the host key created in an empty host key directory.
+const generatedHostKeyFile = "ssh_host_ed25519_key"
+
+// loadHostKeys reads the ssh_host_*_key files in dir, creating dir with a new ed25519 host key if it holds none,
+// so that the proxy keeps the same identity across restarts.
+func loadHostKeys(dir string) ([]gossh.Signer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "ssh_host_*_key"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		path, err := generateHostKey(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%v failed to generate host key", err)
+		}
+		paths = []string{path}
+	}
+
+	signers := make([]gossh.Signer, 0, len(paths))
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := gossh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("%v failed to parse host key %s", err, path)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+func generateHostKey(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, generatedHostKeyFile)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
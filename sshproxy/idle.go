@@ -0,0 +1,60 @@
+package sshproxy
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// idleTracker records the last time data moved through a proxied channel.
+type idleTracker struct {
+	last atomic.Int64
+}
+
+func newIdleTracker() *idleTracker {
+	t := &idleTracker{}
+	t.touch()
+	return t
+}
+
+// touch marks the channel as active now.
+func (t *idleTracker) touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+// idleFor reports how long the channel has been without traffic as of now.
+func (t *idleTracker) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, t.last.Load()))
+}
+
+// watch calls onIdle once the channel has seen no traffic for timeout, unless stop is closed first.
+func (t *idleTracker) watch(timeout time.Duration, stop <-chan struct{}, onIdle func()) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if t.idleFor(now) >= timeout {
+				onIdle()
+				return
+			}
+		}
+	}
+}
+
+// activityReader touches its tracker whenever data is read through it.
+type activityReader struct {
+	io.Reader
+	tracker *idleTracker
+}
+
+func (r activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.tracker.touch()
+	}
+	return n, err
+}
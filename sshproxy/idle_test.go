@@ -0,0 +1,55 @@
+package sshproxy
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIdleTrackerStalled(t *testing.T) {
+	// nothing is ever written, so the reader stalls.
+	r, w := io.Pipe()
+	defer w.Close()
+	tracker := newIdleTracker()
+	go io.Copy(io.Discard, activityReader{r, tracker})
+
+	idle := make(chan time.Time, 1)
+	start := time.Now()
+	go tracker.watch(100*time.Millisecond, make(chan struct{}), func() { idle <- time.Now() })
+	select {
+	case at := <-idle:
+		if waited := at.Sub(start); waited < 100*time.Millisecond {
+			t.Errorf("went idle after %v, before the timeout", waited)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a stalled channel never went idle")
+	}
+}
+
+func TestIdleTrackerActivity(t *testing.T) {
+	r, w := io.Pipe()
+	tracker := newIdleTracker()
+	go io.Copy(io.Discard, activityReader{r, tracker})
+
+	idle, stop := make(chan struct{}), make(chan struct{})
+	go tracker.watch(100*time.Millisecond, stop, func() { close(idle) })
+	// traffic for several timeouts keeps the channel from going idle.
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("x"))
+		time.Sleep(25 * time.Millisecond)
+		select {
+		case <-idle:
+			t.Fatalf("went idle after %d writes", i+1)
+		default:
+		}
+	}
+	w.Close()
+
+	// stopping the watch means it never reports.
+	close(stop)
+	select {
+	case <-idle:
+		t.Error("went idle after the watch was stopped")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,22 @@
+package sshproxy
+
+import (
+	"net"
+	"time"
+)
+
+// defaultKeepAlivePeriod is how often idle proxy connections are probed unless WithTCPKeepAlive says otherwise.
+const defaultKeepAlivePeriod = 30 * time.Second
+
+// setKeepAlive enables TCP keepalive on conn with period, so that connections to peers that vanished without
+// closing them are eventually reset. Conns that aren't TCP, and a non-positive period, are left alone.
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok || period <= 0 {
+		return nil
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(period)
+}
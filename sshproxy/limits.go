@@ -0,0 +1,84 @@
+package sshproxy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often buckets that have refilled completely are dropped from the limiter.
+const rateLimitPruneInterval = time.Minute
+
+// rateLimiter is a token bucket rate limiter keyed by remote IP.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the bucket for key, reporting false if the bucket is empty.
+func (r *rateLimiter) allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.prune(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * r.rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops buckets that would be full by now, since they are indistinguishable from new ones.
+func (r *rateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	r.lastPrune = now
+
+	for key, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= r.burst {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// remoteIP returns the IP part of addr, or the whole address if it has no port.
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
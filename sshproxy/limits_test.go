@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.allow("192.0.2.1"); got != want {
+			t.Fatalf("attempt %d allowed = %v, want %v", i+1, got, want)
+		}
+	}
+	if !limiter.allow("192.0.2.2") {
+		t.Error("another IP was limited by the first's attempts")
+	}
+
+	now = now.Add(time.Second)
+	if !limiter.allow("192.0.2.1") {
+		t.Error("a token wasn't added after a second")
+	}
+	if limiter.allow("192.0.2.1") {
+		t.Error("more than one token was added after a second")
+	}
+
+	// buckets that have refilled are dropped.
+	now = now.Add(rateLimitPruneInterval)
+	limiter.allow("192.0.2.3")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("%d buckets after pruning, want only the new one", len(limiter.buckets))
+	}
+}
+
+func TestConnectionRateLimitBurst(t *testing.T) {
+	var o options
+	WithConnectionRateLimit(1, 0)(&o)
+	if o.rateLimitBurst != 1 {
+		t.Fatalf("burst = %d, want it raised to 1", o.rateLimitBurst)
+	}
+	if !newRateLimiter(o.rateLimit, o.rateLimitBurst).allow("192.0.2.1") {
+		t.Error("the first connection was refused")
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { <-s.Context().Done() }})
+	dial := func(proxy *SSHProxy) error {
+		client, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+			User:            "ubuntu+" + dest,
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t))},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		if err == nil {
+			t.Cleanup(func() { client.Close() })
+		}
+		return err
+	}
+
+	t.Run("max sessions", func(t *testing.T) {
+		proxy := startProxy(t, 0, 0, nil, WithMaxSessions(1))
+		if err := dial(proxy); err != nil {
+			t.Fatalf("first connection: %v", err)
+		}
+		if err := dial(proxy); err == nil {
+			t.Fatal("a connection over the session limit was accepted")
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		proxy := startProxy(t, 0, 0, nil, WithConnectionRateLimit(0.001, 1))
+		if err := dial(proxy); err != nil {
+			t.Fatalf("first connection: %v", err)
+		}
+		if err := dial(proxy); err == nil {
+			t.Fatal("a connection over the rate limit was accepted")
+		}
+	})
+}
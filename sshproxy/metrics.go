@@ -0,0 +1,66 @@
+package sshproxy
+
+import "expvar"
+
+// Metrics receives observability events from the SSH proxy. Implementations must be safe for concurrent use,
+// as every connection and channel reports from its own goroutine.
+type Metrics interface {
+	// SessionStarted is called when a channel has been coupled to the destination.
+	SessionStarted()
+	// SessionEnded is called when a previously started channel has been torn down.
+	SessionEnded()
+	// BytesIn records bytes copied from the client to the destination.
+	BytesIn(n int64)
+	// BytesOut records bytes copied from the destination to the client.
+	BytesOut(n int64)
+	// AuthFailed is called when a client could not be authenticated against the destination.
+	AuthFailed()
+	// ChannelRejected is called when a channel of the given type is refused.
+	ChannelRejected(channelType string)
+}
+
+// nopMetrics discards every event. It is used when no Metrics are configured.
+type nopMetrics struct{}
+
+func (nopMetrics) SessionStarted()        {}
+func (nopMetrics) SessionEnded()          {}
+func (nopMetrics) BytesIn(int64)          {}
+func (nopMetrics) BytesOut(int64)         {}
+func (nopMetrics) AuthFailed()            {}
+func (nopMetrics) ChannelRejected(string) {}
+
+// ExpvarMetrics is a Metrics implementation backed by expvar, making the counters available on /debug/vars.
+type ExpvarMetrics struct {
+	ActiveSessions    *expvar.Int
+	TotalSessions     *expvar.Int
+	BytesInTotal      *expvar.Int
+	BytesOutTotal     *expvar.Int
+	AuthFailures      *expvar.Int
+	ChannelRejections *expvar.Map
+}
+
+// NewExpvarMetrics publishes the proxy counters under the given prefix, e.g. "tssh_proxy".
+// expvar panics on duplicate names, so it must only be called once per prefix.
+func NewExpvarMetrics(prefix string) *ExpvarMetrics {
+	return &ExpvarMetrics{
+		ActiveSessions:    expvar.NewInt(prefix + "_active_sessions"),
+		TotalSessions:     expvar.NewInt(prefix + "_sessions_total"),
+		BytesInTotal:      expvar.NewInt(prefix + "_bytes_in_total"),
+		BytesOutTotal:     expvar.NewInt(prefix + "_bytes_out_total"),
+		AuthFailures:      expvar.NewInt(prefix + "_auth_failures_total"),
+		ChannelRejections: expvar.NewMap(prefix + "_channel_rejections_total"),
+	}
+}
+
+func (m *ExpvarMetrics) SessionStarted() {
+	m.ActiveSessions.Add(1)
+	m.TotalSessions.Add(1)
+}
+
+func (m *ExpvarMetrics) SessionEnded()    { m.ActiveSessions.Add(-1) }
+func (m *ExpvarMetrics) BytesIn(n int64)  { m.BytesInTotal.Add(n) }
+func (m *ExpvarMetrics) BytesOut(n int64) { m.BytesOutTotal.Add(n) }
+func (m *ExpvarMetrics) AuthFailed()      { m.AuthFailures.Add(1) }
+func (m *ExpvarMetrics) ChannelRejected(channelType string) {
+	m.ChannelRejections.Add(channelType, 1)
+}
@@ -0,0 +1,229 @@
+package sshproxy
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/gliderlabs/ssh"
+)
+
+// Option configures optional behaviour of the SSH proxy. Options are applied in order by New.
+type Option func(*options)
+
+// BannerCallback returns the banner sent to a client before it authenticates. Returning an empty string sends no banner.
+// The banner is requested before any authentication handler has run, so ctx does not carry the user yet.
+type BannerCallback func(ctx ssh.Context) string
+
+type options struct {
+	metrics             Metrics
+	bannerCallback      BannerCallback
+	destinationResolver DestinationResolver
+	tailscaleService    tssh.TailscaleService
+	maxSessions         int
+	rateLimit           float64
+	rateLimitBurst      int
+	channelIdleTimeout  time.Duration
+	preambleReader      PreambleReader
+	logger              *slog.Logger
+	keepAlivePeriod     time.Duration
+	forwardPolicy       ForwardPolicy
+	destinationRules    *ForwardRules
+	recordDir           string
+	passwordAuth        PasswordAuthenticator
+	keyboardAuth        PasswordAuthenticator
+	publicKeyAuth       PublicKeyAuthenticator
+	healthAddr          string
+}
+
+func defaultOptions() options {
+	return options{
+		metrics:             nopMetrics{},
+		destinationResolver: DefaultDestinationResolver,
+		logger:              slog.Default(),
+		keepAlivePeriod:     defaultKeepAlivePeriod,
+	}
+}
+
+// WithMetrics sets the Metrics implementation the proxy reports session, traffic and authentication events to.
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		if metrics != nil {
+			o.metrics = metrics
+		}
+	}
+}
+
+// WithBannerCallback sets the callback used to produce the pre-authentication banner.
+func WithBannerCallback(cb BannerCallback) Option {
+	return func(o *options) {
+		o.bannerCallback = cb
+	}
+}
+
+// BannerFromFile reads the banner text once from path and returns a BannerCallback that serves it to every client.
+func BannerFromFile(path string) (BannerCallback, error) {
+	banner, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := string(banner)
+	return func(ssh.Context) string { return text }, nil
+}
+
+// WithDestinationResolver sets how incoming connections are mapped to the destination SSH server.
+// DefaultDestinationResolver is used when this option is not provided.
+func WithDestinationResolver(resolver DestinationResolver) Option {
+	return func(o *options) {
+		if resolver != nil {
+			o.destinationResolver = resolver
+		}
+	}
+}
+
+// WithTailscaleService makes the proxy look resolved destinations up in the tailnet, by name or Tailscale address,
+// dialing the device's Tailscale address and refusing devices that are unknown or offline. The device list is
+// fetched at most every 30 seconds.
+func WithTailscaleService(ts tssh.TailscaleService) Option {
+	return func(o *options) {
+		o.tailscaleService = ts
+	}
+}
+
+// WithMaxSessions limits how many client connections the proxy serves at once. Zero means no limit.
+func WithMaxSessions(max int) Option {
+	return func(o *options) {
+		o.maxSessions = max
+	}
+}
+
+// WithConnectionRateLimit limits how quickly a single remote IP may open connections, allowing perSecond
+// connections on average with bursts of up to burst. A non-positive rate disables the limit. Bursts below 1 are
+// raised to 1, since a bucket that can't hold a whole token would refuse every connection.
+func WithConnectionRateLimit(perSecond float64, burst int) Option {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(o *options) {
+		o.rateLimit = perSecond
+		o.rateLimitBurst = burst
+	}
+}
+
+// WithChannelIdleTimeout closes a proxied channel after it has carried no data in either direction for timeout.
+// Unlike the server idle timeout, this applies to each channel rather than the whole connection, so an abandoned
+// shell is closed even while other channels on the same connection are busy. Zero disables it.
+func WithChannelIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.channelIdleTimeout = timeout
+	}
+}
+
+// WithPreambleReader makes the proxy read a preamble, such as a load balancer or tunnel header, from every
+// connection before the SSH handshake. Connections with a missing or malformed preamble are dropped, so this
+// must only be enabled when every client connects through something that sends one.
+func WithPreambleReader(read PreambleReader) Option {
+	return func(o *options) {
+		o.preambleReader = read
+	}
+}
+
+// WithProxyProtocol makes the proxy expect a PROXY protocol v1 or v2 header on every connection, as sent by
+// HAProxy and most cloud load balancers, and use the client address it carries for rate limiting and logs.
+// Direct connections without a header are dropped, which is why this is opt-in.
+func WithProxyProtocol() Option {
+	return WithPreambleReader(ProxyProtocolPreamble)
+}
+
+// WithLogger sets the logger the proxy records connections, authentication and errors to. slog.Default is used
+// when this option is not provided.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithTCPKeepAlive sets how often the proxy probes idle client and destination TCP connections, so that half-open
+// connections to peers that went away are reclaimed. It defaults to 30 seconds, and zero disables keepalives.
+func WithTCPKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.keepAlivePeriod = period
+	}
+}
+
+// WithForwardPolicy makes the proxy consult policy before opening each direct-tcpip channel, such as ssh -L and
+// -D forwards, refusing the targets it rejects. Without a policy every target is refused.
+func WithForwardPolicy(policy ForwardPolicy) Option {
+	return func(o *options) {
+		o.forwardPolicy = policy
+	}
+}
+
+// WithForwardRules restricts direct-tcpip forwarding to the targets rules allow. Once rules are set, targets
+// matched by no Allow rule are refused.
+func WithForwardRules(rules ForwardRules) Option {
+	return WithForwardPolicy(rules.Policy())
+}
+
+// WithDestinationRules restricts the destinations the proxy connects clients to, after they are resolved and looked
+// up in the tailnet, to those rules allow. Without a tailnet or routes to pick destinations, the default resolver
+// dials whatever host a client names, and these rules are what keeps the proxy from being an open relay.
+func WithDestinationRules(rules ForwardRules) Option {
+	return func(o *options) {
+		o.destinationRules = &rules
+	}
+}
+
+// WithRecordDir records every proxied session, input and output, to an asciicast file in dir named after the
+// session ID, so shells can be replayed with asciinema play. Recordings contain everything typed, including
+// passwords, so dir should be protected accordingly. An empty dir disables recording, which is the default.
+func WithRecordDir(dir string) Option {
+	return func(o *options) {
+		o.recordDir = dir
+	}
+}
+
+// WithPasswordAuth lets clients authenticate to the proxy with a password, checked by auth, as well as with a
+// public key. Once the password is accepted the proxy connects to the destination just as it does for a key.
+func WithPasswordAuth(auth PasswordAuthenticator) Option {
+	return func(o *options) {
+		o.passwordAuth = auth
+	}
+}
+
+// WithKeyboardInteractiveAuth lets clients authenticate to the proxy with keyboard-interactive authentication, as
+// well as with a public key. The client is asked for a password, which auth checks.
+func WithKeyboardInteractiveAuth(auth PasswordAuthenticator) Option {
+	return func(o *options) {
+		o.keyboardAuth = auth
+	}
+}
+
+// WithPublicKeyAuth makes the proxy check the public key a client offers with auth before connecting to its
+// destination. Without it every key is refused, as the destination may let in whoever the proxy connects as.
+func WithPublicKeyAuth(auth PublicKeyAuthenticator) Option {
+	return func(o *options) {
+		o.publicKeyAuth = auth
+	}
+}
+
+// WithRoutes runs the proxy as a bastion, the only SSH entry point, sending each client to the device its route
+// names rather than one given in the username, and accepting only the public keys its route authorizes.
+func WithRoutes(routes Routes) Option {
+	return func(o *options) {
+		WithDestinationResolver(routes.Resolver())(o)
+		WithPublicKeyAuth(routes)(o)
+	}
+}
+
+// WithHealthCheck serves /healthz and /readyz over HTTP on addr, for load balancers and orchestrators to check the
+// proxy with. Both report the active sessions and uptime as JSON. /healthz returns 200 once the SSH listener is up,
+// and /readyz only while the proxy can take another connection. An empty addr, the default, serves neither.
+func WithHealthCheck(addr string) Option {
+	return func(o *options) {
+		o.healthAddr = addr
+	}
+}
@@ -0,0 +1,58 @@
+package sshproxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// preambleTimeout bounds how long a connection may take to send its preamble before it is dropped.
+const preambleTimeout = 10 * time.Second
+
+// Preamble is the information a fronting load balancer or tunnel sends ahead of the SSH handshake.
+type Preamble struct {
+	// ClientAddr is the address of the original client. Nil means the sender did not know it, in which case
+	// the address of the connection itself is used.
+	ClientAddr net.Addr
+	// Destination is the host:port the client asked to reach. Empty means the DestinationResolver decides.
+	Destination string
+}
+
+// PreambleReader reads and validates a preamble from the start of a connection. Any error terminates the connection.
+type PreambleReader func(r *bufio.Reader) (Preamble, error)
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader, so that bytes read ahead while parsing
+// the preamble are handed to the SSH handshake instead of being lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// readPreamble reads a preamble from conn with read, returning a conn positioned at the start of the SSH handshake.
+func readPreamble(conn net.Conn, read PreambleReader) (net.Conn, Preamble, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(preambleTimeout)); err != nil {
+		return nil, Preamble{}, err
+	}
+
+	r := bufio.NewReader(conn)
+	preamble, err := read(r)
+	if err != nil {
+		return nil, Preamble{}, fmt.Errorf("%v invalid preamble", err)
+	}
+
+	if preamble.Destination != "" {
+		if _, _, err := net.SplitHostPort(preamble.Destination); err != nil {
+			return nil, Preamble{}, fmt.Errorf("%v invalid preamble destination %q", err, preamble.Destination)
+		}
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, Preamble{}, err
+	}
+	return bufferedConn{conn, r}, preamble, nil
+}
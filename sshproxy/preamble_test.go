@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// lineDestination is a PreambleReader for a preamble of a single line naming the destination, with an empty
+// line leaving it to the resolver.
+func lineDestination(r *bufio.Reader) (Preamble, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return Preamble{}, err
+	}
+	return Preamble{Destination: strings.TrimSuffix(line, "\n")}, nil
+}
+
+func TestReadPreamble(t *testing.T) {
+	errBad := errors.New("bad preamble")
+	tests := []struct {
+		name     string
+		sent     string
+		read     PreambleReader
+		wantDest string
+		wantErr  bool
+	}{
+		{name: "destination", sent: "100.64.0.1:22\n", read: lineDestination, wantDest: "100.64.0.1:22"},
+		{name: "no destination", sent: "\n", read: lineDestination},
+		{name: "destination without port", sent: "100.64.0.1\n", read: lineDestination, wantErr: true},
+		{name: "reader error", read: func(*bufio.Reader) (Preamble, error) { return Preamble{}, errBad }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			// the handshake follows straight on, and must reach the SSH server whole.
+			const handshake = "SSH-2.0-OpenSSH_9.0\r\n"
+			go io.WriteString(client, tt.sent+handshake)
+
+			conn, preamble, err := readPreamble(server, tt.read)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readPreamble = %+v, want an error", preamble)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readPreamble: %v", err)
+			}
+			if preamble.Destination != tt.wantDest {
+				t.Errorf("destination = %q, want %q", preamble.Destination, tt.wantDest)
+			}
+			got := make([]byte, len(handshake))
+			if _, err := io.ReadFull(conn, got); err != nil || string(got) != handshake {
+				t.Errorf("read %q, %v after the preamble, want %q", got, err, handshake)
+			}
+		})
+	}
+}
+
+func TestPreambleThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		io.WriteString(s, "reached the destination\n")
+		s.Exit(0)
+	}})
+	proxy := startProxy(t, 0, 0, nil, WithPreambleReader(lineDestination))
+
+	t.Run("valid", func(t *testing.T) {
+		// the destination comes from the preamble rather than the user.
+		client, err := dialWithPreamble(proxy, "ubuntu", dest+"\n", testSigner(t))
+		if err != nil {
+			t.Fatalf("dialling the proxy: %v", err)
+		}
+		defer client.Close()
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatalf("NewSession: %v", err)
+		}
+		defer session.Close()
+		if out, err := session.Output("hostname"); err != nil || string(out) != "reached the destination\n" {
+			t.Errorf("hostname = %q, %v", out, err)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		conn, err := net.Dial("tcp", proxy.ListenAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "not a destination\n")
+		// the proxy hangs up without starting the handshake.
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if b, err := io.ReadAll(conn); err != nil || len(b) != 0 {
+			t.Errorf("read %q, %v, want the connection closed", b, err)
+		}
+	})
+}
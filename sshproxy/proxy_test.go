@@ -0,0 +1,123 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testSigner returns a fresh ed25519 key, quicker to make than the RSA key servers generate without one.
+func testSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startDestination serves srv on a local port for the length of the test, accepting any client, and returns its
+// address.
+func startDestination(t *testing.T, srv *ssh.Server) string {
+	t.Helper()
+	srv.AddHostKey(testSigner(t))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// acceptAnyKey lets every client in with whatever public key it offers.
+var acceptAnyKey = PublicKeyAuthenticatorFunc(func(ssh.Context, ssh.PublicKey) error { return nil })
+
+// startProxy starts a proxy on a local port for the length of the test, logging to logs if it isn't nil. It accepts
+// any public key unless opts say otherwise.
+func startProxy(t *testing.T, idleTimeout, maxTimeout time.Duration, logs *logRecorder, opts ...Option) *SSHProxy {
+	t.Helper()
+	opts = append([]Option{WithPublicKeyAuth(acceptAnyKey)}, opts...)
+	if logs != nil {
+		opts = append(opts, WithLogger(slog.New(logs)))
+	}
+	shutdownC := make(chan struct{})
+	proxy, err := New("test", "127.0.0.1:0", "test", "", shutdownC, idleTimeout, maxTimeout, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.AddHostKey(testSigner(t))
+	collectErrors(proxy)
+	go proxy.Start()
+	t.Cleanup(func() { close(shutdownC) })
+	<-proxy.Ready()
+	return proxy
+}
+
+// dialProxy logs in to proxy as user with a fresh key.
+func dialProxy(t *testing.T, proxy *SSHProxy, user string) *gossh.Client {
+	t.Helper()
+	client, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t))},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("dialling the proxy as %s: %v", user, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// logRecorder is a slog.Handler passing on the close reasons logged as channels close.
+type logRecorder struct {
+	reasons chan CloseReason
+}
+
+func newLogRecorder() *logRecorder {
+	return &logRecorder{reasons: make(chan CloseReason, 16)}
+}
+
+func (l *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (l *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return l }
+func (l *logRecorder) WithGroup(string) slog.Handler            { return l }
+
+func (l *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	if r.Message != "channel closed" {
+		return nil
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "reason" {
+			l.reasons <- CloseReason(a.Value.String())
+		}
+		return true
+	})
+	return nil
+}
+
+// reason waits for the next channel to close and returns why it did.
+func (l *logRecorder) reason(t *testing.T) CloseReason {
+	t.Helper()
+	select {
+	case r := <-l.reasons:
+		return r
+	case <-time.After(10 * time.Second):
+		t.Fatal("no channel closed")
+		return ""
+	}
+}
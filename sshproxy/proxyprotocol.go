@@ -0,0 +1,134 @@
+package sshproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// proxyV1MaxLength is the longest a v1 header line may be, including the trailing CRLF.
+	proxyV1MaxLength = 107
+	proxyV2HeaderLen = 16
+
+	proxyV2CommandLocal = 0x0
+	proxyV2CommandProxy = 0x1
+
+	proxyV2FamilyTCP4 = 0x11
+	proxyV2FamilyTCP6 = 0x21
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrNoProxyHeader is returned when a connection does not start with a PROXY protocol header.
+	ErrNoProxyHeader = errors.New("connection did not start with a PROXY protocol header")
+)
+
+// ProxyProtocolPreamble is a PreambleReader for the HAProxy PROXY protocol, versions 1 and 2. The version is
+// detected from the header signature. LOCAL and UNKNOWN headers, sent by load balancers for their own health
+// checks, are accepted without a client address.
+func ProxyProtocolPreamble(r *bufio.Reader) (Preamble, error) {
+	// a short read leaves sig truncated, which fails both signature checks below.
+	sig, _ := r.Peek(len(proxyV2Signature))
+	switch {
+	case bytes.Equal(sig, proxyV2Signature):
+		return readProxyV2(r)
+	case bytes.HasPrefix(sig, proxyV1Signature):
+		return readProxyV1(r)
+	default:
+		return Preamble{}, ErrNoProxyHeader
+	}
+}
+
+// readProxyV1 parses a text header such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 22\r\n".
+func readProxyV1(r *bufio.Reader) (Preamble, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Preamble{}, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return Preamble{}, fmt.Errorf("proxy v1 header is not terminated within %d bytes", proxyV1MaxLength)
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Preamble{}, nil
+	}
+	if len(fields) != 6 {
+		return Preamble{}, fmt.Errorf("proxy v1 header has %d fields, expected 6", len(fields))
+	}
+
+	proto, srcIP, srcPort := fields[1], net.ParseIP(fields[2]), fields[4]
+	if proto != "TCP4" && proto != "TCP6" {
+		return Preamble{}, fmt.Errorf("proxy v1 header has unsupported protocol %q", proto)
+	}
+	if srcIP == nil || (proto == "TCP4") != (srcIP.To4() != nil) {
+		return Preamble{}, fmt.Errorf("proxy v1 header has invalid %s source address %q", proto, fields[2])
+	}
+	port, err := strconv.ParseUint(srcPort, 10, 16)
+	if err != nil {
+		return Preamble{}, fmt.Errorf("proxy v1 header has invalid source port %q", srcPort)
+	}
+
+	return Preamble{ClientAddr: &net.TCPAddr{IP: srcIP, Port: int(port)}}, nil
+}
+
+// readProxyV2 parses a binary header. Only the source address is used; TLVs are skipped.
+func readProxyV2(r *bufio.Reader) (Preamble, error) {
+	header := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Preamble{}, err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return Preamble{}, fmt.Errorf("proxy v2 header has unsupported version %d", version)
+	}
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Preamble{}, err
+	}
+
+	switch command {
+	case proxyV2CommandLocal:
+		return Preamble{}, nil
+	case proxyV2CommandProxy:
+	default:
+		return Preamble{}, fmt.Errorf("proxy v2 header has unsupported command %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case proxyV2FamilyTCP4:
+		ipLen = net.IPv4len
+	case proxyV2FamilyTCP6:
+		ipLen = net.IPv6len
+	default:
+		// UDP and unix sockets carry no address we can use for a TCP client.
+		return Preamble{}, nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return Preamble{}, fmt.Errorf("proxy v2 header is too short for address family %#x", family)
+	}
+	srcIP := net.IP(payload[:ipLen])
+	srcPort := binary.BigEndian.Uint16(payload[2*ipLen:])
+
+	return Preamble{ClientAddr: &net.TCPAddr{IP: srcIP, Port: int(srcPort)}}, nil
+}
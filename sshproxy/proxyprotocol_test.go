@@ -0,0 +1,157 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// proxyV2Header builds a v2 header with the given version and command, address family and payload.
+func proxyV2Header(versionCommand, family byte, payload []byte) string {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, versionCommand, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return string(append(header, payload...))
+}
+
+// proxyV2Addresses is the payload of a v2 header for a connection from src to dst.
+func proxyV2Addresses(src, dst string, srcPort, dstPort uint16) []byte {
+	srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+	if ip4 := srcIP.To4(); ip4 != nil {
+		srcIP, dstIP = ip4, dstIP.To4()
+	}
+	payload := append(append([]byte{}, srcIP...), dstIP...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, dstPort)
+}
+
+func TestProxyProtocolPreamble(t *testing.T) {
+	tcp4 := proxyV2Addresses("192.0.2.1", "192.0.2.2", 56324, 22)
+	tcp6 := proxyV2Addresses("2001:db8::1", "2001:db8::2", 56324, 22)
+	// a PP2_TYPE_AUTHORITY TLV, which is skipped.
+	withTLV := append(append([]byte{}, tcp4...), 0x02, 0x00, 0x04, 'h', 'o', 's', 't')
+
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 22\r\n", want: "192.0.2.1:56324"},
+		{name: "v1 tcp6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 22\r\n", want: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 unknown with addresses", header: "PROXY UNKNOWN 2001:db8::1 2001:db8::2 56324 22\r\n"},
+		{name: "v1 longest", header: "PROXY TCP6 ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff 65535 65535\r\n", want: "[ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff]:65535"},
+		{name: "v1 without cr", header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 22\n", wantErr: errAny},
+		{name: "v1 too long", header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 22" + strings.Repeat(" ", 100) + "\r\n", wantErr: errAny},
+		{name: "v1 missing fields", header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n", wantErr: errAny},
+		{name: "v1 udp", header: "PROXY UDP4 192.0.2.1 192.0.2.2 56324 22\r\n", wantErr: errAny},
+		{name: "v1 family mismatch", header: "PROXY TCP4 2001:db8::1 2001:db8::2 56324 22\r\n", wantErr: errAny},
+		{name: "v1 bad address", header: "PROXY TCP4 192.0.2 192.0.2.2 56324 22\r\n", wantErr: errAny},
+		{name: "v1 bad port", header: "PROXY TCP4 192.0.2.1 192.0.2.2 65536 22\r\n", wantErr: errAny},
+		{name: "v1 truncated", header: "PROXY TCP4 192.0.2.1", wantErr: io.EOF},
+		{name: "v2 tcp4", header: proxyV2Header(0x21, proxyV2FamilyTCP4, tcp4), want: "192.0.2.1:56324"},
+		{name: "v2 tcp6", header: proxyV2Header(0x21, proxyV2FamilyTCP6, tcp6), want: "[2001:db8::1]:56324"},
+		{name: "v2 tlv", header: proxyV2Header(0x21, proxyV2FamilyTCP4, withTLV), want: "192.0.2.1:56324"},
+		{name: "v2 local", header: proxyV2Header(0x20, 0x00, nil)},
+		{name: "v2 local with addresses", header: proxyV2Header(0x20, proxyV2FamilyTCP4, tcp4)},
+		{name: "v2 unspecified family", header: proxyV2Header(0x21, 0x00, nil)},
+		{name: "v2 unix", header: proxyV2Header(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 version 1", header: proxyV2Header(0x11, proxyV2FamilyTCP4, tcp4), wantErr: errAny},
+		{name: "v2 bad command", header: proxyV2Header(0x22, proxyV2FamilyTCP4, tcp4), wantErr: errAny},
+		{name: "v2 short addresses", header: proxyV2Header(0x21, proxyV2FamilyTCP6, tcp4), wantErr: errAny},
+		{name: "v2 truncated", header: proxyV2Header(0x21, proxyV2FamilyTCP4, tcp4)[:20], wantErr: io.ErrUnexpectedEOF},
+		{name: "none", header: "SSH-2.0-OpenSSH_9.0\r\n", wantErr: ErrNoProxyHeader},
+		{name: "empty", wantErr: ErrNoProxyHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the handshake that follows the header must be left unread.
+			const handshake = "SSH-2.0-OpenSSH_9.0\r\n"
+			r := bufio.NewReader(strings.NewReader(tt.header + handshake))
+			if tt.wantErr != nil {
+				// headers that should fail are sent alone, so the truncated ones really are.
+				r = bufio.NewReader(strings.NewReader(tt.header))
+			}
+
+			preamble, err := ProxyProtocolPreamble(r)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("ProxyProtocolPreamble = %+v, %v, want error %v", preamble, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProxyProtocolPreamble: %v", err)
+			}
+			var got string
+			if preamble.ClientAddr != nil {
+				got = preamble.ClientAddr.String()
+			}
+			if got != tt.want {
+				t.Errorf("client address = %q, want %q", got, tt.want)
+			}
+			if preamble.Destination != "" {
+				t.Errorf("destination = %q, want none", preamble.Destination)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != handshake {
+				t.Errorf("left %q unread, want the handshake", rest)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in tests where the exact error doesn't matter.
+var errAny = errors.New("any error")
+
+func TestProxyProtocolThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { s.Exit(0) }})
+	var mu sync.Mutex
+	var clients []string
+	resolver := func(ctx ssh.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		clients = append(clients, fmt.Sprint(ctx.Value(sshContextClientAddr)))
+		return dest, nil
+	}
+	// every connection comes from 127.0.0.1, so only the header's address can tell them apart.
+	proxy := startProxy(t, 0, 0, nil, WithProxyProtocol(), WithDestinationResolver(resolver), WithConnectionRateLimit(0.001, 1))
+	signer := testSigner(t)
+
+	for _, tt := range []struct {
+		header string
+		ok     bool
+	}{
+		{"PROXY TCP4 192.0.2.1 127.0.0.1 40001 22\r\n", true},
+		{"PROXY TCP4 192.0.2.1 127.0.0.1 40002 22\r\n", false},
+		{"PROXY TCP4 192.0.2.2 127.0.0.1 40003 22\r\n", true},
+		{proxyV2Header(0x21, proxyV2FamilyTCP6, proxyV2Addresses("2001:db8::1", "::1", 40004, 22)), true},
+	} {
+		client, err := dialWithPreamble(proxy, "ubuntu", tt.header, signer)
+		if err == nil {
+			client.Close()
+		}
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("connecting with header %q: %v, want success %v", tt.header, err, tt.ok)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"192.0.2.1:40001", "192.0.2.2:40003", "[2001:db8::1]:40004"}
+	if !slices.Equal(clients, want) {
+		t.Errorf("client addresses = %v, want %v", clients, want)
+	}
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"fmt"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	ptyRequestType          = "pty-req"
+	windowChangeRequestType = "window-change"
+)
+
+// ptyRequest is the payload of a pty-req channel request (RFC 4254 section 6.2).
+type ptyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+// windowChangeRequest is the payload of a window-change channel request (RFC 4254 section 6.7).
+type windowChangeRequest struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+// sessionGate holds back client data on a session channel until the requests that set up the remote
+// terminal and program have been answered by the destination. Without it, keystrokes typed while the
+// pty-req is in flight can reach the destination before the shell exists and get rendered at the wrong size.
+type sessionGate struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+// newSessionGate creates a gate. Channels that never send session requests should pass open as true.
+func newSessionGate(open bool) *sessionGate {
+	g := &sessionGate{c: make(chan struct{})}
+	if open {
+		g.open()
+	}
+	return g
+}
+
+// open releases any data held back by the gate. It is safe to call more than once.
+func (g *sessionGate) open() {
+	g.once.Do(func() { close(g.c) })
+}
+
+// wait returns a channel that is closed once the gate opens.
+func (g *sessionGate) wait() <-chan struct{} {
+	return g.c
+}
+
+// startsSession reports whether a request of the given type starts the program on a session channel.
+func startsSession(reqType string) bool {
+	switch reqType {
+	case "shell", "exec", "subsystem":
+		return true
+	default:
+		return false
+	}
+}
+
+// forwardPtyRequest validates a pty-req and forwards it to the destination, waiting for the reply so the
+// terminal exists before the shell or exec request that follows it.
+func (s *SSHProxy) forwardPtyRequest(remoteChan gossh.Channel, req *gossh.Request, rec *sessionRecording) error {
+	var pty ptyRequest
+	if err := gossh.Unmarshal(req.Payload, &pty); err != nil {
+		if err := req.Reply(false, nil); err != nil {
+			return fmt.Errorf("%v failed to reply to malformed pty request", err)
+		}
+		return nil
+	}
+
+	reply, err := remoteChan.SendRequest(req.Type, true, req.Payload)
+	if err != nil {
+		return fmt.Errorf("%v failed to send pty request for %s %dx%d", err, pty.Term, pty.Columns, pty.Rows)
+	}
+	if err := req.Reply(reply, nil); err != nil {
+		return fmt.Errorf("%v failed to reply to pty request", err)
+	}
+	if reply {
+		rec.setPty(pty.Term, int(pty.Columns), int(pty.Rows))
+	}
+	return nil
+}
+
+// forwardWindowChange forwards a terminal resize to the destination. window-change never wants a reply,
+// so malformed requests are dropped rather than answered.
+func (s *SSHProxy) forwardWindowChange(remoteChan gossh.Channel, req *gossh.Request, rec *sessionRecording) error {
+	var win windowChangeRequest
+	if err := gossh.Unmarshal(req.Payload, &win); err != nil {
+		return nil
+	}
+
+	if _, err := remoteChan.SendRequest(req.Type, false, req.Payload); err != nil {
+		return fmt.Errorf("%v failed to send window change to %dx%d", err, win.Columns, win.Rows)
+	}
+	rec.setPty("", int(win.Columns), int(win.Rows))
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestWindowChangeThroughProxy(t *testing.T) {
+	// the destination prints its terminal's size, first as requested with the pty and then on each resize.
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		pty, winCh, ok := s.Pty()
+		if !ok {
+			fmt.Fprintln(s, "no pty")
+			s.Exit(1)
+			return
+		}
+		fmt.Fprintln(s, pty.Term)
+		for win := range winCh {
+			fmt.Fprintf(s, "%dx%d\n", win.Width, win.Height)
+		}
+	}})
+	proxy := startProxy(t, 0, 0, nil)
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm-256color", 24, 80, gossh.TerminalModes{}); err != nil {
+		t.Fatalf("RequestPty: %v", err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatalf("Shell: %v", err)
+	}
+
+	lines := bufio.NewScanner(stdout)
+	next := func() string {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("destination output ended: %v", lines.Err())
+		}
+		return strings.TrimSpace(lines.Text())
+	}
+	if term := next(); term != "xterm-256color" {
+		t.Errorf("destination terminal = %q, want xterm-256color", term)
+	}
+	if size := next(); size != "80x24" {
+		t.Errorf("initial size = %s, want 80x24", size)
+	}
+	for _, size := range [][2]int{{120, 40}, {60, 20}} {
+		if err := session.WindowChange(size[1], size[0]); err != nil {
+			t.Fatalf("WindowChange: %v", err)
+		}
+		if got, want := next(), fmt.Sprintf("%dx%d", size[0], size[1]); got != want {
+			t.Errorf("size after resizing = %s, want %s", got, want)
+		}
+	}
+}
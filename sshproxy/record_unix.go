@@ -0,0 +1,127 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/acmacalister/tssh/asciicast"
+	"github.com/gliderlabs/ssh"
+)
+
+// defaultRecordWidth and defaultRecordHeight size recordings of sessions that never requested a pty.
+const (
+	defaultRecordWidth  = 80
+	defaultRecordHeight = 24
+)
+
+// sessionRecording records both directions of one proxied session channel. The cast file is only created once the
+// session starts, so that the terminal size from a preceding pty-req makes it into the header.
+type sessionRecording struct {
+	mu       sync.Mutex
+	s        *SSHProxy
+	ctx      ssh.Context
+	term     string
+	width    int
+	height   int
+	recorder *asciicast.Recorder
+}
+
+// newSessionRecording returns a recording for a channel, or nil if recording is disabled or the channel isn't a
+// session. A nil recording can be used and records nothing.
+func (s *SSHProxy) newSessionRecording(channelType string, ctx ssh.Context) *sessionRecording {
+	if s.opts.recordDir == "" || channelType != "session" {
+		return nil
+	}
+	return &sessionRecording{s: s, ctx: ctx, width: defaultRecordWidth, height: defaultRecordHeight}
+}
+
+// setPty notes the terminal requested for the session, or records a resize if the session has started.
+func (r *sessionRecording) setPty(term string, width, height int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term != "" {
+		r.term = term
+	}
+	r.width, r.height = width, height
+	if r.recorder != nil {
+		r.recorder.Resize(width, height)
+	}
+}
+
+// start creates the cast file, named after the session ID and a sequence number as a connection can open several
+// sessions. Failing to record is reported but doesn't stop the session.
+func (r *sessionRecording) start() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recorder != nil {
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s-%d.cast", time.Now().Format("20060102-150405"), SessionID(r.ctx), r.s.recordings.Add(1))
+	path := filepath.Join(r.s.opts.recordDir, name)
+	recorder, err := asciicast.Create(path, asciicast.Header{Width: r.width, Height: r.height, Title: r.ctx.User(), Term: r.term})
+	if err != nil {
+		r.s.reportSessionError(r.ctx, fmt.Errorf("failed to start recording: %v", err))
+		return
+	}
+	r.s.opts.logger.Info("recording session", append(connAttrs(r.ctx), "path", path)...)
+	r.recorder = recorder
+}
+
+// output and input return writers recording the session's output and input. They never fail.
+func (r *sessionRecording) output() io.Writer { return recordingWriter{r, false} }
+func (r *sessionRecording) input() io.Writer  { return recordingWriter{r, true} }
+
+func (r *sessionRecording) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recorder == nil {
+		return
+	}
+	if err := r.recorder.Close(); err != nil {
+		r.s.reportSessionError(r.ctx, fmt.Errorf("failed to write recording %s: %v", r.recorder.Path(), err))
+	}
+	r.recorder = nil
+}
+
+type recordingWriter struct {
+	r     *sessionRecording
+	input bool
+}
+
+func (w recordingWriter) Write(p []byte) (int, error) {
+	w.r.mu.Lock()
+	recorder := w.r.recorder
+	w.r.mu.Unlock()
+	if recorder == nil {
+		return len(p), nil
+	}
+	if w.input {
+		return recorder.Input().Write(p)
+	}
+	return recorder.Write(p)
+}
+
+// ensureRecordDir creates the recording directory when recording is enabled.
+func (s *SSHProxy) ensureRecordDir() error {
+	if s.opts.recordDir == "" {
+		return nil
+	}
+	return os.MkdirAll(s.opts.recordDir, 0o700)
+}
@@ -0,0 +1,45 @@
+package sshproxy
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+)
+
+const (
+	// destinationSeparator separates the login user from the destination host in a proxy username, e.g. "ubuntu+web-1".
+	destinationSeparator = "+"
+	defaultSSHPort       = "22"
+)
+
+var (
+	// ErrNoDestination is returned by the default resolver when the username does not name a destination host.
+	ErrNoDestination = errors.New("username does not contain a destination, expected user+host")
+	// ErrDestinationDenied is returned when the destination rules refuse the destination a connection resolved to.
+	ErrDestinationDenied = errors.New("destination is not allowed")
+)
+
+// DestinationResolver maps an incoming connection to the host:port of the SSH server the proxy should dial.
+type DestinationResolver func(ctx ssh.Context) (string, error)
+
+// DefaultDestinationResolver parses usernames of the form user+host or user+host:port, where host is the
+// Tailscale device to connect to. The port defaults to 22.
+func DefaultDestinationResolver(ctx ssh.Context) (string, error) {
+	_, host, ok := strings.Cut(ctx.User(), destinationSeparator)
+	if !ok || host == "" {
+		return "", ErrNoDestination
+	}
+
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host, nil
+	}
+	return net.JoinHostPort(host, defaultSSHPort), nil
+}
+
+// destinationUser returns the user to log in as on the destination, stripping any +host suffix used for routing.
+func destinationUser(user string) string {
+	login, _, _ := strings.Cut(user, destinationSeparator)
+	return login
+}
@@ -0,0 +1,171 @@
+package sshproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const sshContextRoute = "route"
+
+var (
+	// ErrNoRoute is returned by a Routes resolver when no route matches the username.
+	ErrNoRoute = errors.New("no route for user")
+	// ErrKeyNotAuthorized is returned when a client's key is not in its route's authorized keys.
+	ErrKeyNotAuthorized = errors.New("key is not authorized")
+)
+
+// Route sends clients logging in to the proxy as User to Device, logged in as Login. User is matched as a
+// path.Match pattern, so "*" matches every user, and %u in Device and Login expands to the user the client logged
+// in to the proxy as. Login defaults to that user and Port to 22.
+type Route struct {
+	User   string `yaml:"user"`
+	Device string `yaml:"device"`
+	Login  string `yaml:"login"`
+	Port   int    `yaml:"port"`
+	// AuthorizedKeys is the path of a file in OpenSSH's authorized_keys format holding the public keys clients may
+	// log in with through this route. Routes without one can't be used with a public key.
+	AuthorizedKeys string `yaml:"authorized_keys"`
+
+	keys []ssh.PublicKey
+}
+
+// Routes maps the users clients log in to the proxy as to Tailscale devices, for running the proxy as the only SSH
+// entry point, where clients connect with ssh user@proxy rather than naming a device. The first route whose User
+// matches is used, and users no route matches are refused.
+type Routes []Route
+
+// LoadRoutes reads Routes from the YAML file at path, which holds them as a list under routes, along with the keys
+// in each route's authorized keys file.
+func LoadRoutes(path string) (Routes, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Routes Routes `yaml:"routes"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range file.Routes {
+		if err := file.Routes[i].load(); err != nil {
+			return nil, fmt.Errorf("%s: route %d: %v", path, i+1, err)
+		}
+	}
+	return file.Routes, nil
+}
+
+// load checks the route and reads its authorized keys.
+func (r *Route) load() error {
+	if r.User == "" || r.Device == "" {
+		return errors.New("user and device are required")
+	}
+	if _, err := path.Match(r.User, ""); err != nil {
+		return fmt.Errorf("user %q: %v", r.User, err)
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+	if r.AuthorizedKeys == "" {
+		return nil
+	}
+	keys, err := readAuthorizedKeys(r.AuthorizedKeys)
+	if err != nil {
+		return err
+	}
+	r.keys = keys
+	return nil
+}
+
+// readAuthorizedKeys returns the keys in the authorized_keys file at path. Options before a key are ignored.
+func readAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(b)) > 0 {
+		key, _, _, rest, err := gossh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		keys = append(keys, key)
+		b = rest
+	}
+	return keys, nil
+}
+
+// match returns the first route for user.
+func (rs Routes) match(user string) (Route, bool) {
+	for _, r := range rs {
+		if ok, _ := path.Match(r.User, user); ok {
+			return r, true
+		}
+	}
+	return Route{}, false
+}
+
+// route returns the route for the connection behind ctx, saving it to ctx.
+func (rs Routes) route(ctx ssh.Context) (Route, error) {
+	if r, ok := ctx.Value(sshContextRoute).(Route); ok {
+		return r, nil
+	}
+	r, ok := rs.match(ctx.User())
+	if !ok {
+		return Route{}, fmt.Errorf("%s: %w", ctx.User(), ErrNoRoute)
+	}
+	expand := strings.NewReplacer("%u", ctx.User()).Replace
+	r.Device, r.Login = expand(r.Device), expand(r.Login)
+	if r.Login == "" {
+		r.Login = ctx.User()
+	}
+	ctx.SetValue(sshContextRoute, r)
+	return r, nil
+}
+
+// Resolver returns a DestinationResolver sending each client to its route's device.
+func (rs Routes) Resolver() DestinationResolver {
+	return func(ctx ssh.Context) (string, error) {
+		r, err := rs.route(ctx)
+		if err != nil {
+			return "", err
+		}
+		port := defaultSSHPort
+		if r.Port != 0 {
+			port = strconv.Itoa(r.Port)
+		}
+		return net.JoinHostPort(r.Device, port), nil
+	}
+}
+
+// AuthenticateKey checks that key is one of the authorized keys of the route for the client behind ctx.
+func (rs Routes) AuthenticateKey(ctx ssh.Context, key ssh.PublicKey) error {
+	r, err := rs.route(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range r.keys {
+		if ssh.KeysEqual(k, key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", gossh.FingerprintSHA256(key), ErrKeyNotAuthorized)
+}
+
+// routeLogin returns the user the route for the connection behind ctx logs in to its device as, if it has one.
+func routeLogin(ctx ssh.Context) (string, bool) {
+	r, ok := ctx.Value(sshContextRoute).(Route)
+	return r.Login, ok
+}
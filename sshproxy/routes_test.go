@@ -0,0 +1,96 @@
+package sshproxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T) gossh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRoutes(t *testing.T) {
+	alice, other := testKey(t), testKey(t)
+	keys := writeFile(t, "alice.pub", "# alice's laptop\n"+`no-pty `+string(gossh.MarshalAuthorizedKey(alice)))
+	routes, err := LoadRoutes(writeFile(t, "routes.yaml", `routes:
+  - user: alice
+    device: alice-laptop
+    login: ubuntu
+    port: 2200
+    authorized_keys: `+keys+`
+  - user: "ci-*"
+    device: "%u-runner"
+`))
+	if err != nil {
+		t.Fatalf("LoadRoutes: %v", err)
+	}
+
+	for _, test := range []struct {
+		user, addr, login string
+		err               error
+	}{
+		{user: "alice", addr: "alice-laptop:2200", login: "ubuntu"},
+		{user: "ci-7", addr: "ci-7-runner:22", login: "ci-7"},
+		{user: "bob", err: ErrNoRoute},
+	} {
+		ctx := newTestContext(test.user)
+		addr, err := routes.Resolver()(ctx)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.user, err, test.err)
+		}
+		if addr != test.addr {
+			t.Errorf("%s: addr = %q, want %q", test.user, addr, test.addr)
+		}
+		if login, _ := routeLogin(ctx); login != test.login {
+			t.Errorf("%s: login = %q, want %q", test.user, login, test.login)
+		}
+	}
+
+	if err := routes.AuthenticateKey(newTestContext("alice"), alice); err != nil {
+		t.Errorf("alice's key: %v", err)
+	}
+	if err := routes.AuthenticateKey(newTestContext("alice"), other); !errors.Is(err, ErrKeyNotAuthorized) {
+		t.Errorf("another key = %v, want %v", err, ErrKeyNotAuthorized)
+	}
+	if err := routes.AuthenticateKey(newTestContext("ci-7"), alice); !errors.Is(err, ErrKeyNotAuthorized) {
+		t.Errorf("key on a route without authorized keys = %v, want %v", err, ErrKeyNotAuthorized)
+	}
+}
+
+func TestLoadRoutesInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no device":     "routes:\n  - user: alice\n",
+		"bad pattern":   "routes:\n  - user: \"[\"\n    device: web\n",
+		"bad port":      "routes:\n  - user: alice\n    device: web\n    port: 70000\n",
+		"unknown field": "routes:\n  - user: alice\n    device: web\n    host: web\n",
+		"missing keys":  "routes:\n  - user: alice\n    device: web\n    authorized_keys: /nonexistent\n",
+	} {
+		if _, err := LoadRoutes(writeFile(t, "routes.yaml", content)); err == nil {
+			t.Errorf("%s: LoadRoutes succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package sshproxy
+
+import "github.com/gliderlabs/ssh"
+
+const sshContextSessionID = "sessionID"
+
+// SessionID returns the ID the proxy gave the connection behind ctx when it accepted it, or "" if it has none. The
+// ID is included in the proxy's log lines, errors and recording names for the connection, so they can be matched
+// up with each other.
+func SessionID(ctx ssh.Context) string {
+	id, _ := ctx.Value(sshContextSessionID).(string)
+	return id
+}
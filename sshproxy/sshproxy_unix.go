@@ -4,20 +4,31 @@
 package sshproxy
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/acmacalister/tssh"
 	"github.com/gliderlabs/ssh"
 	gossh "golang.org/x/crypto/ssh"
 )
 
 const (
-	tailscaleDevice     = "tailscaleDevice"
-	sshContextSSHClient = "sshClient"
-	defaultSSHPort      = "22"
+	tailscaleDevice        = "tailscaleDevice"
+	sshContextSSHClient    = "sshClient"
+	sshContextChannelRelay = "channelRelay:"
+	sshContextClientAddr   = "clientAddr"
+	sshContextConnState    = "connState"
+	agentRequestType       = "auth-agent-req@openssh.com"
+	agentChannelType       = "auth-agent@openssh.com"
+	x11RequestType         = "x11-req"
+	x11ChannelType         = "x11"
 )
 
 // sshConn wraps the incoming net.Conn and a cleanup function
@@ -25,6 +36,42 @@ const (
 type sshConn struct {
 	net.Conn
 	cleanupFunc func()
+	state       *connState
+}
+
+// connState is what the proxy tracks of an incoming connection to tell why its channels closed, and its client to
+// the destination. The client is kept here as well as in the context because the connection can be closed from
+// another goroutine, when the server shuts down, and the context isn't safe to read there.
+type connState struct {
+	start time.Time
+	// deadlineHit is set once a read or write fails on the deadline the server sets for its idle and max timeouts.
+	deadlineHit atomic.Bool
+
+	mu     sync.Mutex
+	client *gossh.Client
+	closed bool
+}
+
+// setClient saves the connection's client to the destination, reporting false if the connection has already been
+// closed, in which case the caller has to close the client.
+func (c *connState) setClient(client *gossh.Client) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.client = client
+	return true
+}
+
+// closeClient closes the connection's client to the destination, if it has one yet, and stops one being saved.
+func (c *connState) closeClient() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.client != nil {
+		c.client.Close()
+	}
 }
 
 // close calls the cleanupFunc before closing the conn
@@ -33,20 +80,66 @@ func (c sshConn) Close() error {
 	return c.Conn.Close()
 }
 
+func (c sshConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.checkDeadline(err)
+	return n, err
+}
+
+func (c sshConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.checkDeadline(err)
+	return n, err
+}
+
+// checkDeadline records err if it comes from the connection's deadline passing.
+func (c sshConn) checkDeadline(err error) {
+	if c.state != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		c.state.deadlineHit.Store(true)
+	}
+}
+
 type SSHProxy struct {
 	ssh.Server
-	hostname  string
-	shutdownC chan struct{}
-	caCert    ssh.PublicKey
-	errorChan chan error
+	hostname       string
+	shutdownC      chan struct{}
+	caCert         ssh.PublicKey
+	errorChan      chan error
+	opts           options
+	activeSessions atomic.Int64
+	rateLimiter    *rateLimiter
+	devices        *deviceCache
+	ready          chan struct{}
+	listenAddr     net.Addr
+	healthAddr     net.Addr
+	started        time.Time
+	recordings     atomic.Int64
 }
 
 // New creates a new SSHProxy and configures its host keys and authentication by the data provided
-func New(version, localAddress, hostname, hostKeyDir string, shutdownC chan struct{}, idleTimeout, maxTimeout time.Duration) (*SSHProxy, error) {
+func New(version, localAddress, hostname, hostKeyDir string, shutdownC chan struct{}, idleTimeout, maxTimeout time.Duration, opts ...Option) (*SSHProxy, error) {
 	sshProxy := SSHProxy{
 		hostname:  hostname,
 		shutdownC: shutdownC,
 		errorChan: make(chan error),
+		opts:      defaultOptions(),
+		ready:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(&sshProxy.opts)
+	}
+
+	if err := sshProxy.ensureRecordDir(); err != nil {
+		return nil, fmt.Errorf("%v failed to create recording directory", err)
+	}
+
+	if sshProxy.opts.rateLimit > 0 {
+		sshProxy.rateLimiter = newRateLimiter(sshProxy.opts.rateLimit, sshProxy.opts.rateLimitBurst)
+	}
+
+	if sshProxy.opts.tailscaleService != nil {
+		sshProxy.devices = newDeviceCache(sshProxy.opts.tailscaleService, deviceCacheTTL)
 	}
 
 	sshProxy.Server = ssh.Server{
@@ -61,6 +154,29 @@ func New(version, localAddress, hostname, hostKeyDir string, shutdownC chan stru
 		},
 	}
 
+	if sshProxy.opts.passwordAuth != nil {
+		sshProxy.Server.PasswordHandler = sshProxy.passwordAuthCallback
+	}
+	if sshProxy.opts.keyboardAuth != nil {
+		sshProxy.Server.KeyboardInteractiveHandler = sshProxy.keyboardInteractiveAuthCallback
+	}
+
+	if sshProxy.opts.bannerCallback != nil {
+		sshProxy.Server.ServerConfigCallback = sshProxy.serverConfigCallback
+	}
+
+	// without host keys the server generates a throwaway one on start, which clients will flag as changed
+	// every time the proxy restarts.
+	if hostKeyDir != "" {
+		signers, err := loadHostKeys(hostKeyDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, signer := range signers {
+			sshProxy.Server.AddHostKey(signer)
+		}
+	}
+
 	return &sshProxy, nil
 }
 
@@ -69,11 +185,40 @@ func (s *SSHProxy) Start() error {
 	go func() {
 		<-s.shutdownC
 		if err := s.Close(); err != nil {
-			s.errorChan <- fmt.Errorf("cannot close server: %v", err)
+			s.reportError(fmt.Errorf("cannot close server: %v", err))
 		}
 	}()
 
-	return s.ListenAndServe()
+	addr := s.Addr
+	if addr == "" {
+		addr = ":22"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listenAddr = ln.Addr()
+	s.started = time.Now()
+	if s.opts.healthAddr != "" {
+		if err := s.startHealth(); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	close(s.ready)
+
+	return s.Serve(ln)
+}
+
+// Ready returns a channel that is closed once the proxy's listener is bound and accepting connections.
+func (s *SSHProxy) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ListenAddr returns the address the proxy is listening on. It is only meaningful after Ready has fired,
+// and is mostly useful when the proxy was configured to listen on port 0.
+func (s *SSHProxy) ListenAddr() net.Addr {
+	return s.listenAddr
 }
 
 // Errors return errors from the ssh proxy activities
@@ -81,167 +226,591 @@ func (s *SSHProxy) Errors() <-chan error {
 	return s.errorChan
 }
 
-// proxyAuthCallback attempts to connect to ultimate SSH destination. If successful, it allows the incoming connection
-// to connect to the proxy and saves the outgoing SSH client to the context. Otherwise, no connection to the
-// the proxy is allowed.
+// reportError logs err along with attrs and passes it on to Errors.
+func (s *SSHProxy) reportError(err error, attrs ...any) {
+	s.opts.logger.Error(err.Error(), attrs...)
+	s.errorChan <- err
+}
+
+// reportSessionError reports err with the session ID of the connection behind ctx prefixed, logging it with the
+// connection's attributes.
+func (s *SSHProxy) reportSessionError(ctx ssh.Context, err error) {
+	s.reportError(fmt.Errorf("session %s: %w", SessionID(ctx), err), connAttrs(ctx)...)
+}
+
+// connAttrs returns the log attributes identifying the connection behind ctx.
+func connAttrs(ctx ssh.Context) []any {
+	attrs := []any{"session", SessionID(ctx), "client", ctx.Value(sshContextClientAddr), "user", ctx.User()}
+	if dest, ok := ctx.Value(tailscaleDevice).(string); ok {
+		attrs = append(attrs, "destination", dest)
+	}
+	return attrs
+}
+
+// serverConfigCallback builds the per-connection server config, wiring in the pre-authentication banner.
+func (s *SSHProxy) serverConfigCallback(ctx ssh.Context) *gossh.ServerConfig {
+	return &gossh.ServerConfig{
+		BannerCallback: func(gossh.ConnMetadata) string {
+			return s.opts.bannerCallback(ctx)
+		},
+	}
+}
+
+// proxyAuthCallback checks the client's public key and then attempts to connect to ultimate SSH destination. If
+// successful, it allows the incoming connection to connect to the proxy and saves the outgoing SSH client to the
+// context. Otherwise, no connection to the proxy is allowed. Without a PublicKeyAuthenticator every key is refused.
 func (s *SSHProxy) proxyAuthCallback(ctx ssh.Context, key ssh.PublicKey) bool {
+	err := errNoPublicKeyAuth
+	if s.opts.publicKeyAuth != nil {
+		err = s.opts.publicKeyAuth.AuthenticateKey(ctx, key)
+	}
+	if err != nil {
+		s.opts.metrics.AuthFailed()
+		s.opts.logger.Warn("public key authentication failed", append(connAttrs(ctx), "error", err)...)
+		return false
+	}
+	return s.connectDestination(ctx)
+}
+
+// passwordAuthCallback checks the client's password before connecting to the destination like proxyAuthCallback.
+func (s *SSHProxy) passwordAuthCallback(ctx ssh.Context, password string) bool {
+	if err := s.opts.passwordAuth.Authenticate(ctx, password); err != nil {
+		s.opts.metrics.AuthFailed()
+		s.opts.logger.Warn("password authentication failed", append(connAttrs(ctx), "error", err)...)
+		return false
+	}
+	return s.connectDestination(ctx)
+}
+
+// keyboardInteractiveAuthCallback asks the client for a password and checks it before connecting to the
+// destination like proxyAuthCallback.
+func (s *SSHProxy) keyboardInteractiveAuthCallback(ctx ssh.Context, challenge gossh.KeyboardInteractiveChallenge) bool {
+	answers, err := challenge(ctx.User(), "", []string{"Password: "}, []bool{false})
+	if err == nil && len(answers) != 1 {
+		err = fmt.Errorf("expected 1 answer, got %d", len(answers))
+	}
+	if err == nil {
+		err = s.opts.keyboardAuth.Authenticate(ctx, answers[0])
+	}
+	if err != nil {
+		s.opts.metrics.AuthFailed()
+		s.opts.logger.Warn("keyboard-interactive authentication failed", append(connAttrs(ctx), "error", err)...)
+		return false
+	}
+	return s.connectDestination(ctx)
+}
+
+// connectDestination dials the destination for an authenticated client, saving the client to the context, and
+// reports whether it succeeded.
+func (s *SSHProxy) connectDestination(ctx ssh.Context) bool {
+	// clients may try several keys or methods; the destination only needs to be dialed once per connection.
+	if client, ok := ctx.Value(sshContextSSHClient).(*gossh.Client); ok && client != nil {
+		return true
+	}
+
 	client, err := s.dialDestination(ctx)
 	if err != nil {
+		s.opts.metrics.AuthFailed()
+		s.opts.logger.Warn("authentication failed", append(connAttrs(ctx), "error", err)...)
+		return false
+	}
+	// the connection may have been closed while the destination was dialed, leaving nothing to close the client.
+	if state, ok := ctx.Value(sshContextConnState).(*connState); ok && !state.setClient(client) {
+		client.Close()
 		return false
 	}
 	ctx.SetValue(sshContextSSHClient, client)
+	s.opts.logger.Info("proxying connection", connAttrs(ctx)...)
 	return true
 }
 
-// connCallback reads the preamble sent from the proxy server and saves an audit event logger to the context.
+// connCallback reads the preamble sent from a fronting proxy, if one is configured, and saves the real client address
+// and any requested destination to the context. It then applies the connection limits.
 // If any errors occur, the connection is terminated by returning nil from the callback.
 func (s *SSHProxy) connCallback(ctx ssh.Context, conn net.Conn) net.Conn {
-	// This is a temporary workaround of a timing issue in the tunnel muxer to allow further testing.
-	// TODO: Remove this
-	time.Sleep(10 * time.Millisecond)
+	id := tssh.NewSessionID()
+	ctx.SetValue(sshContextSessionID, id)
+	clientAddr := conn.RemoteAddr()
+	if err := setKeepAlive(conn, s.opts.keepAlivePeriod); err != nil {
+		s.opts.logger.Warn("failed to enable tcp keepalive", "session", id, "client", clientAddr, "error", err)
+	}
+	if s.opts.preambleReader != nil {
+		bufConn, preamble, err := readPreamble(conn, s.opts.preambleReader)
+		if err != nil {
+			s.reportError(fmt.Errorf("session %s: dropping connection from %s: %v", id, conn.RemoteAddr(), err), "session", id, "client", conn.RemoteAddr())
+			return nil
+		}
+		conn = bufConn
+		if preamble.ClientAddr != nil {
+			clientAddr = preamble.ClientAddr
+		}
+		if preamble.Destination != "" {
+			ctx.SetValue(tailscaleDevice, preamble.Destination)
+		}
+	}
+	ctx.SetValue(sshContextClientAddr, clientAddr)
+
+	if s.rateLimiter != nil && !s.rateLimiter.allow(remoteIP(clientAddr)) {
+		s.rejectConn(conn, id, clientAddr, "too many connection attempts, try again later")
+		return nil
+	}
 
-	// TODO: set the tailscale we need to connect to
-	ctx.SetValue(tailscaleDevice, "")
+	if active := s.activeSessions.Add(1); s.opts.maxSessions > 0 && active > int64(s.opts.maxSessions) {
+		s.activeSessions.Add(-1)
+		s.rejectConn(conn, id, clientAddr, fmt.Sprintf("too many concurrent sessions (limit %d)", s.opts.maxSessions))
+		return nil
+	}
 
-	// attempts to retrieve and close the outgoing ssh client when the incoming conn is closed.
+	state := &connState{start: time.Now()}
+	ctx.SetValue(sshContextConnState, state)
+
+	// closes the outgoing ssh client when the incoming conn is closed.
 	// If no client exists, the conn is being closed before the PublicKeyCallback was called (where the client is created).
+	var cleanupOnce sync.Once
 	cleanupFunc := func() {
-		client, ok := ctx.Value(sshContextSSHClient).(*gossh.Client)
-		if ok && client != nil {
-			client.Close()
-		}
+		cleanupOnce.Do(func() {
+			s.activeSessions.Add(-1)
+			state.closeClient()
+		})
 	}
+	return sshConn{conn, cleanupFunc, state}
+}
 
-	return sshConn{conn, cleanupFunc}
+// connCloseReason returns why the connection behind ctx was closed by the server, if its idle or max timeout
+// closed it.
+func (s *SSHProxy) connCloseReason(ctx ssh.Context) (CloseReason, bool) {
+	state, ok := ctx.Value(sshContextConnState).(*connState)
+	if !ok || !state.deadlineHit.Load() {
+		return "", false
+	}
+	if s.MaxTimeout > 0 && time.Since(state.start) >= s.MaxTimeout {
+		return CloseTimeout, true
+	}
+	return CloseIdle, true
+}
+
+// rejectConn tells a client why its connection is being refused before the SSH handshake starts.
+// RFC 4253 allows the server to send lines ahead of its version string, and OpenSSH prints them.
+func (s *SSHProxy) rejectConn(conn net.Conn, id string, clientAddr net.Addr, reason string) {
+	_, _ = fmt.Fprintf(conn, "tssh: %s\r\n", reason)
+	s.reportError(fmt.Errorf("session %s: rejected connection from %s: %s", id, clientAddr, reason), "session", id, "client", clientAddr)
 }
 
 // channelHandler proxies incoming and outgoing SSH traffic back and forth over an SSH Channel
 func (s *SSHProxy) channelHandler(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
-	if newChan.ChannelType() != "session" && newChan.ChannelType() != "direct-tcpip" {
+	switch newChan.ChannelType() {
+	case "session", directTCPIPChannelType, x11ChannelType:
+	default:
+		s.opts.metrics.ChannelRejected(newChan.ChannelType())
 		msg := fmt.Sprintf("channel type %s is not supported", newChan.ChannelType())
 		if err := newChan.Reject(gossh.UnknownChannelType, msg); err != nil {
-			s.errorChan <- fmt.Errorf("error rejecting SSH channel: %v", err)
+			s.reportSessionError(ctx, fmt.Errorf("error rejecting SSH channel: %v", err))
 		}
 		return
 	}
 
-	localChan, localChanReqs, err := newChan.Accept()
-	if err != nil {
-		s.errorChan <- fmt.Errorf("failed to accept session channel: %v", err)
-		return
-	}
-	defer localChan.Close()
-
 	// client will be closed when the sshConn is closed
 	client, ok := ctx.Value(sshContextSSHClient).(*gossh.Client)
 	if !ok {
-		s.errorChan <- fmt.Errorf("could not retrieve client from context")
+		s.reportSessionError(ctx, fmt.Errorf("could not retrieve client from context"))
 		return
 	}
 
-	remoteChan, remoteChanReqs, err := client.OpenChannel(newChan.ChannelType(), newChan.ExtraData())
+	var remoteChan gossh.Channel
+	var remoteChanReqs <-chan *gossh.Request
+	if newChan.ChannelType() == directTCPIPChannelType {
+		if remoteChan, remoteChanReqs, ok = s.openForwardChannel(newChan, client, ctx); !ok {
+			return
+		}
+	}
+
+	localChan, localChanReqs, err := newChan.Accept()
 	if err != nil {
-		s.errorChan <- fmt.Errorf("failed to open remote channel: %v", err)
+		if remoteChan != nil {
+			remoteChan.Close()
+		}
+		s.reportSessionError(ctx, fmt.Errorf("failed to accept session channel: %v", err))
 		return
 	}
+	defer localChan.Close()
+
+	if remoteChan == nil {
+		remoteChan, remoteChanReqs, err = client.OpenChannel(newChan.ChannelType(), newChan.ExtraData())
+		if err != nil {
+			s.reportSessionError(ctx, fmt.Errorf("failed to open remote channel: %v", err))
+			return
+		}
+	}
+	s.opts.logger.Debug("channel opened", append(connAttrs(ctx), "type", newChan.ChannelType())...)
 
 	defer remoteChan.Close()
 
+	s.opts.metrics.SessionStarted()
+	defer s.opts.metrics.SessionEnded()
+
 	// Proxy ssh traffic back and forth between client and destination
-	s.proxyChannel(localChan, remoteChan, localChanReqs, remoteChanReqs, conn, ctx)
+	s.proxyChannel(newChan.ChannelType(), localChan, remoteChan, localChanReqs, remoteChanReqs, conn, ctx)
+}
+
+// openForwardChannel checks a direct-tcpip request against the forward policy and opens the matching channel on
+// the destination, which makes the connection to the target. The request is rejected, rather than accepted and
+// then closed, if the target is refused or can't be reached, so the client sees why.
+func (s *SSHProxy) openForwardChannel(newChan gossh.NewChannel, client *gossh.Client, ctx ssh.Context) (gossh.Channel, <-chan *gossh.Request, bool) {
+	reject := func(reason gossh.RejectionReason, msg string) {
+		s.opts.metrics.ChannelRejected(newChan.ChannelType())
+		if err := newChan.Reject(reason, msg); err != nil {
+			s.reportSessionError(ctx, fmt.Errorf("error rejecting SSH channel: %v", err))
+		}
+	}
+
+	target, err := parseForwardTarget(newChan.ExtraData())
+	if err != nil {
+		reject(gossh.ConnectionFailed, err.Error())
+		return nil, nil, false
+	}
+	policy := s.opts.forwardPolicy
+	if policy == nil {
+		policy = refuseForwarding
+	}
+	if err := policy(ctx, target); err != nil {
+		s.opts.logger.Warn("forwarding denied", append(connAttrs(ctx), "target", target.String(), "error", err)...)
+		reject(gossh.Prohibited, err.Error())
+		return nil, nil, false
+	}
+
+	// open the channel with the target as parsed, so the destination connects exactly where the policy allowed.
+	remoteChan, remoteChanReqs, err := client.OpenChannel(directTCPIPChannelType, gossh.Marshal(&target))
+	if err != nil {
+		reason, msg := gossh.ConnectionFailed, err.Error()
+		var openErr *gossh.OpenChannelError
+		if errors.As(err, &openErr) {
+			reason, msg = openErr.Reason, openErr.Message
+		}
+		reject(reason, msg)
+		return nil, nil, false
+	}
+	s.opts.logger.Debug("forwarding", append(connAttrs(ctx), "target", target.String(), "origin", fmt.Sprintf("%s:%d", target.OriginHost, target.OriginPort))...)
+	return remoteChan, remoteChanReqs, true
 }
 
 // proxyChannel couples two SSH channels and proxies SSH traffic and channel requests back and forth.
-func (s *SSHProxy) proxyChannel(localChan, remoteChan gossh.Channel, localChanReqs, remoteChanReqs <-chan *gossh.Request, conn *gossh.ServerConn, ctx ssh.Context) {
-	done := make(chan struct{}, 2)
-	s.proxyStreams(localChan, remoteChan, done)
-	s.proxyStderrStreams(localChan, remoteChan, done)
-	s.proxyChannelStreams(localChan, remoteChan, localChanReqs, remoteChan, done)
+func (s *SSHProxy) proxyChannel(channelType string, localChan, remoteChan gossh.Channel, localChanReqs, remoteChanReqs <-chan *gossh.Request, conn *gossh.ServerConn, ctx ssh.Context) {
+	// Only session channels carry pty and program requests that must reach the destination before client data.
+	gate := newSessionGate(channelType != "session")
+	tracker := newIdleTracker()
+	closed := &channelClose{}
+	start := time.Now()
+	if s.opts.channelIdleTimeout > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go tracker.watch(s.opts.channelIdleTimeout, stop, func() {
+			closed.set(CloseIdle, nil)
+			localChan.Close()
+			remoteChan.Close()
+		})
+	}
+
+	rec := s.newSessionRecording(channelType, ctx)
+	defer rec.close()
+
+	var input, output sync.WaitGroup
+	s.proxyStreams(localChan, remoteChan, gate, tracker, rec, closed, &input, &output, ctx)
+	s.proxyStderrStreams(localChan, remoteChan, closed, &input, &output, ctx)
+	// neither side can be sent stderr after EOF, so EOF waits for stderr as well as stdout.
+	go func() {
+		output.Wait()
+		localChan.CloseWrite()
+	}()
+	go func() {
+		input.Wait()
+		remoteChan.CloseWrite()
+	}()
+	switch s.proxyChannelStreams(localChan, remoteChan, localChanReqs, remoteChanReqs, gate, rec, closed, conn, ctx) {
+	case CloseRemote:
+		// a destination closes its channel once it has sent everything, which may still be on its way to the
+		// client. Closing the client's channel now would cut off the end of the output.
+		output.Wait()
+	case CloseClient:
+		// likewise a client closing its channel straight after its last write.
+		input.Wait()
+	}
+	s.logChannelClosed(channelType, closed, start, ctx)
+}
+
+// logChannelClosed logs the end of a channel, with why it ended, for auditing. The connection timing out is
+// checked last, as it is only known for certain once the channel has closed.
+func (s *SSHProxy) logChannelClosed(channelType string, closed *channelClose, start time.Time, ctx ssh.Context) {
+	if reason, ok := s.connCloseReason(ctx); ok {
+		closed.set(reason, nil)
+	}
+	reason, err := closed.get()
+	attrs := append(connAttrs(ctx), "type", channelType, "reason", string(reason), "duration", time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	if reason.precedence() > 0 {
+		s.opts.logger.Warn("channel closed", attrs...)
+		return
+	}
+	s.opts.logger.Info("channel closed", attrs...)
 }
 
 // proxyStreams will proxy the main SSH connection between the clients to the connecting
-// tailscale server.
-func (s *SSHProxy) proxyStreams(localChan, remoteChan gossh.Channel, done chan struct{}) {
+// tailscale server. When one side stops sending, EOF is propagated to the other side rather than
+// tearing the channel down, so trailing output and exit statuses still make it through.
+// Client data is held back until the gate opens, and traffic in either direction is reported to tracker and
+// recorded to rec if the session is being recorded. Copies that end in an error rather than EOF are recorded to
+// closed. input and output are done once the client's and the destination's data has all been copied to the other
+// side, after which it is up to the caller to send that side EOF.
+func (s *SSHProxy) proxyStreams(localChan, remoteChan gossh.Channel, gate *sessionGate, tracker *idleTracker, rec *sessionRecording, closed *channelClose, input, output *sync.WaitGroup, ctx ssh.Context) {
+	var remote, local io.Reader = activityReader{remoteChan, tracker}, activityReader{localChan, tracker}
+	if rec != nil {
+		remote, local = io.TeeReader(remote, rec.output()), io.TeeReader(local, rec.input())
+	}
+	output.Add(1)
 	go func() {
-		if _, err := io.Copy(localChan, remoteChan); err != nil {
-			s.errorChan <- fmt.Errorf("remote to local copy error: %v", err)
-		}
-		done <- struct{}{}
+		defer output.Done()
+		n, err := io.Copy(localChan, remote)
+		s.opts.metrics.BytesOut(n)
+		s.copyDone(closed, "remote to local", err, ctx)
 	}()
+	input.Add(1)
 	go func() {
-		if _, err := io.Copy(remoteChan, localChan); err != nil {
-			s.errorChan <- fmt.Errorf("local to remote copy error: %v", err)
-		}
-		done <- struct{}{}
+		defer input.Done()
+		<-gate.wait()
+		n, err := io.Copy(remoteChan, local)
+		s.opts.metrics.BytesIn(n)
+		s.copyDone(closed, "local to remote", err, ctx)
 	}()
 }
 
+// copyDone reports how copying the stream in direction ended, recording an error to closed.
+func (s *SSHProxy) copyDone(closed *channelClose, direction string, err error, ctx ssh.Context) {
+	if err := copyError(err); err != nil {
+		err = fmt.Errorf("%s copy error: %v", direction, err)
+		closed.set(CloseError, err)
+		s.reportSessionError(ctx, err)
+		return
+	}
+	s.opts.logger.Debug("stream ended", append(connAttrs(ctx), "direction", direction)...)
+}
+
 // proxyStderrStreams proxies stderr streams.
-// These streams are non-pty sessions since they have distinct IO streams.
-func (s *SSHProxy) proxyStderrStreams(localChan, remoteChan gossh.Channel, done chan struct{}) {
+// These streams are non-pty sessions since they have distinct IO streams. input and output are done once the
+// client's and the destination's stderr has all been copied to the other side.
+func (s *SSHProxy) proxyStderrStreams(localChan, remoteChan gossh.Channel, closed *channelClose, input, output *sync.WaitGroup, ctx ssh.Context) {
 	remoteStderr := remoteChan.Stderr()
 	localStderr := localChan.Stderr()
+	input.Add(1)
 	go func() {
-		if _, err := io.Copy(remoteStderr, localStderr); err != nil {
-			s.errorChan <- fmt.Errorf("stderr local to remote copy error: %v", err)
-		}
+		defer input.Done()
+		_, err := io.Copy(remoteStderr, localStderr)
+		s.copyDone(closed, "stderr local to remote", err, ctx)
 	}()
+	output.Add(1)
 	go func() {
-		if _, err := io.Copy(localStderr, remoteStderr); err != nil {
-			s.errorChan <- fmt.Errorf("stderr remote to local copy error: %v", err)
-		}
+		defer output.Done()
+		_, err := io.Copy(localStderr, remoteStderr)
+		s.copyDone(closed, "stderr remote to local", err, ctx)
 	}()
 }
 
 // proxyChannelStreams proxies channel requests. SSH forward channel requests are generally out of band
-// to various none PTYs (iirc)
-func (s *SSHProxy) proxyChannelStreams(localChan, remoteChan gossh.Channel, localChanReqs, remoteChanReqs <-chan *gossh.Request, done chan struct{}) {
+// to various none PTYs (iirc). It returns once either side closes its channel, which is the only reliable
+// signal that no more requests (such as exit-status) will follow, recording which side it was to closed. It
+// returns that side, or CloseError if forwarding a request failed.
+func (s *SSHProxy) proxyChannelStreams(localChan, remoteChan gossh.Channel, localChanReqs, remoteChanReqs <-chan *gossh.Request, gate *sessionGate, rec *sessionRecording, closed *channelClose, conn *gossh.ServerConn, ctx ssh.Context) CloseReason {
+	defer gate.open()
+
 	for {
 		select {
 		case req := <-localChanReqs:
 			if req == nil {
-				return
+				closed.set(CloseClient, nil)
+				return CloseClient
+			}
+			if err := s.forwardLocalRequest(remoteChan, req, rec, conn, ctx); err != nil {
+				err = fmt.Errorf("failed to forward request: %v", err)
+				closed.set(CloseError, err)
+				s.reportSessionError(ctx, err)
+				return CloseError
 			}
-			if err := s.forwardChannelRequest(remoteChan, req); err != nil {
-				s.errorChan <- fmt.Errorf("failed to forward request: %v", err)
-				return
+			if startsSession(req.Type) {
+				rec.start()
+				gate.open()
 			}
 
 		case req := <-remoteChanReqs:
 			if req == nil {
-				return
+				closed.set(CloseRemote, nil)
+				return CloseRemote
 			}
 			if err := s.forwardChannelRequest(localChan, req); err != nil {
-				s.errorChan <- fmt.Errorf("failed to forward request: %v", err)
-				return
+				err = fmt.Errorf("failed to forward request: %v", err)
+				closed.set(CloseError, err)
+				s.reportSessionError(ctx, err)
+				return CloseError
 			}
-		case <-done:
-			return
 		}
 	}
 }
 
+// forwardLocalRequest forwards a channel request sent by the client to the destination, handling the
+// request types that need more than a blind pass-through.
+func (s *SSHProxy) forwardLocalRequest(remoteChan gossh.Channel, req *gossh.Request, rec *sessionRecording, conn *gossh.ServerConn, ctx ssh.Context) error {
+	switch req.Type {
+	case "subsystem":
+		return s.forwardSubsystemRequest(remoteChan, req)
+	case ptyRequestType:
+		return s.forwardPtyRequest(remoteChan, req, rec)
+	case windowChangeRequestType:
+		return s.forwardWindowChange(remoteChan, req, rec)
+	case agentRequestType:
+		return s.forwardRelayRequest(remoteChan, req, agentChannelType, conn, ctx)
+	case x11RequestType:
+		return s.forwardRelayRequest(remoteChan, req, x11ChannelType, conn, ctx)
+	default:
+		return s.forwardChannelRequest(remoteChan, req)
+	}
+}
+
+// forwardSubsystemRequest forwards a subsystem request (e.g. sftp) to the destination. A destination refusing
+// the subsystem is reported back to the client as a failed request instead of closing the channel.
+func (s *SSHProxy) forwardSubsystemRequest(remoteChan gossh.Channel, req *gossh.Request) error {
+	var subsystem struct{ Name string }
+	if err := gossh.Unmarshal(req.Payload, &subsystem); err != nil {
+		if err := req.Reply(false, nil); err != nil {
+			return fmt.Errorf("%v failed to reply to malformed subsystem request", err)
+		}
+		return nil
+	}
+
+	reply, err := remoteChan.SendRequest(req.Type, true, req.Payload)
+	if err != nil {
+		return fmt.Errorf("%v failed to start subsystem %q", err, subsystem.Name)
+	}
+	if err := req.Reply(reply, nil); err != nil {
+		return fmt.Errorf("%v failed to reply to subsystem %q request", err, subsystem.Name)
+	}
+	return nil
+}
+
+// forwardRelayRequest forwards a request that asks the destination to open channels of channelType back
+// towards the client, such as agent or X11 forwarding. If the destination accepts it, those channels are relayed
+// to the client.
+func (s *SSHProxy) forwardRelayRequest(remoteChan gossh.Channel, req *gossh.Request, channelType string, conn *gossh.ServerConn, ctx ssh.Context) error {
+	reply, err := remoteChan.SendRequest(req.Type, true, req.Payload)
+	if err != nil {
+		return fmt.Errorf("%v failed to send %s request", err, req.Type)
+	}
+	if reply {
+		s.relayDestinationChannels(channelType, conn, ctx)
+	}
+	if err := req.Reply(reply, nil); err != nil {
+		return fmt.Errorf("%v failed to reply to %s request", err, req.Type)
+	}
+	return nil
+}
+
+// relayDestinationChannels starts relaying channels of channelType opened by the destination to the client.
+// A channel type can only be registered once per outgoing client, so this is a no-op after the first call
+// on a connection, regardless of how many sessions request forwarding.
+func (s *SSHProxy) relayDestinationChannels(channelType string, conn *gossh.ServerConn, ctx ssh.Context) {
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	relayKey := sshContextChannelRelay + channelType
+	if started, _ := ctx.Value(relayKey).(bool); started {
+		return
+	}
+
+	client, ok := ctx.Value(sshContextSSHClient).(*gossh.Client)
+	if !ok {
+		return
+	}
+
+	newChans := client.HandleChannelOpen(channelType)
+	if newChans == nil {
+		return
+	}
+	ctx.SetValue(relayKey, true)
+
+	go func() {
+		for newChan := range newChans {
+			go s.proxyDestinationChannel(newChan, conn, ctx)
+		}
+	}()
+}
+
+// proxyDestinationChannel opens a matching channel to the client and couples it with the one opened by the destination.
+func (s *SSHProxy) proxyDestinationChannel(newChan gossh.NewChannel, conn *gossh.ServerConn, ctx ssh.Context) {
+	localChan, localChanReqs, err := conn.OpenChannel(newChan.ChannelType(), newChan.ExtraData())
+	if err != nil {
+		msg := fmt.Sprintf("client refused %s channel", newChan.ChannelType())
+		if err := newChan.Reject(gossh.ConnectionFailed, msg); err != nil {
+			s.reportSessionError(ctx, fmt.Errorf("error rejecting %s channel: %v", newChan.ChannelType(), err))
+		}
+		return
+	}
+	defer localChan.Close()
+
+	remoteChan, remoteChanReqs, err := newChan.Accept()
+	if err != nil {
+		s.reportSessionError(ctx, fmt.Errorf("failed to accept %s channel: %v", newChan.ChannelType(), err))
+		return
+	}
+	defer remoteChan.Close()
+
+	s.proxyChannel(newChan.ChannelType(), localChan, remoteChan, localChanReqs, remoteChanReqs, conn, ctx)
+}
+
 // dialDestination creates a new SSH client and dials the destination server
 func (s *SSHProxy) dialDestination(ctx ssh.Context) (*gossh.Client, error) {
-	var signer interface{} // := // TODO: Pull signer from client SSH connection
-
+	// a destination sent in the connection preamble takes precedence over the resolver.
+	var err error
 	tailscaleServer, ok := ctx.Value(tailscaleDevice).(string)
-	if !ok && tailscaleServer == "" {
-		return nil, fmt.Errorf("failed to connect to server")
+	if !ok || tailscaleServer == "" {
+		if tailscaleServer, err = s.opts.destinationResolver(ctx); err != nil {
+			return nil, fmt.Errorf("%v failed to resolve destination for %s", err, ctx.User())
+		}
 	}
+	if s.devices != nil {
+		if tailscaleServer, err = tailscaleAddress(s.devices, tailscaleServer); err != nil {
+			return nil, fmt.Errorf("%v failed to find tailscale device", err)
+		}
+	}
+	if s.opts.destinationRules != nil {
+		if err := s.opts.destinationRules.checkDestination(ctx, tailscaleServer); err != nil {
+			return nil, err
+		}
+	}
+	ctx.SetValue(tailscaleDevice, tailscaleServer)
 
+	user := destinationUser(ctx.User())
+	if login, ok := routeLogin(ctx); ok {
+		user = login
+	}
 	clientConfig := &gossh.ClientConfig{
-		User:            ctx.User(),
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),                // TODO: respect host keys?
-		Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)}, // need signer from client.
-		ClientVersion:   ctx.ServerVersion(),
+		User:            user,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // TODO: respect host keys?
+		// TODO: authenticate with a signer pulled from the client connection. Until then only destinations that
+		// accept the "none" method, such as Tailscale SSH, can be reached.
+		ClientVersion: ctx.ServerVersion(),
 	}
 
-	client, err := gossh.Dial("tcp", tailscaleServer, clientConfig)
+	conn, err := net.Dial("tcp", tailscaleServer)
+	if err != nil {
+		return nil, fmt.Errorf("%v failed to connect to destination SSH server", err)
+	}
+	if err := setKeepAlive(conn, s.opts.keepAlivePeriod); err != nil {
+		s.opts.logger.Warn("failed to enable tcp keepalive", append(connAttrs(ctx), "error", err)...)
+	}
+	clientConn, chans, reqs, err := gossh.NewClientConn(conn, tailscaleServer, clientConfig)
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("%v failed to connect to destination SSH server", err)
 	}
-	return client, nil
+	return gossh.NewClient(clientConn, chans, reqs), nil
 }
 
 // forwardChannelRequest sends request req to SSH channel sshChan, waits for reply, and sends the reply back.
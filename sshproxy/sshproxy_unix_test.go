@@ -0,0 +1,618 @@
+//go:build !windows
+// +build !windows
+
+package sshproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testNewChannel is a channel open request from a client, for calling the channel handler outside a server.
+type testNewChannel struct {
+	channelType string
+	extraData   []byte
+	rejected    chan string
+}
+
+func (c testNewChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	panic("channel unexpectedly accepted")
+}
+
+func (c testNewChannel) Reject(reason gossh.RejectionReason, message string) error {
+	c.rejected <- message
+	return nil
+}
+
+func (c testNewChannel) ChannelType() string { return c.channelType }
+func (c testNewChannel) ExtraData() []byte   { return c.extraData }
+
+// collectErrors returns the errors p reports, which must be drained for it to carry on.
+func collectErrors(p *SSHProxy) <-chan error {
+	errs := make(chan error, 16)
+	go func() {
+		for err := range p.Errors() {
+			errs <- err
+		}
+	}()
+	return errs
+}
+
+func TestReportSessionError(t *testing.T) {
+	proxy, err := New("test", "127.0.0.1:0", "test", "", make(chan struct{}), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := collectErrors(proxy)
+
+	// a session channel on a connection whose destination was never dialled can't be proxied.
+	ctx := newTestContext("ubuntu+web-1")
+	ctx.SetValue(sshContextSessionID, "abc123")
+	go proxy.channelHandler(nil, nil, testNewChannel{channelType: "session"}, ctx)
+
+	select {
+	case err := <-errs:
+		if want := "session abc123: could not retrieve client from context"; err.Error() != want {
+			t.Errorf("error = %q, want %q", err, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no session error reported")
+	}
+}
+
+func TestUnsupportedChannelRejected(t *testing.T) {
+	proxy, err := New("test", "127.0.0.1:0", "test", "", make(chan struct{}), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := make(chan string, 1)
+	proxy.channelHandler(nil, nil, testNewChannel{channelType: "tun@openssh.com", rejected: rejected}, newTestContext("ubuntu+web-1"))
+	if msg := <-rejected; !strings.Contains(msg, "not supported") {
+		t.Errorf("rejection = %q, want it to say the type is not supported", msg)
+	}
+}
+
+func TestSSHConnClose(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { <-s.Context().Done() }})
+	proxy, err := New("test", "127.0.0.1:0", "test", "", make(chan struct{}), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectErrors(proxy)
+
+	// accept returns the proxy's conn for a new incoming connection, with its context.
+	accept := func() (*testContext, net.Conn) {
+		local, remote := net.Pipe()
+		t.Cleanup(func() { remote.Close() })
+		ctx := newTestContext("ubuntu+" + dest)
+		return ctx, proxy.connCallback(ctx, local)
+	}
+
+	t.Run("closes the destination client", func(t *testing.T) {
+		ctx, conn := accept()
+		if !proxy.connectDestination(ctx) {
+			t.Fatal("connecting to the destination failed")
+		}
+		client := ctx.Value(sshContextSSHClient).(*gossh.Client)
+		closed := make(chan struct{})
+		go func() {
+			client.Wait()
+			close(closed)
+		}()
+
+		conn.Close()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the destination client is still open")
+		}
+		if n := proxy.activeSessions.Load(); n != 0 {
+			t.Errorf("%d active sessions after closing, want 0", n)
+		}
+	})
+
+	t.Run("before authentication", func(t *testing.T) {
+		ctx, conn := accept()
+		conn.Close()
+		conn.Close()
+		if n := proxy.activeSessions.Load(); n != 0 {
+			t.Errorf("%d active sessions after closing twice, want 0", n)
+		}
+		// a client authenticating as the connection closes mustn't leave a destination client behind.
+		if proxy.connectDestination(ctx) {
+			t.Error("a closed connection connected to the destination")
+		}
+		if _, ok := ctx.Value(sshContextSSHClient).(*gossh.Client); ok {
+			t.Error("a closed connection saved a destination client")
+		}
+	})
+}
+
+func TestForwardingRefusedWithoutPolicy(t *testing.T) {
+	proxy, err := New("test", "127.0.0.1:0", "test", "", make(chan struct{}), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectErrors(proxy)
+
+	target := ForwardTarget{Host: "100.64.0.7", Port: 22, OriginHost: "127.0.0.1", OriginPort: 50000}
+	newChan := testNewChannel{channelType: directTCPIPChannelType, extraData: gossh.Marshal(&target), rejected: make(chan string, 1)}
+	// the channel is refused before the destination client is used.
+	if _, _, ok := proxy.openForwardChannel(newChan, nil, newTestContext("ubuntu")); ok {
+		t.Fatal("a forward was opened with no policy")
+	}
+	if msg := <-newChan.rejected; !strings.Contains(msg, ErrForwardDenied.Error()) {
+		t.Errorf("rejected with %q, want the forward denied", msg)
+	}
+}
+
+func TestDestinationRules(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { s.Exit(0) }})
+	rule := func(r string) ForwardRule {
+		rule, err := ParseForwardRule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rule
+	}
+	_, port, _ := net.SplitHostPort(dest)
+
+	proxy := startProxy(t, 0, 0, nil, WithDestinationRules(ForwardRules{Allow: []ForwardRule{rule("127.0.0.1:" + port)}}))
+	dialProxy(t, proxy, "ubuntu+"+dest)
+
+	proxy = startProxy(t, 0, 0, nil, WithDestinationRules(ForwardRules{Allow: []ForwardRule{rule("100.64.0.0/10")}}))
+	_, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+		User:            "ubuntu+" + dest,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t))},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err == nil {
+		t.Fatal("the proxy connected to a destination outside its rules")
+	}
+
+	ctx := newTestContext("ubuntu")
+	if err := (ForwardRules{Allow: []ForwardRule{rule("100.64.0.0/10")}}).checkDestination(ctx, dest); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("checkDestination(%s) = %v, want ErrDestinationDenied", dest, err)
+	}
+}
+
+func TestSessionThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		switch s.RawCommand() {
+		case "whoami":
+			io.WriteString(s, s.User()+"\n")
+		case "cat":
+			io.Copy(s, s)
+		case "fail":
+			io.WriteString(s, "some output\n")
+			io.WriteString(s.Stderr(), "something went wrong\n")
+			s.Exit(3)
+			return
+		}
+		s.Exit(0)
+	}})
+	proxy := startProxy(t, 0, 0, nil)
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	run := func(command, stdin string) (stdout, stderr string, err error) {
+		t.Helper()
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatalf("NewSession: %v", err)
+		}
+		defer session.Close()
+		var out, errOut bytes.Buffer
+		session.Stdin, session.Stdout, session.Stderr = strings.NewReader(stdin), &out, &errOut
+		err = session.Run(command)
+		return out.String(), errOut.String(), err
+	}
+
+	if stdout, _, err := run("whoami", ""); err != nil || stdout != "ubuntu\n" {
+		t.Errorf("whoami = %q, %v, want the destination user", stdout, err)
+	}
+	// stdin reaches the destination, and its EOF ends the command.
+	if stdout, _, err := run("cat", "hello through the proxy\n"); err != nil || stdout != "hello through the proxy\n" {
+		t.Errorf("cat = %q, %v, want stdin echoed", stdout, err)
+	}
+
+	stdout, stderr, err := run("fail", "")
+	var exitErr *gossh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("fail = %v, want exit status 3", err)
+	}
+	if stdout != "some output\n" || stderr != "something went wrong\n" {
+		t.Errorf("stdout = %q, stderr = %q, want them kept apart", stdout, stderr)
+	}
+
+	// sessions can follow one another on the same connection.
+	if stdout, _, err := run("whoami", ""); err != nil || stdout != "ubuntu\n" {
+		t.Errorf("second whoami = %q, %v", stdout, err)
+	}
+}
+
+func TestUnsupportedChannelThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { s.Exit(0) }})
+	proxy := startProxy(t, 0, 0, nil)
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	_, _, err := client.OpenChannel("tun@openssh.com", nil)
+	var openErr *gossh.OpenChannelError
+	if !errors.As(err, &openErr) || openErr.Reason != gossh.UnknownChannelType {
+		t.Fatalf("OpenChannel = %v, want it rejected as an unknown channel type", err)
+	}
+	// the connection carries on after a rejected channel.
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession after a rejected channel: %v", err)
+	}
+	session.Close()
+}
+
+func TestSubsystemThroughProxy(t *testing.T) {
+	// an echoing subsystem stands in for an SFTP server: the proxy only passes the request and the bytes on.
+	dest := startDestination(t, &ssh.Server{SubsystemHandlers: map[string]ssh.SubsystemHandler{
+		"sftp": func(s ssh.Session) {
+			io.Copy(s, s)
+			s.Exit(0)
+		},
+	}})
+	proxy := startProxy(t, 0, 0, nil)
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a subsystem the destination refuses fails the request but leaves the channel open for another.
+	if err := session.RequestSubsystem("nonexistent"); err == nil {
+		t.Error("RequestSubsystem(nonexistent) succeeded, want it refused")
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		t.Fatalf("RequestSubsystem(sftp): %v", err)
+	}
+	io.WriteString(stdin, "\x00\x00\x00\x05\x01\x00\x00\x00\x03")
+	stdin.Close()
+	got, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatalf("reading the subsystem's output: %v", err)
+	}
+	if string(got) != "\x00\x00\x00\x05\x01\x00\x00\x00\x03" {
+		t.Errorf("subsystem output = %q, want the client's bytes back", got)
+	}
+}
+
+func TestX11ThroughProxy(t *testing.T) {
+	// gliderlabs/ssh refuses x11-req, so the destination handles its sessions itself: once X11 forwarding is
+	// requested, running a command opens an x11 channel back to the client and prints what came over it.
+	type x11Open struct {
+		Addr string
+		Port uint32
+	}
+	open := gossh.Marshal(x11Open{"127.0.0.1", 41234})
+	dest := startDestination(t, &ssh.Server{ChannelHandlers: map[string]ssh.ChannelHandler{
+		"session": func(_ *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, _ ssh.Context) {
+			ch, reqs, err := newChan.Accept()
+			if err != nil {
+				return
+			}
+			defer ch.Close()
+			forwarding := false
+			for req := range reqs {
+				switch req.Type {
+				case x11RequestType:
+					forwarding = true
+					req.Reply(true, nil)
+				case "exec":
+					req.Reply(forwarding, nil)
+					if !forwarding {
+						continue
+					}
+					x11, x11Reqs, err := conn.OpenChannel(x11ChannelType, open)
+					if err != nil {
+						io.WriteString(ch.Stderr(), err.Error())
+						return
+					}
+					go gossh.DiscardRequests(x11Reqs)
+					io.WriteString(x11, "from the destination")
+					x11.CloseWrite()
+					b, _ := io.ReadAll(x11)
+					x11.Close()
+					ch.Write(b)
+					ch.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{0}))
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		},
+	}})
+	proxy := startProxy(t, 0, 0, nil)
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	received := make(chan string, 1)
+	go func() {
+		for newChan := range client.HandleChannelOpen(x11ChannelType) {
+			if !bytes.Equal(newChan.ExtraData(), open) {
+				newChan.Reject(gossh.ConnectionFailed, "unexpected originator")
+				continue
+			}
+			ch, reqs, err := newChan.Accept()
+			if err != nil {
+				continue
+			}
+			go gossh.DiscardRequests(reqs)
+			b, _ := io.ReadAll(ch)
+			received <- string(b)
+			// closing straight after the last write still delivers it.
+			io.WriteString(ch, "from the client")
+			ch.Close()
+		}
+	}()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+	x11Req := gossh.Marshal(struct {
+		SingleConnection bool
+		AuthProtocol     string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}{false, "MIT-MAGIC-COOKIE-1", "0123456789abcdef", 0})
+	if ok, err := session.SendRequest(x11RequestType, true, x11Req); err != nil || !ok {
+		t.Fatalf("x11-req = %v, %v, want it accepted", ok, err)
+	}
+	out, err := session.Output("xclock")
+	if err != nil {
+		t.Fatalf("running a command with X11 forwarding: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got != "from the destination" {
+			t.Errorf("client read %q over the x11 channel", got)
+		}
+	default:
+		t.Error("no x11 channel reached the client")
+	}
+	if string(out) != "from the client" {
+		t.Errorf("destination read %q over the x11 channel", out)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banner")
+	if err := os.WriteFile(path, []byte("Authorized use only.\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := BannerFromFile(path)
+	if err != nil {
+		t.Fatalf("BannerFromFile: %v", err)
+	}
+	if _, err := BannerFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("BannerFromFile(missing) succeeded")
+	}
+
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) { s.Exit(0) }})
+	for _, tt := range []struct {
+		name   string
+		banner BannerCallback
+		want   []string
+	}{
+		{"file", fromFile, []string{"Authorized use only.\n"}},
+		{"empty", func(ssh.Context) string { return "" }, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := startProxy(t, 0, 0, nil, WithBannerCallback(tt.banner))
+			var banners []string
+			client, err := gossh.Dial("tcp", proxy.ListenAddr().String(), &gossh.ClientConfig{
+				User:            "ubuntu+" + dest,
+				Auth:            []gossh.AuthMethod{gossh.PublicKeys(testSigner(t))},
+				HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+				BannerCallback: func(message string) error {
+					banners = append(banners, message)
+					return nil
+				},
+				Timeout: 5 * time.Second,
+			})
+			if err != nil {
+				t.Fatalf("dialling the proxy: %v", err)
+			}
+			client.Close()
+			if !slices.Equal(banners, tt.want) {
+				t.Errorf("banners = %q, want %q", banners, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelIdleTimeoutThroughProxy(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		io.Copy(s, s)
+		s.Exit(0)
+	}})
+	proxy := startProxy(t, 0, 0, nil, WithChannelIdleTimeout(200*time.Millisecond))
+	client := dialProxy(t, proxy, "ubuntu+"+dest)
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("cat"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// a channel carrying data outlives the timeout.
+	buf := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		if _, err := stdin.Write([]byte("x")); err != nil {
+			t.Fatalf("write %d: %v", i+1, err)
+		}
+		if _, err := io.ReadFull(stdout, buf); err != nil {
+			t.Fatalf("read %d: %v", i+1, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// once it stalls it is closed, while the connection carries on.
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("an idle channel was left open")
+	}
+	second, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession after a channel went idle: %v", err)
+	}
+	second.Close()
+}
+
+// preambleConn sends a preamble in the same write as the first bytes of the SSH handshake, as a load balancer
+// forwarding a client's first packet might.
+type preambleConn struct {
+	net.Conn
+	once     sync.Once
+	preamble string
+}
+
+func (c *preambleConn) Write(p []byte) (int, error) {
+	first := false
+	c.once.Do(func() { first = true })
+	if !first {
+		return c.Conn.Write(p)
+	}
+	if _, err := c.Conn.Write(append([]byte(c.preamble), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestRapidConnections(t *testing.T) {
+	dest := startDestination(t, &ssh.Server{Handler: func(s ssh.Session) {
+		io.WriteString(s, s.User()+"\n")
+		s.Exit(0)
+	}})
+	for _, preamble := range []bool{false, true} {
+		name := "direct"
+		var opts []Option
+		if preamble {
+			name, opts = "preamble", []Option{WithPreambleReader(ProxyProtocolPreamble)}
+		}
+		t.Run(name, func(t *testing.T) {
+			proxy := startProxy(t, 0, 0, nil, opts...)
+			signer := testSigner(t)
+			const conns = 50
+			var wg sync.WaitGroup
+			errs := make(chan error, conns)
+			for i := 0; i < conns; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs <- rapidConnection(proxy, dest, signer, preamble, i)
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Error(err)
+				}
+			}
+
+			// every connection is accounted for once it closes.
+			deadline := time.Now().Add(5 * time.Second)
+			for proxy.activeSessions.Load() != 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d sessions still active after every connection closed", proxy.activeSessions.Load())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// rapidConnection connects to proxy, runs a command on dest as the i-th user and disconnects straight away.
+func rapidConnection(proxy *SSHProxy, dest string, signer gossh.Signer, proxyProtocol bool, i int) error {
+	user := fmt.Sprintf("user%d", i)
+	var preamble string
+	if proxyProtocol {
+		preamble = fmt.Sprintf("PROXY TCP4 192.0.2.%d 127.0.0.1 %d 22\r\n", i%250+1, 40000+i)
+	}
+	client, err := dialWithPreamble(proxy, user+"+"+dest, preamble, signer)
+	if err != nil {
+		return fmt.Errorf("%s: %v", user, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("%s: %v", user, err)
+	}
+	defer session.Close()
+	out, err := session.Output("whoami")
+	if err != nil {
+		return fmt.Errorf("%s: %v", user, err)
+	}
+	if string(out) != user+"\n" {
+		return fmt.Errorf("%s: whoami = %q", user, out)
+	}
+	return nil
+}
+
+// dialWithPreamble logs in to proxy as user with signer, sending preamble, if there is one, in the same write as
+// the start of the handshake.
+func dialWithPreamble(proxy *SSHProxy, user, preamble string, signer gossh.Signer) (*gossh.Client, error) {
+	conn, err := net.Dial("tcp", proxy.ListenAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	if preamble != "" {
+		conn = &preambleConn{Conn: conn, preamble: preamble}
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c, chans, reqs, err := gossh.NewClientConn(conn, proxy.ListenAddr().String(), &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return gossh.NewClient(c, chans, reqs), nil
+}
@@ -10,7 +10,7 @@ import (
 
 type SSHServer struct{}
 
-func New(_, _, _, _ string, _ chan struct{}, _, _ time.Duration) (*SSHServer, error) {
+func New(_, _, _, _ string, _ chan struct{}, _, _ time.Duration, _ ...Option) (*SSHServer, error) {
 	return nil, errors.New("ssh proxy is not supported on windows")
 }
 
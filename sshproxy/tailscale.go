@@ -0,0 +1,114 @@
+package sshproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+var (
+	// ErrUnknownDevice is returned when the requested host is not a device in the tailnet.
+	ErrUnknownDevice = errors.New("device is not in the tailnet")
+	// ErrDeviceOffline is returned when the requested device has not been seen recently.
+	ErrDeviceOffline = errors.New("device is offline")
+)
+
+// deviceCacheTTL is how long the tailnet's device list is reused for. Connections arriving together then cost one
+// API call rather than one each, while devices going offline are still noticed well within tssh.OnlineThreshold.
+const deviceCacheTTL = 30 * time.Second
+
+// deviceCache lists the tailnet's devices, fetching them again once the last list is older than ttl.
+type deviceCache struct {
+	mu        sync.Mutex
+	ts        tssh.TailscaleService
+	ttl       time.Duration
+	devices   []tailscale.Device
+	fetchedAt time.Time
+	now       func() time.Time
+}
+
+func newDeviceCache(ts tssh.TailscaleService, ttl time.Duration) *deviceCache {
+	return &deviceCache{ts: ts, ttl: ttl, now: time.Now}
+}
+
+// list returns the tailnet's devices. Callers arriving while they are fetched wait for that fetch rather than
+// making their own.
+func (c *deviceCache) list() ([]tailscale.Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.devices != nil && now.Sub(c.fetchedAt) < c.ttl {
+		return c.devices, nil
+	}
+	devices, err := c.ts.Devices()
+	if err != nil {
+		return nil, err
+	}
+	c.devices, c.fetchedAt = devices, now
+	return devices, nil
+}
+
+// tailscaleAddress resolves the host part of hostport to the Tailscale address of a live device in the tailnet,
+// keeping the port. A host that is one of the device's addresses is dialled as given.
+func tailscaleAddress(cache *deviceCache, hostport string) (string, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", err
+	}
+
+	devices, err := cache.list()
+	if err != nil {
+		return "", fmt.Errorf("%v failed to list tailnet devices", err)
+	}
+
+	device, ok := findDevice(devices, host)
+	if !ok {
+		return "", fmt.Errorf("%s: %w", host, ErrUnknownDevice)
+	}
+	if !tssh.IsOnline(device, time.Now()) {
+		return "", fmt.Errorf("%s last seen %s: %w", host, device.LastSeen.Format(time.RFC3339), ErrDeviceOffline)
+	}
+	if len(device.Addresses) == 0 {
+		return "", fmt.Errorf("%s has no tailscale addresses: %w", host, ErrUnknownDevice)
+	}
+	if hasAddress(device, host) {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	return net.JoinHostPort(device.Addresses[0], port), nil
+}
+
+// findDevice matches host against a device's hostname, its MagicDNS name, the first label of that name, or one of
+// its Tailscale addresses.
+func findDevice(devices []tailscale.Device, host string) (tailscale.Device, bool) {
+	for _, device := range devices {
+		magicDNSHost, _, _ := strings.Cut(device.Name, ".")
+		if strings.EqualFold(device.Hostname, host) || strings.EqualFold(device.Name, host) || strings.EqualFold(magicDNSHost, host) || hasAddress(device, host) {
+			return device, true
+		}
+	}
+	return tailscale.Device{}, false
+}
+
+// hasAddress reports whether host is an IP address that is one of device's Tailscale addresses, however it is
+// written.
+func hasAddress(device tailscale.Device, host string) bool {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	for _, addr := range device.Addresses {
+		if a, err := netip.ParseAddr(addr); err == nil && a == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package sshproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// fakeTailscale lists devices, counting how often it is asked to. Its other methods aren't used by the proxy.
+type fakeTailscale struct {
+	tssh.TailscaleService
+	devices []tailscale.Device
+	calls   int
+}
+
+func (f *fakeTailscale) Devices() ([]tailscale.Device, error) {
+	f.calls++
+	return f.devices, nil
+}
+
+func TestTailscaleAddress(t *testing.T) {
+	now := time.Now()
+	ts := &fakeTailscale{devices: []tailscale.Device{
+		{Hostname: "web-1", Name: "web-1.example.ts.net", Addresses: []string{"100.64.0.7", "fd7a:115c:a1e0::7"}, LastSeen: tailscale.Time{Time: now}},
+		{Hostname: "old", Name: "old.example.ts.net", Addresses: []string{"100.64.0.8"}, LastSeen: tailscale.Time{Time: now.Add(-time.Hour)}},
+	}}
+	cache := newDeviceCache(ts, time.Minute)
+
+	for _, tt := range []struct {
+		hostport string
+		want     string
+		wantErr  error
+	}{
+		{hostport: "web-1:22", want: "100.64.0.7:22"},
+		{hostport: "WEB-1.example.ts.net:2222", want: "100.64.0.7:2222"},
+		{hostport: "100.64.0.7:22", want: "100.64.0.7:22"},
+		// an address is dialled as given, rather than as the device's first address.
+		{hostport: "[fd7a:115c:a1e0::7]:22", want: "[fd7a:115c:a1e0::7]:22"},
+		{hostport: "[fd7a:115c:a1e0:0::7]:22", want: "[fd7a:115c:a1e0:0::7]:22"},
+		{hostport: "db-1:22", wantErr: ErrUnknownDevice},
+		{hostport: "100.64.0.9:22", wantErr: ErrUnknownDevice},
+		{hostport: "old:22", wantErr: ErrDeviceOffline},
+		{hostport: "100.64.0.8:22", wantErr: ErrDeviceOffline},
+	} {
+		got, err := tailscaleAddress(cache, tt.hostport)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("tailscaleAddress(%s) = %q, %v, want %q, %v", tt.hostport, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if ts.calls != 1 {
+		t.Errorf("listed devices %d times, want once", ts.calls)
+	}
+}
+
+func TestDeviceCache(t *testing.T) {
+	ts := &fakeTailscale{devices: []tailscale.Device{{Hostname: "web-1"}}}
+	now := time.Now()
+	cache := newDeviceCache(ts, 30*time.Second)
+	cache.now = func() time.Time { return now }
+
+	list := func(wantCalls int) {
+		t.Helper()
+		devices, err := cache.list()
+		if err != nil || len(devices) != 1 {
+			t.Fatalf("list() = %v, %v", devices, err)
+		}
+		if ts.calls != wantCalls {
+			t.Errorf("listed devices %d times, want %d", ts.calls, wantCalls)
+		}
+	}
+	list(1)
+	now = now.Add(29 * time.Second)
+	list(1)
+	now = now.Add(time.Second)
+	list(2)
+}
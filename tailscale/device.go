@@ -0,0 +1,54 @@
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const deviceURIFmt = "/api/v2/device/%s"
+
+// DeviceByID fetches the device with the given ID, for when only one device is needed and listing them all would
+// be wasteful. IDs, unlike hostnames, never change or collide, which makes them the better reference for scripts to
+// keep. The client library has no call for a single device, so this makes the request itself. Unknown IDs give
+// ErrDeviceNotFound.
+func (s *service) DeviceByID(ctx context.Context, id string) (*tailscale.Device, error) {
+	req, err := s.newRequest(ctx, fmt.Sprintf(deviceURIFmt, url.PathEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	device, err := s.fetchDevice(req, id)
+	if err != nil {
+		return nil, s.logError("device", start, err)
+	}
+	s.logger.Debug("fetched device", "device", id, "hostname", device.Hostname, "duration", time.Since(start))
+	return device, nil
+}
+
+func (s *service) fetchDevice(req *http.Request, id string) (*tailscale.Device, error) {
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, mapError(err, ErrDeviceNotFound)
+	}
+	defer resp.Body.Close()
+
+	// the tailnet isn't part of the URL, so unlike for the other calls a 404 can only be about the device.
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, id)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, statusError(resp, ErrDeviceNotFound)
+	}
+	var device tailscale.Device
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, fmt.Errorf("%v failed to decode device", err)
+	}
+	return &device, nil
+}
@@ -0,0 +1,49 @@
+package tailscale
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// TestRequestsUseBaseURL checks the calls the service makes itself go to its base URL, like the client library's.
+func TestRequestsUseBaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, _, ok := r.BasicAuth(); !ok || key != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v2/device/id-1":
+			w.Write([]byte(`{"id":"id-1","hostname":"web-1"}`))
+		case "/api/v2/tailnet/example.com/devices":
+			w.Write([]byte(`{"devices":[{"id":"id-1","hostname":"web-1"},{"id":"id-2","hostname":"web-2"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	s, err := New("key", "example.com", WithBaseURL(srv.URL), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	device, err := s.DeviceByID(ctx, "id-1")
+	if err != nil || device.Hostname != "web-1" {
+		t.Errorf("DeviceByID(id-1) = %+v, %v, want web-1", device, err)
+	}
+
+	var hostnames []string
+	if err := s.StreamDevices(ctx, func(d tailscale.Device) { hostnames = append(hostnames, d.Hostname) }); err != nil {
+		t.Fatalf("StreamDevices: %v", err)
+	}
+	if len(hostnames) != 2 || hostnames[0] != "web-1" || hostnames[1] != "web-2" {
+		t.Errorf("StreamDevices streamed %v, want web-1 and web-2", hostnames)
+	}
+}
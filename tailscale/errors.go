@@ -0,0 +1,61 @@
+package tailscale
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+var (
+	// ErrUnauthorized is returned when the API key is invalid, expired, or lacks access to the tailnet.
+	ErrUnauthorized = errors.New("tailscale: unauthorized")
+	// ErrTailnetNotFound is returned when the tailnet does not exist or is not visible to the API key.
+	ErrTailnetNotFound = errors.New("tailscale: tailnet not found")
+	// ErrDeviceNotFound is returned when no device in the tailnet has the requested ID.
+	ErrDeviceNotFound = errors.New("tailscale: device not found")
+	// ErrRateLimited is returned when the API is throttling requests.
+	ErrRateLimited = errors.New("tailscale: rate limited")
+	// ErrNetwork is returned when the API could not be reached at all.
+	ErrNetwork = errors.New("tailscale: network error")
+)
+
+// mapError wraps errors from the Tailscale client in one of the package's sentinel errors where the cause is known,
+// keeping the original message. A 404 is wrapped in notFound, since what wasn't found depends on the call: the
+// tailnet for calls under it, the device for calls about a device. Unrecognised errors are returned unchanged.
+func mapError(err, notFound error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr tailscale.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case tailscale.IsNotFound(err):
+			return fmt.Errorf("%w: %v", notFound, err)
+		case hasStatus(apiErr, http.StatusUnauthorized), hasStatus(apiErr, http.StatusForbidden):
+			return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		case hasStatus(apiErr, http.StatusTooManyRequests):
+			return fmt.Errorf("%w: %v", ErrRateLimited, err)
+		}
+		return err
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %v", ErrNetwork, err)
+	}
+
+	return err
+}
+
+// hasStatus reports whether an APIError carries the given HTTP status. The client keeps the status unexported,
+// but always formats it at the end of the error message.
+func hasStatus(apiErr tailscale.APIError, status int) bool {
+	return strings.HasSuffix(apiErr.Error(), fmt.Sprintf("(%d)", status))
+}
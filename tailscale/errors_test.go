@@ -0,0 +1,44 @@
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestNotFoundErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"not found"}`))
+	}))
+	defer srv.Close()
+	s, err := New("key", "example.com", WithBaseURL(srv.URL), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := s.DeviceRoutes(ctx, "bad-id"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("DeviceRoutes of an unknown device: %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := s.DeviceByID(ctx, "bad-id"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("DeviceByID of an unknown device: %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := s.ACL(ctx); !errors.Is(err, ErrTailnetNotFound) {
+		t.Errorf("ACL of an unknown tailnet: %v, want ErrTailnetNotFound", err)
+	}
+	if err := s.StreamDevices(ctx, func(tailscale.Device) {}); !errors.Is(err, ErrTailnetNotFound) {
+		t.Errorf("StreamDevices of an unknown tailnet: %v, want ErrTailnetNotFound", err)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}
+	if err := statusError(resp, ErrDeviceNotFound); !errors.Is(err, ErrDeviceNotFound) || errors.Is(err, ErrTailnetNotFound) {
+		t.Errorf("statusError: %v, want only ErrDeviceNotFound", err)
+	}
+}
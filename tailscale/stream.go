@@ -0,0 +1,120 @@
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const (
+	apiBaseURL     = "https://api.tailscale.com" // the default, see WithBaseURL
+	devicesURIFmt  = "/api/v2/tailnet/%s/devices"
+	maxErrorLength = 1 << 10
+)
+
+// StreamDevices fetches the tailnet's devices like Devices, but decodes the response as it arrives and calls fn
+// for each device in turn, so callers can report progress while a large tailnet loads. The client library only
+// returns the complete list, so this makes the request itself.
+func (s *service) StreamDevices(ctx context.Context, fn func(tailscale.Device)) error {
+	req, err := s.newRequest(ctx, fmt.Sprintf(devicesURIFmt, url.PathEscape(s.tailnet)))
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	count := 0
+	err = s.streamDevices(req, func(device tailscale.Device) {
+		count++
+		fn(device)
+	})
+	if err != nil {
+		return s.logError("stream devices", start, err)
+	}
+	s.logger.Debug("streamed devices", "count", count, "duration", time.Since(start))
+	return nil
+}
+
+func (s *service) streamDevices(req *http.Request, fn func(tailscale.Device)) error {
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return mapError(err, ErrTailnetNotFound)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return statusError(resp, ErrTailnetNotFound)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("%v failed to decode devices", err)
+		}
+		if tok != "devices" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("%v failed to decode devices", err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var device tailscale.Device
+			if err := dec.Decode(&device); err != nil {
+				return fmt.Errorf("%v failed to decode device", err)
+			}
+			fn(device)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("%v failed to decode devices", err)
+	}
+	if tok != want {
+		return fmt.Errorf("failed to decode devices: expected %v, got %v", want, tok)
+	}
+	return nil
+}
+
+// statusError turns an unsuccessful API response into an error, wrapping the same sentinels as mapError, with a 404
+// wrapped in notFound.
+func statusError(resp *http.Response, notFound error) error {
+	var apiErr tailscale.APIError
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	msg := string(body)
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+		msg = apiErr.Message
+	}
+
+	err := fmt.Errorf("%s (%d)", msg, resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %v", notFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %v", ErrRateLimited, err)
+	default:
+		return err
+	}
+}
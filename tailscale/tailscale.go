@@ -2,23 +2,167 @@ package tailscale
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/acmacalister/tssh"
 	"github.com/tailscale/tailscale-client-go/tailscale"
 )
 
-type service struct {
-	client *tailscale.Client
+type (
+	service struct {
+		client *tailscale.Client
+		// baseURL and http make the requests the client library has no call for, like the client makes its own.
+		baseURL string
+		http    *http.Client
+		timeout time.Duration
+		apiKey  string
+		tailnet string
+		logger  *slog.Logger
+	}
+
+	// Option configures optional behaviour of the service.
+	Option func(*service)
+)
+
+// WithLogger sets the logger API calls are recorded to. slog.Default is used when this option is not provided.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *service) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
 }
 
-func New(apiKey, tailnet string) (tssh.TailscaleService, error) {
-	client, err := tailscale.NewClient(apiKey, tailnet)
+// WithBaseURL sends API calls to baseURL in place of the Tailscale API, such as to a test server.
+func WithBaseURL(baseURL string) Option {
+	return func(s *service) {
+		s.baseURL = baseURL
+	}
+}
+
+// WithTimeout bounds calls that don't take a context, such as Devices, to d. Zero means no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(s *service) {
+		s.timeout = d
+	}
+}
+
+func New(apiKey, tailnet string, opts ...Option) (tssh.TailscaleService, error) {
+	// the client library gives its own requests the same one minute timeout.
+	s := &service{
+		baseURL: apiBaseURL,
+		http:    &http.Client{Timeout: time.Minute},
+		apiKey:  apiKey,
+		tailnet: tailnet,
+		logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	client, err := tailscale.NewClient(apiKey, tailnet, tailscale.WithBaseURL(s.baseURL))
 	if err != nil {
-		return nil, err
+		return nil, mapError(err, ErrTailnetNotFound)
 	}
-	return &service{client: client}, nil
+	s.client = client
+	s.logger = s.logger.With("tailnet", tailnet)
+	return s, nil
 }
 
 func (s *service) Devices() ([]tailscale.Device, error) {
-	return s.client.Devices(context.Background())
+	ctx, cancel := s.newContext()
+	defer cancel()
+
+	start := time.Now()
+	devices, err := s.client.Devices(ctx)
+	if err != nil {
+		return nil, s.logError("devices", start, mapError(err, ErrTailnetNotFound))
+	}
+	s.logger.Debug("fetched devices", "count", len(devices), "duration", time.Since(start))
+	return devices, nil
+}
+
+// Ping checks the API key and tailnet by fetching the tailnet's DNS preferences, which is far cheaper than
+// listing devices.
+func (s *service) Ping(ctx context.Context) error {
+	start := time.Now()
+	if _, err := s.client.DNSPreferences(ctx); err != nil {
+		return s.logError("ping", start, mapError(err, ErrTailnetNotFound))
+	}
+	s.logger.Debug("ping succeeded", "duration", time.Since(start))
+	return nil
+}
+
+func (s *service) OnlineDevices(ctx context.Context) ([]tailscale.Device, error) {
+	start := time.Now()
+	devices, err := s.client.Devices(ctx)
+	if err != nil {
+		return nil, s.logError("online devices", start, mapError(err, ErrTailnetNotFound))
+	}
+
+	now := time.Now()
+	online := make([]tailscale.Device, 0, len(devices))
+	for _, device := range devices {
+		if tssh.IsOnline(device, now) {
+			online = append(online, device)
+		}
+	}
+	return online, nil
+}
+
+func (s *service) DeviceRoutes(ctx context.Context, id string) (*tailscale.DeviceRoutes, error) {
+	start := time.Now()
+	routes, err := s.client.DeviceSubnetRoutes(ctx, id)
+	if err != nil {
+		return nil, s.logError("device routes", start, mapError(err, ErrDeviceNotFound))
+	}
+	s.logger.Debug("fetched device routes", "device", id, "advertised", len(routes.Advertised), "duration", time.Since(start))
+	return routes, nil
+}
+
+func (s *service) ACL(ctx context.Context) (*tailscale.ACL, error) {
+	start := time.Now()
+	acl, err := s.client.ACL(ctx)
+	if err != nil {
+		return nil, s.logError("acl", start, mapError(err, ErrTailnetNotFound))
+	}
+	s.logger.Debug("fetched acl", "rules", len(acl.ACLs), "ssh_rules", len(acl.SSH), "duration", time.Since(start))
+	return acl, nil
+}
+
+// newRequest builds a GET request for the API's uri, made the way the client library makes its own.
+func (s *service) newRequest(ctx context.Context, uri string) (*http.Request, error) {
+	base, err := url.Parse(s.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%v failed to parse API URL", err)
+	}
+	u, err := base.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(s.apiKey, "")
+	return req, nil
+}
+
+// logError records a failed API call and returns err.
+func (s *service) logError(call string, start time.Time, err error) error {
+	s.logger.Error("tailscale API call failed", "call", call, "duration", time.Since(start), "error", err)
+	return err
+}
+
+// newContext returns a context bounded by the service timeout, if one is set.
+func (s *service) newContext() (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(context.Background(), s.timeout)
+	}
+	return context.WithCancel(context.Background())
 }
@@ -1,6 +1,16 @@
 package tssh
 
-import "github.com/tailscale/tailscale-client-go/tailscale"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
 
 type Action int
 
@@ -8,8 +18,107 @@ const (
 	ActionNone Action = iota
 	ActionSSH
 	ActionDeviceSSH
+	ActionSwitchTailnet
+	ActionSelectProfile
+	ActionTestConnection
+	ActionShell
+	ActionFileTransfer
+	ActionPortForward
+	ActionDeviceDetail
+	ActionCopyAddress
+	ActionCommandResult
+	ActionIdentity
+	ActionSelectIdentity
+	ActionUser
+	ActionSelectUser
+	ActionOtherUser
+	ActionAdmin
+	ActionRunAdmin
+	ActionToggleGroup
 )
 
 type TailscaleService interface {
 	Devices() ([]tailscale.Device, error)
+	// Ping makes a cheap authenticated call to check the API key and tailnet are usable.
+	Ping(ctx context.Context) error
+	// OnlineDevices returns only the devices that are currently connected to the tailnet, see IsOnline.
+	OnlineDevices(ctx context.Context) ([]tailscale.Device, error)
+	// StreamDevices calls fn for each device as it is received, for reporting progress on large tailnets.
+	StreamDevices(ctx context.Context, fn func(tailscale.Device)) error
+	// DeviceRoutes returns the subnet routes the device with the given ID advertises and those enabled for it.
+	DeviceRoutes(ctx context.Context, id string) (*tailscale.DeviceRoutes, error)
+	// ACL returns the tailnet's policy file. API keys without access to it get an error.
+	ACL(ctx context.Context) (*tailscale.ACL, error)
+	// DeviceByID returns the device with the given ID, which unlike its hostname never changes, without listing every
+	// device. Implementations report IDs no device has with a not found error of their own.
+	DeviceByID(ctx context.Context, id string) (*tailscale.Device, error)
+}
+
+// OnlineThreshold is how recently a device must have been seen by the control plane to be considered online.
+const OnlineThreshold = 5 * time.Minute
+
+// IsOnline reports whether device was last seen no more than OnlineThreshold before now.
+// Devices that have never been seen are offline.
+func IsOnline(device tailscale.Device, now time.Time) bool {
+	if device.LastSeen.IsZero() {
+		return false
+	}
+	return now.Sub(device.LastSeen.Time) <= OnlineThreshold
+}
+
+// TagFilter selects devices by their tags. A device matches if it has any of the included tags, or there are
+// none, and none of the excluded tags.
+type TagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseTagFilter parses a comma separated tag filter expression such as "tag:prod,tag:staging,-tag:deprecated",
+// where tags prefixed with - are excluded. The empty expression matches every device.
+func ParseTagFilter(expr string) (TagFilter, error) {
+	var f TagFilter
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		tag, exclude := strings.CutPrefix(term, "-")
+		if tag == "" {
+			return TagFilter{}, fmt.Errorf("tag filter %q has an empty tag", expr)
+		}
+		if exclude {
+			f.Exclude = append(f.Exclude, tag)
+		} else {
+			f.Include = append(f.Include, tag)
+		}
+	}
+	return f, nil
+}
+
+// Matches reports whether device has one of f's included tags, if it has any, and none of its excluded tags.
+func (f TagFilter) Matches(device tailscale.Device) bool {
+	for _, tag := range f.Exclude {
+		if slices.Contains(device.Tags, tag) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, tag := range f.Include {
+		if slices.Contains(device.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSessionID returns a random ID for an SSH session, short enough to read out of a log line. The client and the
+// proxy share it so the IDs in their logs look alike.
+func NewSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
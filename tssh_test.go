@@ -0,0 +1,94 @@
+package tssh
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestIsOnline(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name     string
+		lastSeen time.Time
+		want     bool
+	}{
+		{name: "never seen", want: false},
+		{name: "just seen", lastSeen: now, want: true},
+		{name: "inside threshold", lastSeen: now.Add(-OnlineThreshold + time.Second), want: true},
+		{name: "at threshold", lastSeen: now.Add(-OnlineThreshold), want: true},
+		{name: "past threshold", lastSeen: now.Add(-OnlineThreshold - time.Nanosecond), want: false},
+		{name: "long ago", lastSeen: now.Add(-24 * time.Hour), want: false},
+		{name: "clock skew", lastSeen: now.Add(time.Minute), want: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			device := tailscale.Device{LastSeen: tailscale.Time{Time: test.lastSeen}}
+			if got := IsOnline(device, now); got != test.want {
+				t.Errorf("IsOnline(last seen %v) = %v, want %v", test.lastSeen, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	for _, test := range []struct {
+		expr    string
+		include []string
+		exclude []string
+		ok      bool
+	}{
+		{expr: "", ok: true},
+		{expr: "  ", ok: true},
+		{expr: "tag:prod", include: []string{"tag:prod"}, ok: true},
+		{expr: "tag:prod, tag:staging", include: []string{"tag:prod", "tag:staging"}, ok: true},
+		{expr: "-tag:deprecated", exclude: []string{"tag:deprecated"}, ok: true},
+		{expr: "tag:prod,-tag:deprecated", include: []string{"tag:prod"}, exclude: []string{"tag:deprecated"}, ok: true},
+		{expr: "tag:prod,,tag:staging"},
+		{expr: "tag:prod,-"},
+		{expr: "tag:prod,"},
+	} {
+		f, err := ParseTagFilter(test.expr)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseTagFilter(%q) = %v, want ok %v", test.expr, err, test.ok)
+			continue
+		}
+		if !slices.Equal(f.Include, test.include) || !slices.Equal(f.Exclude, test.exclude) {
+			t.Errorf("ParseTagFilter(%q) = %+v, want include %v and exclude %v", test.expr, f, test.include, test.exclude)
+		}
+	}
+}
+
+func TestTagFilterMatches(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		tags []string
+		want bool
+	}{
+		{expr: "", tags: nil, want: true},
+		{expr: "", tags: []string{"tag:prod"}, want: true},
+		{expr: "tag:prod", tags: nil, want: false},
+		{expr: "tag:prod", tags: []string{"tag:prod"}, want: true},
+		{expr: "tag:prod", tags: []string{"tag:staging"}, want: false},
+		{expr: "tag:prod,tag:staging", tags: []string{"tag:staging"}, want: true},
+		{expr: "tag:prod,tag:staging", tags: []string{"tag:staging", "tag:prod"}, want: true},
+		{expr: "-tag:deprecated", tags: nil, want: true},
+		{expr: "-tag:deprecated", tags: []string{"tag:prod", "tag:deprecated"}, want: false},
+		{expr: "tag:prod,-tag:deprecated", tags: []string{"tag:prod"}, want: true},
+		{expr: "tag:prod,-tag:deprecated", tags: []string{"tag:prod", "tag:deprecated"}, want: false},
+		{expr: "tag:prod,-tag:deprecated", tags: []string{"tag:deprecated"}, want: false},
+		{expr: "tag:prod,tag:staging,-tag:deprecated,-tag:broken", tags: []string{"tag:staging", "tag:broken"}, want: false},
+		{expr: "tag:prod,tag:staging,-tag:deprecated,-tag:broken", tags: []string{"tag:staging", "tag:web"}, want: true},
+		// a tag both included and excluded is excluded.
+		{expr: "tag:prod,-tag:prod", tags: []string{"tag:prod"}, want: false},
+	} {
+		f, err := ParseTagFilter(test.expr)
+		if err != nil {
+			t.Fatalf("ParseTagFilter(%q): %v", test.expr, err)
+		}
+		if got := f.Matches(tailscale.Device{Tags: test.tags}); got != test.want {
+			t.Errorf("%q matches %v = %v, want %v", test.expr, test.tags, got, test.want)
+		}
+	}
+}
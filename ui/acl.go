@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const sshPort = 22
+
+type (
+	// aclFetched is sent once the tailnet's policy file has been fetched.
+	aclFetched struct {
+		acl *tailscale.ACL
+		err error
+	}
+
+	// accessWarning holds a connection held back because the ACL doesn't look like it allows it, or the SSH
+	// certificate to log in with isn't valid.
+	accessWarning struct {
+		hostname string
+		reason   string
+		connect  func() tea.Cmd
+		back     state
+	}
+)
+
+// fetchACL returns a command that fetches the tailnet's policy file, for checking devices can be reached before
+// connecting to them.
+func (m *mainModel) fetchACL() tea.Cmd {
+	ts, timeout := m.ts, m.cfg.APITimeout
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		acl, err := ts.ACL(ctx)
+		return aclFetched{acl: acl, err: err}
+	}
+}
+
+func (m *mainModel) handleACLFetched(msg aclFetched) (*mainModel, tea.Cmd) {
+	if msg.err != nil {
+		// plenty of API keys can't read the policy file, which only means connections go unchecked.
+		m.logger.Debug("fetching acl failed, connections won't be checked against it", "error", msg.err)
+		return m, nil
+	}
+	m.acl = msg.acl
+	return m, nil
+}
+
+// checkAccess runs connect straight away if hostname looks reachable over SSH under the tailnet's ACL, or if that
+// can't be told, and any SSH certificate to log in with is valid. Otherwise it warns why the connection will
+// probably be refused and lets the user go ahead anyway or go back to back.
+func (m *mainModel) checkAccess(hostname string, back state, connect func() tea.Cmd) (*mainModel, tea.Cmd) {
+	if reason := m.certificateWarning(hostname); reason != "" {
+		m.logger.Warn("no valid certificate", "host", hostname, "reason", reason)
+		m.access = accessWarning{hostname: hostname, reason: reason, connect: connect, back: back}
+		m.state = stateAccessWarning
+		return m, nil
+	}
+	for _, device := range m.devices {
+		if device.Hostname != hostname || m.acl == nil {
+			continue
+		}
+		if ok, reason := sshAllowed(m.acl, device); !ok {
+			m.logger.Warn("connection not expected to be allowed", "host", hostname, "reason", reason)
+			m.access = accessWarning{hostname: hostname, reason: reason, connect: connect, back: back}
+			m.state = stateAccessWarning
+			return m, nil
+		}
+		break
+	}
+	m.state = stateDevice
+	return m, connect()
+}
+
+func (m *mainModel) handleAccessWarningKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Choose):
+		m.state = stateDevice
+		return m, m.access.connect()
+	case key.Matches(msg, m.keys.Back):
+		m.state = m.access.back
+	}
+	return m, nil
+}
+
+func (m mainModel) accessWarningView() string {
+	choose, back := m.keys.Choose.Help(), m.keys.Back.Help()
+	footer := fmt.Sprintf("%s connect anyway • %s back", choose.Key, back.Key)
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left,
+		m.textStyle("⚠ "+m.access.reason),
+		lipgloss.NewStyle().Foreground(m.theme.Muted).Render("Connecting to "+m.access.hostname+" will probably be refused."),
+		"",
+		lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(footer)))
+}
+
+// sshAllowed reports whether an accept rule in acl lets connections reach device's SSH port, which Tailscale SSH
+// needs as much as OpenSSH does. The connection's source isn't known, so this only catches devices no rule lets
+// anyone reach, and rules are matched generously. Policies without any acls, such as those written entirely with
+// grants, can't be checked and are taken to allow everything.
+func sshAllowed(acl *tailscale.ACL, device tailscale.Device) (bool, string) {
+	if len(acl.ACLs) == 0 {
+		return true, ""
+	}
+	for _, rule := range acl.ACLs {
+		if rule.Action != "accept" || (rule.Protocol != "" && rule.Protocol != "tcp" && rule.Protocol != "6") {
+			continue
+		}
+		for _, dst := range rule.Destination {
+			i := strings.LastIndex(dst, ":")
+			if i < 0 {
+				continue
+			}
+			if matchesHost(acl, dst[:i], device) && portsInclude(dst[i+1:], sshPort) {
+				return true, ""
+			}
+		}
+	}
+	return false, fmt.Sprintf("No ACL rule allows connections to port %d on %s", sshPort, device.Hostname)
+}
+
+// matchesHost reports whether the host part of an ACL destination could include device. Devices are owned either
+// by their tags or, when untagged, by their user.
+func matchesHost(acl *tailscale.ACL, host string, device tailscale.Device) bool {
+	tagged := len(device.Tags) > 0
+	switch {
+	case host == "*":
+		return true
+	case strings.HasPrefix(host, "tag:"):
+		return slices.Contains(device.Tags, host)
+	case host == "autogroup:tagged":
+		return tagged
+	case strings.HasPrefix(host, "autogroup:"):
+		// autogroup:member, autogroup:self and the role based autogroups all refer to users' devices.
+		return !tagged
+	case strings.HasPrefix(host, "group:"):
+		return !tagged && slices.Contains(acl.Groups[host], device.User)
+	case strings.Contains(host, "@"):
+		return !tagged && host == device.User
+	}
+	if alias, ok := acl.Hosts[host]; ok {
+		host = alias
+	}
+	prefix, err := netip.ParsePrefix(host)
+	if err != nil {
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return false
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	for _, address := range device.Addresses {
+		if addr, err := netip.ParseAddr(address); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// portsInclude reports whether the port part of an ACL destination, such as *, 22, 80,443 or 1000-2000, covers port.
+func portsInclude(ports string, port int) bool {
+	for _, p := range strings.Split(ports, ",") {
+		if p == "*" {
+			return true
+		}
+		low, high, isRange := strings.Cut(p, "-")
+		if !isRange {
+			high = low
+		}
+		l, errLow := strconv.Atoi(low)
+		h, errHigh := strconv.Atoi(high)
+		if errLow == nil && errHigh == nil && l <= port && port <= h {
+			return true
+		}
+	}
+	return false
+}
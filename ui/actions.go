@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"github.com/acmacalister/tssh"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openDeviceMenu shows what can be done with the device behind item.
+func (m *mainModel) openDeviceMenu(item components.ListItem) (*mainModel, tea.Cmd) {
+	m.actionHost = item.Name
+	items := []components.ListItem{
+		{Name: "Shell", Info: "Open an interactive session", Action: tssh.ActionShell},
+		{Name: "Shell as user", Info: "Pick the user to log in as", Action: tssh.ActionUser},
+		{Name: "Shell with key", Info: "Pick the identity file to log in with", Action: tssh.ActionIdentity},
+		{Name: "File transfer", Info: "Browse files with sftp", Action: tssh.ActionFileTransfer},
+		{Name: "Port forward", Info: "Forward a local port to the device", Action: tssh.ActionPortForward},
+	}
+	if len(m.cfg.AdminCommands) > 0 {
+		items = append(items, components.ListItem{Name: "Admin", Info: "Run one of the configured admin commands", Action: tssh.ActionAdmin})
+	}
+	items = append(items,
+		components.ListItem{Name: "Detail", Info: "Show the device's details", Action: tssh.ActionDeviceDetail},
+		components.ListItem{Name: "Copy IP", Info: "Copy the device's Tailscale address", Action: tssh.ActionCopyAddress},
+	)
+	m.actionMenu = components.NewList(item.Name, m.theme, m.keys, items...)
+	m.actionMenu.SetFilteringEnabled(false)
+	m.actionMenu.SetHelpKeys(m.keys.Back, m.keys.Help)
+
+	var cmd tea.Cmd
+	if m.width > 0 {
+		m.actionMenu, cmd = m.actionMenu.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+	}
+	m.state = stateActions
+	return m, cmd
+}
+
+func (m *mainModel) handleActionsKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) {
+		m.state = stateDevice
+		return m, nil
+	}
+	m.actionMenu, cmd = m.actionMenu.Update(msg)
+	return m, cmd
+}
+
+// handleDeviceAction runs the action chosen from the device menu on m.actionHost.
+func (m *mainModel) handleDeviceAction(action tssh.Action) (*mainModel, tea.Cmd) {
+	switch action {
+	case tssh.ActionShell:
+		// devices logged in to as several users offer them to pick from, the last one used first.
+		if len(m.users[m.actionHost]) > 0 {
+			return m.openUserPicker(m.actionHost)
+		}
+		hostname := m.actionHost
+		return m.checkAccess(hostname, stateActions, func() tea.Cmd { return m.sshDevice(hostname) })
+	case tssh.ActionFileTransfer:
+		m.state = stateDevice
+		return m, m.fileTransfer(m.actionHost)
+	case tssh.ActionUser:
+		return m.openUserPicker(m.actionHost)
+	case tssh.ActionIdentity:
+		return m.openIdentityPicker(m.actionHost)
+	case tssh.ActionAdmin:
+		return m.openAdminMenu(m.actionHost, stateActions)
+	case tssh.ActionPortForward:
+		return m.startForwardPrompt(m.actionHost)
+	case tssh.ActionDeviceDetail:
+		if device, ok := m.selectedDevice(); ok {
+			return m, m.showDetail(device)
+		}
+	case tssh.ActionCopyAddress:
+		m.state = stateDevice
+		return m, m.copySelectedDevice()
+	}
+	return m, nil
+}
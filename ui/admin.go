@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	adminConfirm = key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "run"))
+	adminCancel  = key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "cancel"))
+)
+
+// adminState is the admin menu of a device, the admin command chosen from it while it is being confirmed, and the
+// state to go back to when the menu is left.
+type adminState struct {
+	hostname string
+	list     *components.ListModel
+	command  config.AdminCommand
+	back     state
+}
+
+// adminCommand returns c's command for hostname, with its tokens expanded.
+func (m *mainModel) adminCommand(hostname string, c config.AdminCommand) string {
+	return strings.NewReplacer("%h", hostname, "%r", m.sshUser(hostname), "%%", "%").Replace(c.Command)
+}
+
+// openAdminMenu lists the configured admin commands for running one on hostname, going back to the back state when
+// it is left.
+func (m *mainModel) openAdminMenu(hostname string, back state) (*mainModel, tea.Cmd) {
+	if len(m.cfg.AdminCommands) == 0 {
+		return m, m.deviceList.StatusMessage("no admin_commands configured")
+	}
+	items := make([]components.ListItem, len(m.cfg.AdminCommands))
+	for i, c := range m.cfg.AdminCommands {
+		items[i] = components.ListItem{Name: c.Name, Info: m.adminCommand(hostname, c), Action: tssh.ActionRunAdmin}
+	}
+	m.admin = adminState{hostname: hostname, back: back}
+	m.admin.list = components.NewList("Admin "+hostname, m.theme, m.keys, items...)
+	m.admin.list.SetFilteringEnabled(!m.cfg.DisableFilter)
+	m.admin.list.SetHelpKeys(m.keys.Back, m.keys.Help)
+
+	var cmd tea.Cmd
+	if m.width > 0 {
+		m.admin.list, cmd = m.admin.list.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+	}
+	m.state = stateAdmin
+	return m, cmd
+}
+
+func (m *mainModel) handleAdminKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) && !m.admin.list.IsFiltering() {
+		if m.admin.list.IsFiltered() {
+			m.admin.list.ResetFilter()
+			return m, nil
+		}
+		m.state = m.admin.back
+		return m, nil
+	}
+	m.admin.list, cmd = m.admin.list.Update(msg)
+	return m, cmd
+}
+
+// confirmAdmin asks before running the admin command named name, since they are usually disruptive.
+func (m *mainModel) confirmAdmin(name string) (*mainModel, tea.Cmd) {
+	for _, c := range m.cfg.AdminCommands {
+		if c.Name == name {
+			m.admin.command = c
+			m.state = stateAdminConfirm
+			break
+		}
+	}
+	return m, nil
+}
+
+func (m *mainModel) handleAdminConfirmKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, adminConfirm):
+		hostname, command := m.admin.hostname, m.adminCommand(m.admin.hostname, m.admin.command)
+		m.logger.Info("running admin command", "action", "admin", "host", hostname, "name", m.admin.command.Name, "command", command)
+		// the running view and the result are those of a one-shot command.
+		m.command = commandPrompt{hostname: hostname}
+		m.state = stateCommandRunning
+		m.active++
+		run := m.runCommand(hostname, command)
+		return m, func() tea.Msg {
+			result := run().(commandResult)
+			result.admin = true
+			return result
+		}
+	case key.Matches(msg, adminCancel, m.keys.Back):
+		m.state = stateAdmin
+	}
+	return m, nil
+}
+
+func (m mainModel) adminConfirmView() string {
+	c := m.admin.command
+	yes, no, back := adminConfirm.Help(), adminCancel.Help(), m.keys.Back.Help()
+	keys := fmt.Sprintf("%s %s • %s/%s %s", yes.Key, yes.Desc, no.Key, back.Key, no.Desc)
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left,
+		m.textStyle(fmt.Sprintf("Run %s on %s?", c.Name, m.admin.hostname)),
+		"",
+		lipgloss.NewStyle().Foreground(m.theme.Muted).Render("$ "+m.adminCommand(m.admin.hostname, c)),
+		"",
+		lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(keys)))
+}
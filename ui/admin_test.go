@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+)
+
+func TestAdminCommand(t *testing.T) {
+	cfg := config.Default()
+	cfg.User = "ubuntu"
+	cfg.AdminCommands = []config.AdminCommand{
+		{Name: "Reboot", Command: "sudo reboot"},
+		{Name: "Restart app", Command: "sudo systemctl restart app@%r && echo %h 100%%"},
+	}
+	m := newTestModel(t, cfg)
+
+	m.openAdminMenu("web-1", stateActions)
+	if m.state != stateAdmin {
+		t.Fatalf("state = %v, want the admin menu", m.state)
+	}
+	items := m.admin.list.Items()
+	if len(items) != 2 {
+		t.Fatalf("admin menu lists %d commands, want 2", len(items))
+	}
+	if want := "sudo systemctl restart app@ubuntu && echo web-1 100%"; items[1].Info != want {
+		t.Errorf("command = %q, want %q", items[1].Info, want)
+	}
+
+	// nothing runs until it is confirmed.
+	m.handleAction(components.ListItem{Name: "Reboot", Action: tssh.ActionRunAdmin})
+	if m.state != stateAdminConfirm || m.admin.command.Name != "Reboot" {
+		t.Fatalf("state = %v confirming %q, want Reboot confirmed", m.state, m.admin.command.Name)
+	}
+	if _, cmd := m.handleKeyPress(keyPress("n")); cmd != nil || m.state != stateAdmin {
+		t.Fatalf("after n, state = %v, want the admin menu and nothing run", m.state)
+	}
+
+	m.handleAction(components.ListItem{Name: "Reboot", Action: tssh.ActionRunAdmin})
+	if _, cmd := m.handleKeyPress(keyPress("y")); cmd == nil || m.state != stateCommandRunning {
+		t.Fatalf("after y, state = %v, want the command running", m.state)
+	}
+	if m.active != 1 {
+		t.Errorf("active = %d, want the admin command counted", m.active)
+	}
+
+	m.handleCommandResult(commandResult{hostname: "web-1", command: "sudo reboot", admin: true})
+	if m.state != stateCommandOutput {
+		t.Fatalf("state = %v, want the command output", m.state)
+	}
+	m.handleKeyPress(keyPress("esc"))
+	if m.state != stateAdmin {
+		t.Errorf("back from the output goes to %v, want the admin menu", m.state)
+	}
+	m.handleKeyPress(keyPress("esc"))
+	if m.state != stateActions {
+		t.Errorf("back from the admin menu goes to %v, want the device menu it was opened from", m.state)
+	}
+}
+
+func TestAdminCommandNoneConfigured(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.deviceList.SetItems(m.deviceItems(testDevices("web-1"), time.Now())...)
+	m.state = stateDevice
+	m.handleKeyPress(keyPress("a"))
+	if m.state != stateDevice {
+		t.Errorf("state = %v, want the device list with no admin commands configured", m.state)
+	}
+}
@@ -0,0 +1,294 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+)
+
+// broadcastSort cycles the order hosts are listed in within the succeeded and failed groups of the results.
+var broadcastSort = key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "sort"))
+
+// errNotRun is the result of hosts a broadcast was canceled before reaching.
+var errNotRun = errors.New("not run, canceled")
+
+type (
+	// broadcastOrder is how hosts are sorted in the broadcast results.
+	broadcastOrder int
+
+	// broadcastState tracks the broadcast running or last run, and its results.
+	broadcastState struct {
+		id     int
+		cancel context.CancelFunc
+		result broadcastResult
+		list   *components.ListModel
+		order  broadcastOrder
+		// host is the result being looked at in full, when one has been chosen from the list.
+		host commandResult
+	}
+
+	// broadcastResult is the outcome of running a command on several devices, in the order the devices were given.
+	broadcastResult struct {
+		id       int
+		command  string
+		results  []commandResult
+		duration time.Duration
+	}
+)
+
+const (
+	orderHost broadcastOrder = iota
+	orderDuration
+	orderExitStatus
+)
+
+func (o broadcastOrder) String() string {
+	switch o {
+	case orderDuration:
+		return "slowest first"
+	case orderExitStatus:
+		return "exit status"
+	default:
+		return "host"
+	}
+}
+
+// startBroadcast opens the command prompt for running a command on every one of hostnames.
+func (m *mainModel) startBroadcast(hostnames []string) (*mainModel, tea.Cmd) {
+	input := textinput.New()
+	input.Prompt = fmt.Sprintf("%d devices $ ", len(hostnames))
+	input.PromptStyle = lipgloss.NewStyle().Foreground(m.theme.Accent)
+	input.Placeholder = "command"
+	input.Width = m.inputWidth(input.Prompt)
+
+	m.command = commandPrompt{hosts: hostnames, input: input, index: -1}
+	m.state = stateCommand
+	return m, m.command.input.Focus()
+}
+
+// runBroadcast runs command on each of hostnames, at most command_concurrency at a time, and reports every host's
+// result as a broadcastResult once they have all finished. Stopping the broadcast with stopBroadcast closes the
+// commands still running and skips the hosts not yet reached. How to reach each host is worked out up front, as
+// that reads the model, which the workers mustn't touch.
+func (m *mainModel) runBroadcast(hostnames []string, command string) tea.Cmd {
+	targets := make([]sshTarget, len(hostnames))
+	targetErrs := make([]error, len(hostnames))
+	for i, hostname := range hostnames {
+		targets[i], targetErrs[i] = m.target(hostname)
+	}
+
+	m.stopBroadcast()
+	m.broadcast.id++
+	id := m.broadcast.id
+	ctx, cancel := context.WithCancel(context.Background())
+	done := m.sessions.add(cancel)
+	m.active++
+	m.broadcast.cancel = func() {
+		done()
+		cancel()
+		m.active--
+	}
+
+	return func() tea.Msg {
+		defer cancel()
+		start := time.Now()
+		results := make([]commandResult, len(hostnames))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < min(m.cfg.CommandConcurrency, len(hostnames)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					started := time.Now()
+					output, err := "", targetErrs[i]
+					if err == nil {
+						output, err = m.execCommand(ctx, targets[i], hostnames[i], command)
+					}
+					results[i] = commandResult{hostname: hostnames[i], command: command, output: output, err: err, duration: time.Since(started)}
+				}
+			}()
+		}
+		for i := range hostnames {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				results[i] = commandResult{hostname: hostnames[i], command: command, err: errNotRun}
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		return broadcastResult{id: id, command: command, results: results, duration: time.Since(start)}
+	}
+}
+
+// stopBroadcast cancels the broadcast in flight, if any.
+func (m *mainModel) stopBroadcast() {
+	if m.broadcast.cancel != nil {
+		m.broadcast.cancel()
+		m.broadcast.cancel = nil
+	}
+}
+
+func (m *mainModel) handleBroadcastResult(result broadcastResult) (*mainModel, tea.Cmd) {
+	if result.id != m.broadcast.id || m.state != stateCommandRunning {
+		// canceled, or superseded by a newer broadcast.
+		return m, nil
+	}
+	m.stopBroadcast()
+	failed := 0
+	for _, r := range result.results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	m.logger.Info("broadcast finished", "action", "broadcast", "command", result.command, "hosts", len(result.results), "failed", failed)
+	m.broadcast.result = result
+	m.broadcast.list = components.NewList(fmt.Sprintf("$ %s", result.command), m.theme, m.keys)
+	m.broadcast.list.SetFilteringEnabled(!m.cfg.DisableFilter)
+	m.broadcast.list.SetHelpKeys(broadcastSort, m.keys.Back, m.keys.Help)
+	m.state = stateBroadcastOutput
+	return m, m.sortBroadcast(m.broadcast.order)
+}
+
+// sortBroadcast lists the results in order, failed hosts first.
+func (m *mainModel) sortBroadcast(order broadcastOrder) tea.Cmd {
+	m.broadcast.order = order
+	var succeeded, failed []commandResult
+	for _, r := range m.broadcast.result.results {
+		if r.err != nil {
+			failed = append(failed, r)
+		} else {
+			succeeded = append(succeeded, r)
+		}
+	}
+
+	var items []components.ListItem
+	for _, group := range []struct {
+		name    string
+		results []commandResult
+	}{{"failed", failed}, {"succeeded", succeeded}} {
+		if len(group.results) == 0 {
+			continue
+		}
+		sortResults(group.results, order)
+		items = append(items, components.ListItem{Name: fmt.Sprintf("── %s ──", group.name), Info: fmt.Sprintf("%d devices", len(group.results)), Action: tssh.ActionNone})
+		for _, r := range group.results {
+			items = append(items, components.ListItem{
+				Name:   r.hostname,
+				Info:   fmt.Sprintf("%s • %s", exitStatus(r.err), r.duration.Round(time.Millisecond)),
+				Action: tssh.ActionCommandResult,
+			})
+		}
+	}
+
+	var sizeCmd tea.Cmd
+	if m.width > 0 {
+		m.broadcast.list, sizeCmd = m.broadcast.list.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+	}
+	return tea.Batch(sizeCmd, m.broadcast.list.SetItems(items...), m.broadcast.list.StatusMessage("sorted by "+order.String()))
+}
+
+func sortResults(results []commandResult, order broadcastOrder) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch order {
+		case orderDuration:
+			if a.duration != b.duration {
+				return a.duration > b.duration
+			}
+		case orderExitStatus:
+			if sa, sb := exitStatus(a.err), exitStatus(b.err); sa != sb {
+				return sa < sb
+			}
+		}
+		return a.hostname < b.hostname
+	})
+}
+
+func (m *mainModel) handleBroadcastOutputKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	l := m.broadcast.list
+	if !l.IsFiltering() {
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			if l.IsFiltered() {
+				l.ResetFilter()
+				return m, nil
+			}
+			// go back to the prompt to run another command on the same hosts.
+			hostnames := make([]string, len(m.broadcast.result.results))
+			for i, r := range m.broadcast.result.results {
+				hostnames[i] = r.hostname
+			}
+			return m.startBroadcast(hostnames)
+		case key.Matches(msg, broadcastSort):
+			return m, m.sortBroadcast((m.broadcast.order + 1) % 3)
+		}
+	}
+	m.broadcast.list, cmd = l.Update(msg)
+	return m, cmd
+}
+
+// showBroadcastHost shows the full output of hostname's result.
+func (m *mainModel) showBroadcastHost(hostname string) (*mainModel, tea.Cmd) {
+	for _, r := range m.broadcast.result.results {
+		if r.hostname == hostname {
+			m.broadcast.host = r
+			m.commandOutput = viewport.New(m.outputSize())
+			m.commandOutput.SetContent(r.output)
+			m.state = stateBroadcastHost
+			break
+		}
+	}
+	return m, nil
+}
+
+func (m *mainModel) handleBroadcastHostKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) {
+		m.state = stateBroadcastOutput
+		return m, nil
+	}
+	m.commandOutput, cmd = m.commandOutput.Update(msg)
+	return m, cmd
+}
+
+// exitStatus describes how a command ended: its exit code if it ran, or the error that kept it from running.
+func exitStatus(err error) string {
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return "exit 0"
+	case errors.As(err, &exitErr):
+		return fmt.Sprintf("exit %d", exitErr.ExitStatus())
+	default:
+		return err.Error()
+	}
+}
+
+func (m mainModel) broadcastHostView() string {
+	r := m.broadcast.host
+	status := lipgloss.NewStyle().Foreground(m.theme.Success).Render(exitStatus(r.err))
+	if r.err != nil {
+		status = m.textStyle(exitStatus(r.err))
+	}
+	header := fmt.Sprintf("%s $ %s  %s  %s", r.hostname, r.command, status,
+		lipgloss.NewStyle().Foreground(m.theme.Muted).Render(r.duration.Round(time.Millisecond).String()))
+
+	back := m.keys.Back.Help()
+	footer := lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key + " all results")
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, header, "", m.commandOutput.View(), "", footer))
+}
@@ -0,0 +1,34 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/acmacalister/tssh/config"
+)
+
+// TestBroadcastTargets runs a broadcast while the model changes under it, which the race detector flags if the
+// workers read the model.
+func TestBroadcastTargets(t *testing.T) {
+	// a proxy command that fails reaches no device, without dialling the test addresses.
+	cfg := config.Default()
+	cfg.ProxyCommand = "exit 1"
+	m := newTestModel(t, cfg)
+	m.devices = testDevices("web-1", "web-2")
+
+	cmd := m.runBroadcast([]string{"web-1", "web-2"}, "uptime")
+	done := make(chan broadcastResult)
+	go func() { done <- cmd().(broadcastResult) }()
+	m.devices = testDevices("db-1")
+	m.identities["web-1"] = "/nonexistent/id_ed25519"
+
+	result := <-done
+	if len(result.results) != 2 {
+		t.Fatalf("%d results, want one per host", len(result.results))
+	}
+	for _, r := range result.results {
+		if r.err == nil || !strings.Contains(r.err.Error(), "failed to connect") {
+			t.Errorf("%s: %v, want the connection to fail", r.hostname, r.err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+)
+
+// certificates returns the SSH certificates to present to hostname: certificate_hosts' or certificate's, then
+// ssh_config's CertificateFiles, then those next to the identities at keyPaths, named like id_ed25519-cert.pub as
+// ssh-keygen writes them. Certificates that can't be read are skipped.
+func (m *mainModel) certificates(hostname, user string, keyPaths []string) []*ssh.Certificate {
+	var paths []string
+	path, ok := m.cfg.CertificateHosts[hostname]
+	if !ok {
+		path = m.cfg.Certificate
+	}
+	if path != "" {
+		paths = append(paths, expandSSHPath(path, hostname, user))
+	}
+	files, err := ssh_config.GetAllStrict(hostname, "CertificateFile")
+	if err != nil {
+		m.logger.Warn("failed to read ssh config", "host", hostname, "key", "CertificateFile", "error", err)
+	}
+	for _, file := range files {
+		paths = append(paths, expandSSHPath(file, hostname, user))
+	}
+	explicit := len(paths)
+	for _, keyPath := range keyPaths {
+		paths = append(paths, keyPath+"-cert.pub")
+	}
+
+	var certs []*ssh.Certificate
+	for i, path := range paths {
+		if slices.Contains(paths[:i], path) {
+			continue
+		}
+		cert, err := loadCertificate(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && i >= explicit:
+		case err != nil:
+			m.logger.Warn("skipping certificate", "host", hostname, "path", path, "error", err)
+		default:
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// loadCertificate reads the OpenSSH certificate at path.
+func loadCertificate(path string) (*ssh.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %s public key, not a certificate", path, key.Type())
+	}
+	return cert, nil
+}
+
+// withCertificates returns signers with a signer presenting each of certs in front, for the certificates whose key
+// is one of signers'. Servers that don't trust the certificate's authority still get offered the plain keys.
+func withCertificates(certs []*ssh.Certificate, signers []ssh.Signer) []ssh.Signer {
+	var certSigners []ssh.Signer
+	for _, cert := range certs {
+		for _, signer := range signers {
+			if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+				continue
+			}
+			if certSigner, err := ssh.NewCertSigner(cert, signer); err == nil {
+				certSigners = append(certSigners, certSigner)
+			}
+			break
+		}
+	}
+	return append(certSigners, signers...)
+}
+
+// certificateWarning returns why hostname will probably refuse the certificates the built in client would present,
+// or "" if one of them is valid or there are none. Certificates are usually short lived, so this is checked before
+// every connection.
+func (m *mainModel) certificateWarning(hostname string) string {
+	user := m.sshUser(hostname)
+	var reason string
+	for _, cert := range m.certificates(hostname, user, m.identityPaths(hostname, user)) {
+		problem := certificateProblem(cert, time.Now())
+		if problem == "" {
+			return ""
+		}
+		if reason == "" {
+			reason = problem
+		}
+	}
+	return reason
+}
+
+// certificateProblem returns why cert isn't valid at now, or "" if it is.
+func certificateProblem(cert *ssh.Certificate, now time.Time) string {
+	name := "The SSH certificate"
+	if cert.KeyId != "" {
+		name += " " + strconv.Quote(cert.KeyId)
+	}
+	unix := uint64(now.Unix())
+	switch {
+	case cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore:
+		ago := now.Sub(time.Unix(int64(cert.ValidBefore), 0)).Round(time.Second)
+		return fmt.Sprintf("%s expired %s ago", name, ago)
+	case unix < cert.ValidAfter:
+		in := time.Unix(int64(cert.ValidAfter), 0).Sub(now).Round(time.Second)
+		return fmt.Sprintf("%s isn't valid for another %s", name, in)
+	}
+	return ""
+}
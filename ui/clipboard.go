@@ -0,0 +1,31 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// copySelectedDevice copies the selected device's Tailscale address, or its hostname if it has none, to the
+// system clipboard and reports the outcome in the status bar. Over SSH or on a headless machine there is often
+// no clipboard, which is reported rather than treated as a failure.
+func (m *mainModel) copySelectedDevice() tea.Cmd {
+	item, ok := m.deviceList.Selected()
+	if !ok {
+		return nil
+	}
+
+	text := item.Address
+	if text == "" {
+		text = item.Name
+	}
+
+	if clipboard.Unsupported {
+		return m.deviceList.StatusMessage("No clipboard available on this system")
+	}
+	if err := clipboard.WriteAll(text); err != nil {
+		return m.deviceList.StatusMessage(fmt.Sprintf("Could not copy to clipboard: %v", err))
+	}
+	return m.deviceList.StatusMessage("Copied " + text)
+}
@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"github.com/acmacalister/tssh/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// colorProfiles are the termenv profiles color_profile names.
+var colorProfiles = map[string]termenv.Profile{
+	config.ColorProfileTrueColor: termenv.TrueColor,
+	config.ColorProfileANSI256:   termenv.ANSI256,
+	config.ColorProfileANSI:      termenv.ANSI,
+	config.ColorProfileASCII:     termenv.Ascii,
+}
+
+// setColorProfile sets the colors every style is rendered with, and returns them. lipgloss detects what the
+// terminal supports from TERM, COLORTERM and the like; color_profile overrides that, and no_color overrides both
+// with plain text, which keeps bold, underlines and borders. Colors beyond the profile are rendered as the closest
+// it has, and the built-in themes have colors of their own for the 16 ANSI colors, see components.LoadTheme.
+func setColorProfile(cfg *config.Config) termenv.Profile {
+	switch {
+	case cfg.NoColor:
+		lipgloss.SetColorProfile(termenv.Ascii)
+	case cfg.ColorProfile != "":
+		lipgloss.SetColorProfile(colorProfiles[cfg.ColorProfile])
+	}
+	return lipgloss.ColorProfile()
+}
+
+// colorProfileName returns the color_profile name of profile.
+func colorProfileName(profile termenv.Profile) string {
+	for name, p := range colorProfiles {
+		if p == profile {
+			return name
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,212 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// recentCommands is how many history entries are listed under the command prompt.
+const recentCommands = 5
+
+var (
+	historyPrev = key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("↑", "older"))
+	historyNext = key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("↓", "newer"))
+)
+
+type (
+	// commandPrompt composes a one-shot command for a device, with its recent commands to pick from, or for
+	// several devices at once when hosts is set.
+	commandPrompt struct {
+		hostname string
+		hosts    []string
+		input    textinput.Model
+		history  []string
+		// index is the history entry shown in the input, or -1 while composing a new command.
+		index int
+	}
+
+	// commandResult is the outcome of running a one-shot command.
+	commandResult struct {
+		hostname string
+		command  string
+		output   string
+		err      error
+		duration time.Duration
+		// admin is set for admin commands, whose result goes back to the admin menu rather than the prompt.
+		admin bool
+	}
+)
+
+// startCommand opens the command prompt for hostname.
+func (m *mainModel) startCommand(hostname string) (*mainModel, tea.Cmd) {
+	input := textinput.New()
+	input.Prompt = hostname + " $ "
+	input.PromptStyle = lipgloss.NewStyle().Foreground(m.theme.Accent)
+	input.Placeholder = "command"
+	input.Width = m.inputWidth(input.Prompt)
+
+	m.command = commandPrompt{hostname: hostname, input: input, history: m.history[hostname], index: -1}
+	m.state = stateCommand
+	return m, m.command.input.Focus()
+}
+
+func (m *mainModel) handleCommandKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	p := &m.command
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.state = stateDevice
+		return m, nil
+	case key.Matches(msg, m.keys.Choose):
+		command := strings.TrimSpace(p.input.Value())
+		if command == "" {
+			return m, nil
+		}
+		hostnames := p.hosts
+		if len(hostnames) == 0 {
+			hostnames = []string{p.hostname}
+		}
+		for _, hostname := range hostnames {
+			m.history.Add(hostname, command)
+		}
+		if err := m.history.Save(); err != nil {
+			m.logger.Warn("saving command history failed", "error", err)
+		}
+		m.state = stateCommandRunning
+		if len(p.hosts) > 0 {
+			return m, m.runBroadcast(p.hosts, command)
+		}
+		m.active++
+		return m, m.runCommand(p.hostname, command)
+	case key.Matches(msg, historyPrev):
+		if p.index+1 < len(p.history) {
+			p.index++
+			p.input.SetValue(p.history[p.index])
+			p.input.CursorEnd()
+		}
+		return m, nil
+	case key.Matches(msg, historyNext):
+		if p.index >= 0 {
+			p.index--
+			value := ""
+			if p.index >= 0 {
+				value = p.history[p.index]
+			}
+			p.input.SetValue(value)
+			p.input.CursorEnd()
+		}
+		return m, nil
+	}
+
+	p.input, cmd = p.input.Update(msg)
+	return m, cmd
+}
+
+// runCommand runs command on hostname without a pty and reports its combined output as a commandResult.
+func (m *mainModel) runCommand(hostname, command string) tea.Cmd {
+	t, err := m.target(hostname)
+	return func() tea.Msg {
+		start := time.Now()
+		output := ""
+		if err == nil {
+			output, err = m.execCommand(context.Background(), t, hostname, command)
+		}
+		return commandResult{hostname: hostname, command: command, output: output, err: err, duration: time.Since(start)}
+	}
+}
+
+// execCommand runs command on hostname, reached as t says, and returns its combined output. Canceling ctx closes
+// the session, ending the command early.
+func (m *mainModel) execCommand(ctx context.Context, t sshTarget, hostname, command string) (string, error) {
+	client, release, err := m.connect(t, hostname, "command")
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("%v failed to open session", err)
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	out, err := session.CombinedOutput(command)
+	if ctx.Err() != nil {
+		return string(out), ctx.Err()
+	}
+	return string(out), err
+}
+
+func (m *mainModel) handleCommandResult(result commandResult) (*mainModel, tea.Cmd) {
+	m.logger.Info("command finished", "action", "command", "host", result.hostname, "command", result.command, "error", result.err)
+	m.active--
+	m.commandResult = result
+	m.commandOutput = viewport.New(m.outputSize())
+	m.commandOutput.SetContent(result.output)
+	m.state = stateCommandOutput
+	return m, nil
+}
+
+func (m *mainModel) handleCommandOutputKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) {
+		if m.commandResult.admin {
+			m.state = stateAdmin
+			return m, nil
+		}
+		// go back to the prompt, with the command just run at the top of the history.
+		return m.startCommand(m.commandResult.hostname)
+	}
+	m.commandOutput, cmd = m.commandOutput.Update(msg)
+	return m, cmd
+}
+
+func (m mainModel) commandView() string {
+	p := m.command
+	muted := lipgloss.NewStyle().Foreground(m.theme.Muted).Render
+	lines := []string{p.input.View(), ""}
+	// list a window of recent commands that keeps the selected one in view.
+	start := 0
+	if p.index >= recentCommands {
+		start = p.index - recentCommands + 1
+	}
+	for i := start; i < len(p.history) && i < start+recentCommands; i++ {
+		if i == p.index {
+			lines = append(lines, lipgloss.NewStyle().Foreground(m.theme.Accent).Render("> "+p.history[i]))
+			continue
+		}
+		lines = append(lines, muted("  "+p.history[i]))
+	}
+
+	choose, back := m.keys.Choose.Help(), m.keys.Back.Help()
+	help := fmt.Sprintf("%s run • %s/%s history • %s back", choose.Key, historyPrev.Help().Key, historyNext.Help().Key, back.Key)
+	lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(help))
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (m mainModel) commandOutputView() string {
+	r := m.commandResult
+	status := lipgloss.NewStyle().Foreground(m.theme.Success).Render(exitStatus(r.err))
+	if r.err != nil {
+		status = m.textStyle(exitStatus(r.err))
+	}
+	header := fmt.Sprintf("%s $ %s  %s  %s", r.hostname, r.command, status,
+		lipgloss.NewStyle().Foreground(m.theme.Muted).Render(r.duration.Round(time.Millisecond).String()))
+
+	back := m.keys.Back.Help()
+	footer := lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key + " new command")
+	if r.admin {
+		footer = lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key + " admin commands")
+	}
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, header, "", m.commandOutput.View(), "", footer))
+}
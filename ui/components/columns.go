@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+)
+
+// columnGap is the space between columns.
+const columnGap = "  "
+
+// columnDelegate renders each item on a single line, with its Columns aligned across the whole list. Items without
+// columns, such as section headers, are rendered as their name followed by their info. When the columns don't fit
+// the list's width, the widest are truncated first.
+type columnDelegate struct {
+	list.DefaultDelegate
+	marked map[string]bool
+}
+
+func newColumnDelegate(t Theme, keys KeyMap, marked map[string]bool) columnDelegate {
+	d := newDelegate(t, keys)
+	d.ShowDescription = false
+	d.SetHeight(1)
+	d.SetSpacing(0)
+	return columnDelegate{DefaultDelegate: d, marked: marked}
+}
+
+// cells returns the text of each of i's columns, with the mark after the first one if i is marked.
+func (d columnDelegate) cells(i ListItem) []string {
+	cells := i.Columns
+	if len(cells) == 0 {
+		cells = []string{i.Name, i.Info}
+	}
+	if d.marked[i.Name] {
+		cells = append([]string{cells[0] + " ✓"}, cells[1:]...)
+	}
+	return cells
+}
+
+// widths returns the width of each column: the widest cell in it among all the items, shrunk to fit within width.
+func (d columnDelegate) widths(items []list.Item, width int) []int {
+	var widths []int
+	for _, item := range items {
+		i, ok := item.(ListItem)
+		if !ok || len(i.Columns) == 0 {
+			continue
+		}
+		for n, cell := range d.cells(i) {
+			if n == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[n] = max(widths[n], lipgloss.Width(cell))
+		}
+	}
+	if len(widths) == 0 {
+		return nil
+	}
+
+	total := len(columnGap) * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > width {
+		widest := 0
+		for n, w := range widths {
+			if w > widths[widest] {
+				widest = n
+			}
+		}
+		if widths[widest] <= 1 {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+func (d columnDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	i, ok := item.(ListItem)
+	if !ok || m.Width() <= 0 {
+		return
+	}
+	s := &d.Styles
+	width := m.Width() - s.NormalTitle.GetPaddingLeft() - s.NormalTitle.GetPaddingRight()
+
+	var (
+		isSelected  = index == m.Index()
+		emptyFilter = m.FilterState() == list.Filtering && m.FilterValue() == ""
+		isFiltered  = m.FilterState() == list.Filtering || m.FilterState() == list.FilterApplied
+	)
+	frame, first, rest := s.NormalTitle, s.NormalTitle, s.NormalDesc
+	switch {
+	case emptyFilter:
+		frame, first, rest = s.DimmedTitle, s.DimmedTitle, s.DimmedDesc
+	case isSelected && m.FilterState() != list.Filtering:
+		frame, first, rest = s.SelectedTitle, s.SelectedTitle, s.SelectedDesc
+	}
+	first, rest = first.Copy().Inline(true), rest.Copy().Inline(true)
+
+	cells := d.cells(i)
+	widths := d.widths(m.Items(), width)
+	if len(i.Columns) == 0 {
+		// not part of the table, so it gets the whole width.
+		name := min(lipgloss.Width(cells[0]), width)
+		widths = []int{name, max(width-name-len(columnGap), 0)}
+	}
+
+	var b strings.Builder
+	for n, cell := range cells {
+		if n >= len(widths) {
+			break
+		}
+		if n > 0 {
+			b.WriteString(columnGap)
+		}
+		if lipgloss.Width(cell) > widths[n] {
+			// the tail's width is always set aside, even for text that would fit, so only truncate what doesn't.
+			cell = truncate.StringWithTail(cell, uint(widths[n]), ellipsis)
+		}
+		padding := strings.Repeat(" ", max(widths[n]-lipgloss.Width(cell), 0))
+		if n == 0 {
+			if isFiltered && !emptyFilter {
+				matched := first.Copy().Inherit(s.FilterMatch)
+				cell = lipgloss.StyleRunes(cell, m.MatchesForItem(index), matched, first)
+			} else {
+				cell = first.Render(cell)
+			}
+		} else {
+			cell = rest.Render(cell)
+		}
+		b.WriteString(cell + padding)
+	}
+	fmt.Fprint(w, frame.Copy().UnsetForeground().Render(strings.TrimRight(b.String(), " ")))
+}
@@ -0,0 +1,264 @@
+package ui
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+type (
+	// filterIndex holds what filterItems works out from the items on every keystroke, worked out once when the
+	// items are set instead. Each rune of the names, folded to ignore case, lists the names containing it, so that
+	// only the names containing every rune of a term are fuzzy matched against it. Addresses are sorted, so that the
+	// items with an address starting with a term are found with a binary search rather than by scanning every
+	// address of every item.
+	filterIndex struct {
+		names []string
+		// ascii lists the names containing each ASCII rune and runes those containing any other, kept apart as
+		// names are mostly ASCII and an array is quicker to build than a map.
+		ascii [utf8.RuneSelf][]int
+		runes map[rune]*[]int
+		addrs []indexedAddr
+		// sorted is addrs sorted, which is left until an address is first filtered by, see sortedAddrs, as most
+		// lists never are.
+		sorted     []indexedAddr
+		sortedOnce sync.Once
+	}
+
+	indexedAddr struct {
+		addr  string
+		index int
+	}
+)
+
+// newFilterIndex indexes items, which must be in the order the list passes their filter values to its filter in.
+func newFilterIndex(items []list.Item) *filterIndex {
+	return (&filterIndex{}).with(items)
+}
+
+// with returns a new index of the items x indexes followed by items. x itself is left alone, as filters run in
+// their own goroutine and may still be using it.
+func (x *filterIndex) with(items []list.Item) *filterIndex {
+	next := &filterIndex{
+		names: append(make([]string, 0, len(x.names)+len(items)), x.names...),
+		runes: make(map[rune]*[]int, len(x.runes)),
+		// most items have an address or two, so make room for one each up front.
+		addrs: append(make([]indexedAddr, 0, len(x.addrs)+len(items)), x.addrs...),
+	}
+	// clipped, so appending to them copies rather than writing into the lists x is still using.
+	for r, indexes := range x.ascii {
+		next.ascii[r] = indexes[:len(indexes):len(indexes)]
+	}
+	for r, indexes := range x.runes {
+		clipped := (*indexes)[:len(*indexes):len(*indexes)]
+		next.runes[r] = &clipped
+	}
+	for _, item := range items {
+		name, addrs := filterParts(item)
+		index := len(next.names)
+		next.names = append(next.names, name)
+		for _, r := range name {
+			indexes := next.postings(r)
+			// a name is listed once under each rune, however many times it has it.
+			if len(*indexes) == 0 || (*indexes)[len(*indexes)-1] != index {
+				*indexes = append(*indexes, index)
+			}
+		}
+		for _, addr := range addrs {
+			next.addrs = append(next.addrs, indexedAddr{addr: strings.ToLower(addr), index: index})
+		}
+	}
+	return next
+}
+
+// filterParts returns the name and addresses in item's filter value, taking them from a ListItem directly rather
+// than joining them up only to split them again.
+func filterParts(item list.Item) (string, []string) {
+	if i, ok := item.(ListItem); ok {
+		return i.Name, i.Addresses
+	}
+	name, addrs, _ := strings.Cut(item.FilterValue(), "\n")
+	if addrs == "" {
+		return name, nil
+	}
+	return name, strings.Split(addrs, "\n")
+}
+
+// postings returns the list of the names containing r, ignoring case, adding one if it has none yet.
+func (x *filterIndex) postings(r rune) *[]int {
+	r = foldRune(r)
+	if r < utf8.RuneSelf {
+		return &x.ascii[r]
+	}
+	indexes, ok := x.runes[r]
+	if !ok {
+		indexes = new([]int)
+		x.runes[r] = indexes
+	}
+	return indexes
+}
+
+// containing returns the list of the names containing r, ignoring case. Unlike postings it leaves the index alone, so
+// filters can call it concurrently.
+func (x *filterIndex) containing(r rune) []int {
+	if r = foldRune(r); r < utf8.RuneSelf {
+		return x.ascii[r]
+	}
+	if indexes, ok := x.runes[r]; ok {
+		return *indexes
+	}
+	return nil
+}
+
+// sortedAddrs returns the indexed addresses sorted, sorting them the first time.
+func (x *filterIndex) sortedAddrs() []indexedAddr {
+	x.sortedOnce.Do(func() {
+		x.sorted = slices.Clone(x.addrs)
+		slices.SortFunc(x.sorted, func(a, b indexedAddr) int { return strings.Compare(a.addr, b.addr) })
+	})
+	return x.sorted
+}
+
+// filter matches term as filterItems does, using the index. Targets that don't match the index, which happens only
+// if the items were changed without reindexing them, are filtered with filterItems instead.
+func (x *filterIndex) filter(term string, targets []string) []list.Rank {
+	if len(targets) != len(x.names) {
+		return filterItems(term, targets)
+	}
+	if !looksLikeIP(term) {
+		return x.filterNames(term)
+	}
+
+	term = strings.ToLower(term)
+	addrs := x.sortedAddrs()
+	start := sort.Search(len(addrs), func(i int) bool { return addrs[i].addr >= term })
+	var indexes []int
+	seen := map[int]bool{}
+	for _, a := range addrs[start:] {
+		if !strings.HasPrefix(a.addr, term) {
+			break
+		}
+		if !seen[a.index] {
+			seen[a.index] = true
+			indexes = append(indexes, a.index)
+		}
+	}
+	// filterItems ranks matching addresses in item order, which the index has lost.
+	sort.Ints(indexes)
+	ranks := make([]list.Rank, len(indexes))
+	for i, index := range indexes {
+		ranks[i] = list.Rank{Index: index}
+	}
+	return ranks
+}
+
+// filterNames fuzzy matches term against the names containing every rune of term, which are the only ones that can
+// match, as a fuzzy match takes each rune of the term in turn. The candidates keep their order, so they are ranked
+// as they would be among all the names.
+func (x *filterIndex) filterNames(term string) []list.Rank {
+	indexes := x.candidates(term)
+	if indexes == nil {
+		return list.DefaultFilter(term, x.names)
+	}
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = x.names[index]
+	}
+	ranks := list.DefaultFilter(term, names)
+	for i := range ranks {
+		ranks[i].Index = indexes[ranks[i].Index]
+	}
+	return ranks
+}
+
+// candidates returns the indexes, in order, of the names containing every rune of term, ignoring case. It returns
+// nil for an empty term, which every name contains.
+func (x *filterIndex) candidates(term string) []int {
+	var lists [][]int
+	for _, r := range term {
+		lists = append(lists, x.containing(r))
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	// intersecting from the shortest list keeps every step as small as the result can be.
+	slices.SortFunc(lists, func(a, b []int) int { return len(a) - len(b) })
+	indexes := append([]int{}, lists[0]...)
+	for _, other := range lists[1:] {
+		indexes = intersect(indexes, other)
+	}
+	return indexes
+}
+
+// intersect returns the indexes in both a and b, which are sorted, reusing a.
+func intersect(a, b []int) []int {
+	out, j := a[:0], 0
+	for _, index := range a {
+		for j < len(b) && b[j] < index {
+			j++
+		}
+		if j < len(b) && b[j] == index {
+			out = append(out, index)
+		}
+	}
+	return out
+}
+
+// foldRune returns the rune r is indexed under, the smallest of the runes equal to it under Unicode case folding,
+// which are the runes sahilm/fuzzy matches it to.
+func foldRune(r rune) rune {
+	switch {
+	case 'a' <= r && r <= 'z':
+		return r - 'a' + 'A'
+	case r < utf8.RuneSelf:
+		return r
+	}
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		folded = min(folded, f)
+	}
+	return folded
+}
+
+// filterItems is the list filter. Terms that look like an IP address, or the start of one such as "100.64.", are
+// matched as a prefix of the items' addresses; anything else is fuzzy matched against the items' names. targets
+// are ListItem.FilterValue, the name and then the addresses, one per line.
+func filterItems(term string, targets []string) []list.Rank {
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i], _, _ = strings.Cut(target, "\n")
+	}
+	if !looksLikeIP(term) {
+		return list.DefaultFilter(term, names)
+	}
+
+	term = strings.ToLower(term)
+	var ranks []list.Rank
+	for i, target := range targets {
+		for _, addr := range strings.Split(target, "\n")[1:] {
+			if strings.HasPrefix(strings.ToLower(addr), term) {
+				ranks = append(ranks, list.Rank{Index: i})
+				break
+			}
+		}
+	}
+	return ranks
+}
+
+// looksLikeIP reports whether term could be all or the start of an IPv4 address, digits with at least one dot, or
+// an IPv6 address, hex digits with at least one colon.
+func looksLikeIP(term string) bool {
+	switch {
+	case strings.Contains(term, "."):
+		return strings.Trim(term, "0123456789.") == ""
+	case strings.Contains(term, ":"):
+		return strings.Trim(strings.ToLower(term), "0123456789abcdef:") == ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// filterTestItems returns n items named host-<i>, each with a tailnet IPv4 and IPv6 address.
+func filterTestItems(n int) []list.Item {
+	items := make([]list.Item, n)
+	for i := range items {
+		items[i] = ListItem{
+			Name:      fmt.Sprintf("host-%d", i),
+			Addresses: []string{fmt.Sprintf("100.64.%d.%d", i/256, i%256), fmt.Sprintf("fd7a:115c:a1e0::%x", i)},
+		}
+	}
+	return items
+}
+
+func filterTargets(items []list.Item) []string {
+	targets := make([]string, len(items))
+	for i, item := range items {
+		targets[i] = item.FilterValue()
+	}
+	return targets
+}
+
+func TestFilterIndexMatchesFilterItems(t *testing.T) {
+	items := filterTestItems(600)
+	// an item without addresses, one sharing another's address, and one whose name only matches ignoring case.
+	items = append(items, ListItem{Name: "no-address"}, ListItem{Name: "shared", Addresses: []string{"100.64.0.1"}}, ListItem{Name: "Kiosk-Ärger"})
+	targets := filterTargets(items)
+
+	indexes := map[string]*filterIndex{
+		"built at once":   newFilterIndex(items),
+		"built in chunks": newFilterIndex(items[:250]).with(items[250:]),
+	}
+	for name, x := range indexes {
+		for _, term := range []string{"", "host", "HOST", "hst-12", "host-599", "59", "shared", "nothing", "kiosk", "\u212aiosk", "äRG", "zz", "100.", "100.64.0.1", "100.64.1.", "100.64.2.", "10.", "FD7A:115C", "fd7a:115c:a1e0::1", "::"} {
+			got, want := x.filter(term, targets), filterItems(term, targets)
+			if len(got) == 0 && len(want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: filter(%q) = %v, want %v as filterItems", name, term, got, want)
+			}
+		}
+	}
+
+	// only names with every rune of the term, ignoring case, are fuzzy matched.
+	if got, want := indexes["built in chunks"].candidates("KSK"), []int{len(items) - 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates(KSK) = %v, want %v", got, want)
+	}
+
+	// targets that no longer match the index fall back to filterItems.
+	stale := targets[:10]
+	if got, want := indexes["built at once"].filter("100.64.0.", stale), filterItems("100.64.0.", stale); !reflect.DeepEqual(got, want) {
+		t.Errorf("filter with stale index = %v, want %v", got, want)
+	}
+}
+
+func benchmarkFilter(b *testing.B, filter func(term string, targets []string) []list.Rank, targets []string) {
+	for _, term := range []string{"host-42", "100.64.3."} {
+		b.Run(term, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				filter(term, targets)
+			}
+		})
+	}
+}
+
+func BenchmarkFilterItems(b *testing.B) {
+	benchmarkFilter(b, filterItems, filterTargets(filterTestItems(10000)))
+}
+
+func BenchmarkFilterIndex(b *testing.B) {
+	items := filterTestItems(10000)
+	benchmarkFilter(b, newFilterIndex(items).filter, filterTargets(items))
+}
+
+func BenchmarkFilterIndexBuild(b *testing.B) {
+	items := filterTestItems(10000)
+	for i := 0; i < b.N; i++ {
+		newFilterIndex(items)
+	}
+}
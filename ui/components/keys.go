@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/acmacalister/tssh/config"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// KeyMap holds the key bindings of the UI. Bindings can be overridden from the config file, see LoadKeyMap.
+type KeyMap struct {
+	Choose     key.Binding
+	Quit       key.Binding
+	Refresh    key.Binding
+	Back       key.Binding
+	Detail     key.Binding
+	Copy       key.Binding
+	Test       key.Binding
+	Command    key.Binding
+	Group      key.Binding
+	GroupOwner key.Binding
+	Select     key.Binding
+	SystemSSH  key.Binding
+	Compact    key.Binding
+	Admin      key.Binding
+	Help       key.Binding
+}
+
+// DefaultKeyMap returns the bindings used when none are configured.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Choose:     binding([]string{"enter"}, "choose"),
+		Quit:       binding([]string{"q", "ctrl+c"}, "quit"),
+		Refresh:    binding([]string{"r"}, "refresh"),
+		Back:       binding([]string{"esc"}, "back"),
+		Detail:     binding([]string{"i"}, "details"),
+		Copy:       binding([]string{"y"}, "copy address"),
+		Test:       binding([]string{"t"}, "test connection"),
+		Command:    binding([]string{"c"}, "run command"),
+		Group:      binding([]string{"T"}, "group by tag"),
+		GroupOwner: binding([]string{"O"}, "group by owner"),
+		Select:     binding([]string{" "}, "select"),
+		SystemSSH:  binding([]string{"S"}, "open in system ssh"),
+		Compact:    binding([]string{"v"}, "compact view"),
+		Admin:      binding([]string{"a"}, "admin commands"),
+		Help:       binding([]string{"?"}, "help"),
+	}
+}
+
+// LoadKeyMap returns the default bindings with those set in keys replacing them.
+func LoadKeyMap(keys config.Keys) KeyMap {
+	km := DefaultKeyMap()
+	override := func(b *key.Binding, keys []string) {
+		if len(keys) > 0 {
+			*b = binding(keys, b.Help().Desc)
+		}
+	}
+	override(&km.Choose, keys.Choose)
+	override(&km.Quit, keys.Quit)
+	override(&km.Refresh, keys.Refresh)
+	override(&km.Back, keys.Back)
+	override(&km.Detail, keys.Detail)
+	override(&km.Copy, keys.Copy)
+	override(&km.Test, keys.Test)
+	override(&km.Command, keys.Command)
+	override(&km.Group, keys.Group)
+	override(&km.GroupOwner, keys.GroupOwner)
+	override(&km.Select, keys.Select)
+	override(&km.SystemSSH, keys.SystemSSH)
+	override(&km.Compact, keys.Compact)
+	override(&km.Admin, keys.Admin)
+	override(&km.Help, keys.Help)
+	return km
+}
+
+func binding(keys []string, desc string) key.Binding {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		// bubbletea names the space bar " ", which would show as a blank in the help.
+		if k == " " {
+			k = "space"
+		}
+		names[i] = k
+	}
+	return key.NewBinding(
+		key.WithKeys(keys...),
+		key.WithHelp(strings.Join(names, "/"), desc),
+	)
+}
+
+// NavigationKeys returns the list bindings for moving around, and for filtering if it is enabled, which are not
+// configurable.
+func NavigationKeys(filtering bool) []key.Binding {
+	km := list.DefaultKeyMap()
+	keys := []key.Binding{km.CursorUp, km.CursorDown, km.PrevPage, km.NextPage, km.GoToStart, km.GoToEnd}
+	if filtering {
+		keys = append(keys, km.Filter, km.ClearFilter)
+	}
+	return keys
+}
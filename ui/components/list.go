@@ -1,11 +1,18 @@
 package ui
 
 import (
+	"io"
+	"slices"
+	"strings"
+
 	"github.com/acmacalister/tssh"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/paginator"
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 const (
@@ -13,39 +20,56 @@ const (
 	ellipsis = "…"
 )
 
-var (
-	appStyle = lipgloss.NewStyle().Padding(1, 2)
-
-	statusMessageStyle = lipgloss.NewStyle().
-				Foreground(lipgloss.AdaptiveColor{Light: "#04B575", Dark: "#04B575"}).
-				Render
+type ListItem struct {
+	Name    string
+	Info    string
+	Address string
+	// Addresses are every address of the item, which filtering by IP matches against.
+	Addresses []string
+	Action    tssh.Action
+	// Columns are the fields shown, aligned with those of the other items, when the list is laid out in columns.
+	Columns []string
+	// ID identifies the item across updates when its name may change, such as a device's ID. Items without one are
+	// identified by their name.
+	ID string
+}
 
-	delegateKeys = &listKeyMap{
-		choose: key.NewBinding(
-			key.WithKeys("enter"),
-			key.WithHelp("enter", "choose"),
-		),
-	}
-)
+func (i ListItem) Title() string       { return i.Name }
+func (i ListItem) Description() string { return i.Info }
 
-type (
-	listKeyMap struct {
-		choose key.Binding
+// key identifies the item across updates.
+func (i ListItem) key() string {
+	if i.ID != "" {
+		return i.ID
 	}
+	return i.Name
+}
 
-	ListItem struct {
-		Name   string
-		Info   string
-		Action tssh.Action
-	}
-)
+// equal reports whether i and o would be listed the same way.
+func (i ListItem) equal(o ListItem) bool {
+	return i.Name == o.Name && i.Info == o.Info && i.Address == o.Address && i.Action == o.Action && i.ID == o.ID &&
+		slices.Equal(i.Addresses, o.Addresses) && slices.Equal(i.Columns, o.Columns)
+}
 
-func (i ListItem) Title() string       { return i.Name }
-func (i ListItem) Description() string { return i.Info }
-func (i ListItem) FilterValue() string { return i.Name }
+// FilterValue returns the name followed by the addresses, one per line, for filterItems to match against.
+func (i ListItem) FilterValue() string {
+	return strings.Join(append([]string{i.Name}, i.Addresses...), "\n")
+}
 
 type ListModel struct {
-	list list.Model
+	list  list.Model
+	theme Theme
+	keys  KeyMap
+	// marked holds the names of the items marked for multi-select.
+	marked map[string]bool
+	// columns and compact are how items are laid out, see SetColumns and SetCompact.
+	columns bool
+	compact bool
+	// index is what the filter matches against, kept up to date with the items so typing a filter doesn't work
+	// it out again on every keystroke.
+	index *filterIndex
+	// reselect names the item to select once an active filter has been applied to items set by ReplaceItems.
+	reselect string
 }
 
 func (m *ListModel) Init() tea.Cmd {
@@ -64,21 +88,25 @@ func (m *ListModel) Update(msg tea.Msg) (*ListModel, tea.Cmd) {
 }
 
 func (m *ListModel) View() string {
-	return m.list.View()
+	return m.theme.App.Render(m.list.View())
 }
 
+// handleWindow sizes the list to fill the window inside the theme's padding.
 func (m *ListModel) handleWindow(msg tea.WindowSizeMsg) (*ListModel, tea.Cmd) {
 	var cmd tea.Cmd
-	h, v := appStyle.GetFrameSize()
-	m.list.SetSize(msg.Width-h, msg.Height-v)
+	h, v := m.theme.App.GetFrameSize()
+	m.list.SetSize(max(msg.Width-h, 0), max(msg.Height-v, 0))
 	m.list, cmd = m.list.Update(msg)
+	// the help is truncated to the list's width, but then indented by its style.
+	m.list.Help.Width = max(m.list.Width()-m.list.Styles.HelpStyle.GetHorizontalFrameSize(), 0)
 	return m, cmd
 }
 
 func (m *ListModel) handleKeyPress(msg tea.KeyMsg) (*ListModel, tea.Cmd) {
 	var cmd tea.Cmd
+	m.reselect = ""
 	switch {
-	case key.Matches(msg, delegateKeys.choose):
+	case key.Matches(msg, m.keys.Choose):
 		return m.handleChoose(msg)
 	default:
 		m.list, cmd = m.list.Update(msg)
@@ -93,12 +121,16 @@ func (m *ListModel) handleChoose(msg tea.KeyMsg) (*ListModel, tea.Cmd) {
 		return m, nil
 	}
 	m.list, cmd = m.list.Update(msg)
-	return m, tea.Batch(cmd, m.list.NewStatusMessage(statusMessageStyle("You chose "+i.Title())), m.selectedCmd)
+	return m, tea.Batch(cmd, m.StatusMessage("You chose "+i.Title()), m.selectedCmd)
 }
 
 func (m *ListModel) handleDefault(msg tea.Msg) (*ListModel, tea.Cmd) {
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
+	if _, ok := msg.(list.FilterMatchesMsg); ok && m.reselect != "" {
+		m.selectName(m.reselect)
+		m.reselect = ""
+	}
 	return m, cmd
 }
 
@@ -111,79 +143,322 @@ func (m *ListModel) selectedCmd() tea.Msg {
 	return i
 }
 
+// Selected returns the currently selected item, if any.
+func (m *ListModel) Selected() (ListItem, bool) {
+	i, ok := m.list.SelectedItem().(ListItem)
+	return i, ok
+}
+
+// IsFiltering reports whether the user is typing a filter, in which case key presses belong to the filter input.
+func (m *ListModel) IsFiltering() bool {
+	return m.list.FilterState() == list.Filtering
+}
+
+// Items returns the items in the list, in the order they are listed, ignoring any filter.
+func (m *ListModel) Items() []ListItem {
+	items := make([]ListItem, 0, len(m.list.Items()))
+	for _, item := range m.list.Items() {
+		if i, ok := item.(ListItem); ok {
+			items = append(items, i)
+		}
+	}
+	return items
+}
+
+// Len returns the number of items in the list, ignoring any filter.
+func (m *ListModel) Len() int {
+	return len(m.list.Items())
+}
+
+// Count returns how many items the filter leaves showing and how many there are in all. Items with no action,
+// such as section headers, aren't counted, and items listed more than once are only counted once.
+func (m *ListModel) Count() (visible, total int) {
+	return countItems(m.list.VisibleItems()), countItems(m.list.Items())
+}
+
+func countItems(items []list.Item) int {
+	seen := map[string]bool{}
+	for _, item := range items {
+		if i, ok := item.(ListItem); ok && i.Action != tssh.ActionNone {
+			seen[i.Name] = true
+		}
+	}
+	return len(seen)
+}
+
+// IsFiltered reports whether a filter is being typed or has been applied.
+func (m *ListModel) IsFiltered() bool {
+	return m.list.FilterState() != list.Unfiltered
+}
+
+// ResetFilter clears the filter and shows every item again.
+func (m *ListModel) ResetFilter() {
+	m.list.ResetFilter()
+}
+
+// SetTitle replaces the list's title.
+func (m *ListModel) SetTitle(title string) {
+	m.list.Title = title
+}
+
+// SetColumns switches between showing each item on a single line with its columns aligned, and the default of its
+// name above its info.
+func (m *ListModel) SetColumns(enabled bool) {
+	m.columns = enabled
+	m.setDelegate()
+}
+
+// SetCompact switches between showing each item on a single line without its info, and the default of its name
+// above its info. Lists laid out in columns are always on a single line.
+func (m *ListModel) SetCompact(enabled bool) {
+	m.compact = enabled
+	m.setDelegate()
+}
+
+// IsCompact reports whether the list is in the compact layout set with SetCompact.
+func (m *ListModel) IsCompact() bool {
+	return m.compact
+}
+
+// setDelegate lays the items out as SetColumns and SetCompact last asked for, keeping the selected item
+// selected even though a different number of items now fits on each page.
+func (m *ListModel) setDelegate() {
+	switch {
+	case m.columns:
+		m.list.SetDelegate(newColumnDelegate(m.theme, m.keys, m.marked))
+	case m.compact:
+		d := newDelegate(m.theme, m.keys)
+		d.ShowDescription = false
+		d.SetHeight(1)
+		d.SetSpacing(0)
+		m.list.SetDelegate(markDelegate{DefaultDelegate: d, marked: m.marked})
+	default:
+		m.list.SetDelegate(markDelegate{DefaultDelegate: newDelegate(m.theme, m.keys), marked: m.marked})
+	}
+	m.list.Select(m.list.Index())
+}
+
+// SetFilteringEnabled turns filtering the list on or off.
+func (m *ListModel) SetFilteringEnabled(enabled bool) {
+	m.list.SetFilteringEnabled(enabled)
+}
+
+// ToggleMarked marks the selected item, or unmarks it if it is already marked. Items with no action, such as
+// section headers, can't be marked.
+func (m *ListModel) ToggleMarked() {
+	i, ok := m.list.SelectedItem().(ListItem)
+	if !ok || i.Action == tssh.ActionNone {
+		return
+	}
+	if m.marked[i.Name] {
+		delete(m.marked, i.Name)
+	} else {
+		m.marked[i.Name] = true
+	}
+}
+
+// Marked returns the marked items in list order, ignoring any filter. Items listed more than once are only
+// returned once.
+func (m *ListModel) Marked() []ListItem {
+	var items []ListItem
+	seen := map[string]bool{}
+	for _, item := range m.list.Items() {
+		i, ok := item.(ListItem)
+		if !ok || !m.marked[i.Name] || seen[i.Name] {
+			continue
+		}
+		seen[i.Name] = true
+		items = append(items, i)
+	}
+	return items
+}
+
+// ClearMarked unmarks every item.
+func (m *ListModel) ClearMarked() {
+	for name := range m.marked {
+		delete(m.marked, name)
+	}
+}
+
+// SetHelpKeys adds bindings handled outside the list to its help footer.
+func (m *ListModel) SetHelpKeys(bindings ...key.Binding) {
+	m.list.AdditionalShortHelpKeys = func() []key.Binding { return bindings }
+	m.list.AdditionalFullHelpKeys = func() []key.Binding { return bindings }
+}
+
+// StatusMessage shows msg in the list's status bar for a short while.
+func (m *ListModel) StatusMessage(msg string) tea.Cmd {
+	return m.list.NewStatusMessage(lipgloss.NewStyle().Foreground(m.theme.Success).Render(msg))
+}
+
+// AppendItems adds items to the end of the list. An active filter is applied to them as well.
+func (m *ListModel) AppendItems(items ...ListItem) tea.Cmd {
+	listItems := m.list.Items()
+	added := make([]list.Item, 0, len(items))
+	for _, item := range items {
+		added = append(added, ListItem{Name: item.Name, Info: item.Info, Address: item.Address, Addresses: item.Addresses, Action: item.Action, Columns: item.Columns, ID: item.ID})
+	}
+	m.setIndex(m.index.with(added))
+	return m.list.SetItems(append(listItems, added...))
+}
+
+// StartSpinner shows the list's spinner next to its title, for while items are still loading.
+func (m *ListModel) StartSpinner() tea.Cmd {
+	return m.list.StartSpinner()
+}
+
+// SetSpinner sets the spinner style shown by StartSpinner.
+func (m *ListModel) SetSpinner(s spinner.Spinner) {
+	m.list.SetSpinner(s)
+}
+
+// StopSpinner hides the spinner shown by StartSpinner.
+func (m *ListModel) StopSpinner() {
+	m.list.StopSpinner()
+}
+
 func (m *ListModel) SetItems(items ...ListItem) tea.Cmd {
 	listItems := make([]list.Item, 0, len(items))
 	for _, item := range items {
-		listItems = append(listItems, ListItem{Name: item.Name, Info: item.Info, Action: item.Action})
+		listItems = append(listItems, ListItem{Name: item.Name, Info: item.Info, Address: item.Address, Addresses: item.Addresses, Action: item.Action, Columns: item.Columns, ID: item.ID})
 	}
 
+	m.setIndex(newFilterIndex(listItems))
 	return m.list.SetItems(listItems)
 }
 
-func itemStyles() (s list.DefaultItemStyles) {
+// UpdateItems brings the list's items up to date with items, disturbing the list as little as possible: nothing
+// happens if no item has changed, and items that only changed in place are updated where they are, which leaves
+// the selection, page and any filter as they were. Items added, removed or moved fall back to ReplaceItems.
+func (m *ListModel) UpdateItems(items ...ListItem) tea.Cmd {
+	current := m.list.Items()
+	if len(current) != len(items) {
+		return m.ReplaceItems(items...)
+	}
+	var changed []int
+	for i, item := range current {
+		old, ok := item.(ListItem)
+		if !ok || old.key() != items[i].key() {
+			return m.ReplaceItems(items...)
+		}
+		if !old.equal(items[i]) {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	listItems := make([]list.Item, len(items))
+	for i, item := range items {
+		listItems[i] = ListItem{Name: item.Name, Info: item.Info, Address: item.Address, Addresses: item.Addresses, Action: item.Action, Columns: item.Columns, ID: item.ID}
+	}
+	m.setIndex(newFilterIndex(listItems))
+	// each SetItem refilters an active filter, and the last of those filters sees every change.
+	var cmd tea.Cmd
+	for _, i := range changed {
+		cmd = m.list.SetItem(i, listItems[i])
+	}
+	return cmd
+}
+
+// ReplaceItems replaces the list's items like SetItems, but keeps the selected item selected if it is still listed,
+// including once an active filter has been applied to the new items.
+func (m *ListModel) ReplaceItems(items ...ListItem) tea.Cmd {
+	selected, ok := m.Selected()
+	cmd := m.SetItems(items...)
+	if !ok {
+		return cmd
+	}
+	if m.IsFiltered() {
+		// the filter is applied by cmd, after which handleDefault selects the item.
+		m.reselect = selected.Name
+		return cmd
+	}
+	m.selectName(selected.Name)
+	return cmd
+}
+
+// selectName selects the first visible item named name, if there is one.
+func (m *ListModel) selectName(name string) {
+	for index, item := range m.list.VisibleItems() {
+		if i, ok := item.(ListItem); ok && i.Name == name {
+			m.list.Select(index)
+			return
+		}
+	}
+}
+
+// setIndex filters the list with index, which must be of the items about to be set.
+func (m *ListModel) setIndex(index *filterIndex) {
+	m.index = index
+	m.list.Filter = index.filter
+}
+
+func itemStyles(t Theme) (s list.DefaultItemStyles) {
 	s.NormalTitle = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}).
+		Foreground(t.Text).
 		Padding(0, 0, 0, 2)
 
 	s.NormalDesc = s.NormalTitle.Copy().
-		Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"})
+		Foreground(t.Muted)
 
 	s.SelectedTitle = lipgloss.NewStyle().
 		Border(lipgloss.NormalBorder(), false, false, false, true).
-		BorderForeground(lipgloss.AdaptiveColor{Light: "69", Dark: "69"}).
-		Foreground(lipgloss.AdaptiveColor{Light: "69", Dark: "69"}).
+		BorderForeground(t.Accent).
+		Foreground(t.Accent).
 		Padding(0, 0, 0, 1)
 
 	s.SelectedDesc = s.SelectedTitle.Copy().
-		Foreground(lipgloss.AdaptiveColor{Light: "69", Dark: "69"})
+		Foreground(t.Accent)
 
 	s.DimmedTitle = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}).
+		Foreground(t.Muted).
 		Padding(0, 0, 0, 2)
 
 	s.DimmedDesc = s.DimmedTitle.Copy().
-		Foreground(lipgloss.AdaptiveColor{Light: "#C2B8C2", Dark: "#4D4D4D"})
+		Foreground(t.Faint)
 
 	s.FilterMatch = lipgloss.NewStyle().Underline(true)
 
 	return s
 }
 
-func styles() (s list.Styles) {
-	verySubduedColor := lipgloss.AdaptiveColor{Light: "#DDDADA", Dark: "#3C3C3C"}
-	subduedColor := lipgloss.AdaptiveColor{Light: "#9B9B9B", Dark: "#5C5C5C"}
+func styles(t Theme) (s list.Styles) {
+	verySubduedColor := t.VerySubdued
+	subduedColor := t.Subdued
 
 	s.TitleBar = lipgloss.NewStyle().Padding(0, 0, 1, 2)
 
 	s.Title = lipgloss.NewStyle().
 		//Background(lipgloss.Color("62")).
-		Foreground(lipgloss.Color("230")).
+		Foreground(t.Title).
 		Padding(0, 1)
 
 	s.Spinner = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#8E8E8E", Dark: "#747373"})
+		Foreground(t.Muted)
 
 	s.FilterPrompt = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "69", Dark: "69"})
+		Foreground(t.Accent)
 
 	s.FilterCursor = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "69", Dark: "69"})
+		Foreground(t.Accent)
 
 	s.DefaultFilterCharacterMatch = lipgloss.NewStyle().Underline(true)
 
 	s.StatusBar = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}).
+		Foreground(t.Muted).
 		Padding(0, 0, 1, 2)
 
 	s.StatusEmpty = lipgloss.NewStyle().Foreground(subduedColor)
 
 	s.StatusBarActiveFilter = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
+		Foreground(t.Text)
 
 	s.StatusBarFilterCount = lipgloss.NewStyle().Foreground(verySubduedColor)
 
 	s.NoItems = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#909090", Dark: "#626262"})
+		Foreground(t.Subdued)
 
 	s.ArabicPagination = lipgloss.NewStyle().Foreground(subduedColor)
 
@@ -192,7 +467,7 @@ func styles() (s list.Styles) {
 	s.HelpStyle = lipgloss.NewStyle().Padding(1, 0, 0, 2)
 
 	s.ActivePaginationDot = lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#847A85", Dark: "#979797"}).
+		Foreground(t.Muted).
 		SetString(bullet)
 
 	s.InactivePaginationDot = lipgloss.NewStyle().
@@ -206,31 +481,60 @@ func styles() (s list.Styles) {
 	return s
 }
 
-func newDelegate() list.DefaultDelegate {
+func newDelegate(t Theme, keys KeyMap) list.DefaultDelegate {
 	d := list.DefaultDelegate{
 		ShowDescription: true,
-		Styles:          itemStyles(),
+		Styles:          itemStyles(t),
+		ShortHelpFunc:   func() []key.Binding { return []key.Binding{keys.Choose} },
+		FullHelpFunc:    func() [][]key.Binding { return [][]key.Binding{{keys.Choose}} },
 	}
 	d.SetHeight(2)
 	d.SetSpacing(1)
 	return d
 }
 
-func NewList(title string, items ...ListItem) *ListModel {
+// markDelegate renders marked items with a check mark after their title.
+type markDelegate struct {
+	list.DefaultDelegate
+	marked map[string]bool
+}
+
+// markedItem is a ListItem shown as marked. The mark goes after the name so that filter matches, which are
+// highlighted by position, still line up.
+type markedItem struct{ ListItem }
+
+func (i markedItem) Title() string { return i.Name + " ✓" }
+
+func (d markDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if i, ok := item.(ListItem); ok && d.marked[i.Name] {
+		item = markedItem{i}
+	}
+	d.DefaultDelegate.Render(w, m, index, item)
+}
+
+func NewList(title string, theme Theme, keys KeyMap, items ...ListItem) *ListModel {
 	listItems := make([]list.Item, 0)
 	if len(items) > 0 {
 		listItems = make([]list.Item, 0, len(items))
 		for _, item := range items {
-			listItems = append(listItems, ListItem{Name: item.Name, Info: item.Info, Action: item.Action})
+			listItems = append(listItems, ListItem{Name: item.Name, Info: item.Info, Address: item.Address, Addresses: item.Addresses, Action: item.Action, Columns: item.Columns, ID: item.ID})
 		}
 	}
 
-	d := newDelegate()
+	marked := map[string]bool{}
+	d := markDelegate{DefaultDelegate: newDelegate(theme, keys), marked: marked}
 	l := list.New(listItems, d, 40, 20)
 	l.Title = title
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
 	l.ShowFilter()
-	l.Styles = styles()
-	return &ListModel{list: l}
+	l.Styles = styles(theme)
+	// the page dots are told apart only by color, so without it the page is given as a number.
+	if lipgloss.ColorProfile() == termenv.Ascii {
+		l.Paginator.Type = paginator.Arabic
+	}
+	l.KeyMap.Quit = keys.Quit
+	m := &ListModel{list: l, theme: theme, keys: keys, marked: marked}
+	m.setIndex(newFilterIndex(listItems))
+	return m
 }
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func newTestList(t *testing.T, items ...ListItem) *ListModel {
+	t.Helper()
+	theme, err := LoadTheme("dark", config.Colors{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewList("Devices", theme, DefaultKeyMap(), items...)
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	return m
+}
+
+// applyFilterMatches runs cmd, which may be a batch, and passes the list the filter matches it produces. The other
+// commands, such as the filter input's cursor blinking, are left to finish on their own.
+func applyFilterMatches(t *testing.T, m *ListModel, cmd tea.Cmd) {
+	t.Helper()
+	msgs := make(chan tea.Msg, 16)
+	var run func(tea.Cmd)
+	run = func(cmd tea.Cmd) {
+		if cmd == nil {
+			return
+		}
+		go func() {
+			msg := cmd()
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, cmd := range batch {
+					run(cmd)
+				}
+				return
+			}
+			select {
+			case msgs <- msg:
+			default:
+			}
+		}()
+	}
+	run(cmd)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-msgs:
+			if matches, ok := msg.(list.FilterMatchesMsg); ok {
+				m.Update(matches)
+				return
+			}
+		case <-timeout:
+			t.Fatal("the filter was never applied")
+		}
+	}
+}
+
+// filter types term into the list's filter and accepts it.
+func filter(t *testing.T, m *ListModel, term string) {
+	t.Helper()
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(term)})
+	applyFilterMatches(t, m, cmd)
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.IsFiltered() {
+		t.Fatalf("filter %q wasn't applied", term)
+	}
+}
+
+func selectedName(m *ListModel) string {
+	selected, _ := m.Selected()
+	return selected.Name
+}
+
+// testListItems returns devices as the device list lists them.
+func testListItems() []ListItem {
+	return []ListItem{
+		{Name: "web-1", Info: "online", ID: "1", Action: tssh.ActionDeviceSSH},
+		{Name: "db-1", Info: "online", ID: "2", Action: tssh.ActionDeviceSSH},
+		{Name: "web-2", Info: "online", ID: "3", Action: tssh.ActionDeviceSSH},
+	}
+}
+
+func TestUpdateItems(t *testing.T) {
+	items := testListItems()
+	m := newTestList(t, items...)
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if selectedName(m) != "db-1" {
+		t.Fatalf("selected %q, want db-1", selectedName(m))
+	}
+
+	if cmd := m.UpdateItems(items...); cmd != nil {
+		t.Errorf("UpdateItems with nothing changed returned a command")
+	}
+
+	updated := append([]ListItem(nil), items...)
+	updated[1].Info = "offline"
+	m.UpdateItems(updated...)
+	if got := m.Items()[1].Info; got != "offline" {
+		t.Errorf("db-1 info = %q, want it updated in place", got)
+	}
+	if selectedName(m) != "db-1" {
+		t.Errorf("selected %q after an update in place, want db-1 still", selectedName(m))
+	}
+
+	// a renamed item is the same item, keeping its place.
+	renamed := append([]ListItem(nil), updated...)
+	renamed[0].Name = "www-1"
+	m.UpdateItems(renamed...)
+	if m.Items()[0].Name != "www-1" || selectedName(m) != "db-1" {
+		t.Errorf("items = %v selecting %q, want web-1 renamed in place and db-1 still selected", m.Items(), selectedName(m))
+	}
+
+	// items added ahead of the selection move it, but it stays on the same item.
+	added := append([]ListItem{{Name: "cache-1", ID: "4", Action: tssh.ActionDeviceSSH}, {Name: "cache-2", ID: "5", Action: tssh.ActionDeviceSSH}}, renamed...)
+	m.UpdateItems(added...)
+	if len(m.Items()) != 5 || selectedName(m) != "db-1" {
+		t.Errorf("%d items selecting %q, want 5 with db-1 still selected", len(m.Items()), selectedName(m))
+	}
+}
+
+func TestUpdateItemsFiltered(t *testing.T) {
+	items := testListItems()
+	m := newTestList(t, items...)
+	filter(t, m, "web")
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	selected := selectedName(m)
+	if visible, _ := m.Count(); visible != 2 {
+		t.Fatalf("%d items visible, want the 2 web servers", visible)
+	}
+
+	updated := append([]ListItem(nil), items...)
+	updated[0].Info, updated[2].Info = "offline", "offline"
+	applyFilterMatches(t, m, m.UpdateItems(updated...))
+	if !m.IsFiltered() {
+		t.Fatal("the filter was reset by an update in place")
+	}
+	if visible, _ := m.Count(); visible != 2 {
+		t.Errorf("%d items visible, want the 2 web servers still", visible)
+	}
+	if selectedName(m) != selected {
+		t.Errorf("selected %q after an update in place, want %q still", selectedName(m), selected)
+	}
+	for _, item := range m.list.VisibleItems() {
+		if info := item.(ListItem).Info; info != "offline" {
+			t.Errorf("%s info = %q, want the filtered items updated", item.(ListItem).Name, info)
+		}
+	}
+
+	// a removed item falls back to replacing the items, reselecting the same one once the filter is applied.
+	removed := []ListItem{updated[0], updated[2]}
+	applyFilterMatches(t, m, m.UpdateItems(removed...))
+	if !m.IsFiltered() || selectedName(m) != selected {
+		t.Errorf("selected %q, filtered %v after removing an item, want %q still selected through the filter", selectedName(m), m.IsFiltered(), selected)
+	}
+}
+
+func TestListPadding(t *testing.T) {
+	items := make([]ListItem, 50)
+	for i := range items {
+		items[i] = ListItem{Name: fmt.Sprintf("host-%d", i), Info: "100.64.0.1 • linux • online", Action: tssh.ActionDeviceSSH}
+	}
+	const width, height = 80, 30
+	for _, test := range []struct {
+		padding               []int
+		listWidth, listHeight int
+	}{
+		{padding: nil, listWidth: 80, listHeight: 30},
+		{padding: []int{0}, listWidth: 80, listHeight: 30},
+		{padding: []int{1, 2}, listWidth: 76, listHeight: 28},
+		{padding: []int{1, 2, 3}, listWidth: 76, listHeight: 26},
+		{padding: []int{4, 10}, listWidth: 60, listHeight: 22},
+		// padding bigger than the window leaves the list no room rather than a negative size.
+		{padding: []int{20, 50}, listWidth: 0, listHeight: 0},
+	} {
+		theme, err := LoadTheme("dark", config.Colors{}, test.padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := NewList("Devices", theme, DefaultKeyMap(), items...)
+		m.Update(tea.WindowSizeMsg{Width: width, Height: height})
+		if m.list.Width() != test.listWidth || m.list.Height() != test.listHeight {
+			t.Errorf("padding %v: list is %dx%d, want %dx%d", test.padding, m.list.Width(), m.list.Height(), test.listWidth, test.listHeight)
+		}
+		if test.listWidth == 0 {
+			continue
+		}
+		view := m.View()
+		if w, h := lipgloss.Width(view), lipgloss.Height(view); w > width || h > height {
+			t.Errorf("padding %v: view is %dx%d, want it to fit in %dx%d", test.padding, w, h, width, height)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+)
+
+// DefaultSpinner is the name of the spinner used when none is configured.
+const DefaultSpinner = "points"
+
+// Spinners are the built-in spinner styles, by name.
+var Spinners = map[string]spinner.Spinner{
+	"line":      spinner.Line,
+	"dot":       spinner.Dot,
+	"minidot":   spinner.MiniDot,
+	"jump":      spinner.Jump,
+	"pulse":     spinner.Pulse,
+	"points":    spinner.Points,
+	"globe":     spinner.Globe,
+	"moon":      spinner.Moon,
+	"monkey":    spinner.Monkey,
+	"meter":     spinner.Meter,
+	"hamburger": spinner.Hamburger,
+}
+
+// LoadSpinner returns the built-in spinner with the given name, ignoring case.
+func LoadSpinner(name string) (spinner.Spinner, error) {
+	if name == "" {
+		name = DefaultSpinner
+	}
+	s, ok := Spinners[strings.ToLower(name)]
+	if !ok {
+		return spinner.Spinner{}, fmt.Errorf("unknown spinner style %q, expected one of %s", name, strings.Join(SpinnerNames(), ", "))
+	}
+	return s, nil
+}
+
+// SpinnerNames returns the names of the built-in spinners in alphabetical order.
+func SpinnerNames() []string {
+	names := make([]string, 0, len(Spinners))
+	for name := range Spinners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
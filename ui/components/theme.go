@@ -0,0 +1,149 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/acmacalister/tssh/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// DefaultTheme is the name of the theme used when none is configured.
+const DefaultTheme = "adaptive"
+
+// Theme holds the colors the UI is rendered with.
+type Theme struct {
+	Accent      lipgloss.TerminalColor // selection, filter prompt, spinner and informational text
+	Success     lipgloss.TerminalColor // status messages
+	Title       lipgloss.TerminalColor // list titles
+	Text        lipgloss.TerminalColor // item titles
+	Muted       lipgloss.TerminalColor // item descriptions, dimmed titles and the status bar
+	Faint       lipgloss.TerminalColor // dimmed descriptions and empty list text
+	Subdued     lipgloss.TerminalColor // pagination and empty status
+	VerySubdued lipgloss.TerminalColor // inactive pagination dots and dividers
+	App         lipgloss.Style         // the padding around lists and panes, set by LoadTheme
+}
+
+// Themes are the built-in themes, by name.
+var Themes = map[string]Theme{
+	"adaptive": {
+		Accent:      lipgloss.AdaptiveColor{Light: "69", Dark: "69"},
+		Success:     lipgloss.AdaptiveColor{Light: "#04B575", Dark: "#04B575"},
+		Title:       lipgloss.Color("230"),
+		Text:        lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"},
+		Muted:       lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"},
+		Faint:       lipgloss.AdaptiveColor{Light: "#C2B8C2", Dark: "#4D4D4D"},
+		Subdued:     lipgloss.AdaptiveColor{Light: "#9B9B9B", Dark: "#5C5C5C"},
+		VerySubdued: lipgloss.AdaptiveColor{Light: "#DDDADA", Dark: "#3C3C3C"},
+	},
+	"dark": {
+		Accent:      lipgloss.Color("69"),
+		Success:     lipgloss.Color("#04B575"),
+		Title:       lipgloss.Color("230"),
+		Text:        lipgloss.Color("#dddddd"),
+		Muted:       lipgloss.Color("#777777"),
+		Faint:       lipgloss.Color("#4D4D4D"),
+		Subdued:     lipgloss.Color("#5C5C5C"),
+		VerySubdued: lipgloss.Color("#3C3C3C"),
+	},
+	"light": {
+		Accent:      lipgloss.Color("63"),
+		Success:     lipgloss.Color("#028A56"),
+		Title:       lipgloss.Color("#1a1a1a"),
+		Text:        lipgloss.Color("#1a1a1a"),
+		Muted:       lipgloss.Color("#A49FA5"),
+		Faint:       lipgloss.Color("#C2B8C2"),
+		Subdued:     lipgloss.Color("#9B9B9B"),
+		VerySubdued: lipgloss.Color("#DDDADA"),
+	},
+	"high-contrast": {
+		Accent:      lipgloss.Color("11"),
+		Success:     lipgloss.Color("10"),
+		Title:       lipgloss.Color("15"),
+		Text:        lipgloss.Color("15"),
+		Muted:       lipgloss.Color("7"),
+		Faint:       lipgloss.Color("7"),
+		Subdued:     lipgloss.Color("7"),
+		VerySubdued: lipgloss.Color("8"),
+	},
+}
+
+// ansiThemes are the built-in themes for terminals with only the 16 ANSI colors, by name. The closest ANSI color to
+// each of the themes' own turns the greys black, which vanishes on a dark background. The high contrast theme is
+// already made of ANSI colors.
+var ansiThemes = map[string]Theme{
+	"adaptive": {
+		Accent:      lipgloss.AdaptiveColor{Light: "4", Dark: "12"},
+		Success:     lipgloss.Color("2"),
+		Title:       lipgloss.AdaptiveColor{Light: "0", Dark: "15"},
+		Text:        lipgloss.AdaptiveColor{Light: "0", Dark: "7"},
+		Muted:       lipgloss.Color("8"),
+		Faint:       lipgloss.Color("8"),
+		Subdued:     lipgloss.Color("8"),
+		VerySubdued: lipgloss.AdaptiveColor{Light: "7", Dark: "8"},
+	},
+	"dark": {
+		Accent:      lipgloss.Color("12"),
+		Success:     lipgloss.Color("2"),
+		Title:       lipgloss.Color("15"),
+		Text:        lipgloss.Color("7"),
+		Muted:       lipgloss.Color("8"),
+		Faint:       lipgloss.Color("8"),
+		Subdued:     lipgloss.Color("8"),
+		VerySubdued: lipgloss.Color("8"),
+	},
+	"light": {
+		Accent:      lipgloss.Color("4"),
+		Success:     lipgloss.Color("2"),
+		Title:       lipgloss.Color("0"),
+		Text:        lipgloss.Color("0"),
+		Muted:       lipgloss.Color("8"),
+		Faint:       lipgloss.Color("8"),
+		Subdued:     lipgloss.Color("8"),
+		VerySubdued: lipgloss.Color("7"),
+	},
+}
+
+// LoadTheme returns the built-in theme with the given name, with any color overrides applied and padding, as
+// lipgloss.Style.Padding takes it, around lists and panes. Terminals lipgloss renders with only the 16 ANSI
+// colors get the theme's ANSI version.
+func LoadTheme(name string, overrides config.Colors, padding []int) (Theme, error) {
+	if name == "" {
+		name = DefaultTheme
+	}
+	t, ok := Themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+	if ansi, ok := ansiThemes[name]; ok && lipgloss.ColorProfile() == termenv.ANSI {
+		t = ansi
+	}
+
+	override := func(c *lipgloss.TerminalColor, v string) {
+		if v != "" {
+			*c = lipgloss.Color(v)
+		}
+	}
+	override(&t.Accent, overrides.Accent)
+	override(&t.Success, overrides.Success)
+	override(&t.Title, overrides.Title)
+	override(&t.Text, overrides.Text)
+	override(&t.Muted, overrides.Muted)
+	override(&t.Faint, overrides.Faint)
+	override(&t.Subdued, overrides.Subdued)
+	override(&t.VerySubdued, overrides.VerySubdued)
+	t.App = lipgloss.NewStyle().Padding(padding...)
+	return t, nil
+}
+
+// ThemeNames returns the names of the built-in themes in alphabetical order.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
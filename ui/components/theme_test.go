@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/acmacalister/tssh/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// withColorProfile renders with profile for the rest of the test.
+func withColorProfile(t *testing.T, profile termenv.Profile) {
+	before := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(profile)
+	t.Cleanup(func() { lipgloss.SetColorProfile(before) })
+}
+
+func TestLoadThemeANSI(t *testing.T) {
+	withColorProfile(t, termenv.ANSI)
+	for name := range Themes {
+		theme, err := LoadTheme(name, config.Colors{Accent: "5"}, nil)
+		if err != nil {
+			t.Fatalf("LoadTheme(%q): %v", name, err)
+		}
+		if theme.Accent != lipgloss.Color("5") {
+			t.Errorf("%s: accent = %v, want the override", name, theme.Accent)
+		}
+		for _, c := range []lipgloss.TerminalColor{theme.Title, theme.Text, theme.Muted, theme.Faint, theme.Subdued, theme.VerySubdued} {
+			if !isANSI(c) {
+				t.Errorf("%s: color %v isn't one of the 16 ANSI colors", name, c)
+			}
+		}
+	}
+}
+
+func TestLoadThemeTrueColor(t *testing.T) {
+	withColorProfile(t, termenv.TrueColor)
+	theme, err := LoadTheme("dark", config.Colors{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Muted != Themes["dark"].Muted {
+		t.Errorf("muted = %v, want the theme's own %v", theme.Muted, Themes["dark"].Muted)
+	}
+}
+
+// isANSI reports whether c is one of the 16 ANSI colors, on both light and dark backgrounds.
+func isANSI(c lipgloss.TerminalColor) bool {
+	ansi := func(s string) bool {
+		n, err := strconv.Atoi(s)
+		return err == nil && n >= 0 && n < 16
+	}
+	switch c := c.(type) {
+	case lipgloss.Color:
+		return ansi(string(c))
+	case lipgloss.AdaptiveColor:
+		return ansi(c.Light) && ansi(c.Dark)
+	}
+	return false
+}
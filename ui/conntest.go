@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// connTestStep is one stage of a connection test and how long it took.
+	connTestStep struct {
+		name    string
+		latency time.Duration
+		err     error
+	}
+
+	// connTestResult is the outcome of testing the connection to a device without opening a session.
+	connTestResult struct {
+		hostname string
+		steps    []connTestStep
+	}
+)
+
+// ok reports whether every step of the test succeeded.
+func (r connTestResult) ok() bool {
+	for _, step := range r.steps {
+		if step.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// testConnection returns a command that resolves hostname, dials its SSH port and, if test_auth is set,
+// authenticates, stopping at the first step that fails. Devices behind jump hosts or a proxy command are tested
+// by connecting through the whole chain, which always authenticates.
+func (m *mainModel) testConnection(hostname string) tea.Cmd {
+	cfg := *m.cfg
+	t, targetErr := m.target(hostname)
+
+	return func() tea.Msg {
+		result := connTestResult{hostname: hostname}
+		step := func(name string, fn func() error) bool {
+			start := time.Now()
+			err := fn()
+			result.steps = append(result.steps, connTestStep{name: name, latency: time.Since(start), err: err})
+			return err == nil
+		}
+		clientConfig := t.clientConfig(cfg.ConnectTimeout)
+		addr := t.addr
+
+		if targetErr != nil || len(t.hops) > 0 || t.subnet != nil || t.proxyCommand != "" {
+			name := "connect via jump hosts"
+			if t.proxyCommand != "" {
+				name = "connect via proxy command"
+			}
+			step(name, func() error {
+				if targetErr != nil {
+					return targetErr
+				}
+				hops, err := t.jumpHosts()
+				if err != nil {
+					return err
+				}
+				_, closeClients, err := dialChain(t.dialer(cfg.ConnectTimeout), hops, addr, clientConfig)
+				if err != nil {
+					return err
+				}
+				return closeClients()
+			})
+			return result
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if cfg.ConnectTimeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+		}
+		defer cancel()
+
+		if !step("resolve", func() error {
+			_, err := net.DefaultResolver.LookupHost(ctx, hostname)
+			return err
+		}) {
+			return result
+		}
+
+		var conn net.Conn
+		if !step("tcp dial "+addr, func() error {
+			var err error
+			conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			return err
+		}) {
+			return result
+		}
+		defer conn.Close()
+
+		if cfg.TestAuth {
+			step("authenticate as "+t.user, func() error {
+				if deadline, ok := ctx.Deadline(); ok {
+					conn.SetDeadline(deadline)
+				}
+				sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+				if err != nil {
+					return err
+				}
+				return ssh.NewClient(sshConn, chans, reqs).Close()
+			})
+		}
+		return result
+	}
+}
+
+func (m mainModel) connTestView() string {
+	r := m.connTest
+	good := lipgloss.NewStyle().Foreground(m.theme.Success).Render
+	bad := lipgloss.NewStyle().Foreground(m.theme.Accent).Render
+	muted := lipgloss.NewStyle().Foreground(m.theme.Muted).Render
+
+	summary := good(r.hostname + " is reachable")
+	if !r.ok() {
+		summary = bad(r.hostname + " is not reachable")
+	}
+
+	lines := []string{summary, ""}
+	for _, step := range r.steps {
+		latency := muted(step.latency.Round(time.Millisecond).String())
+		if step.err != nil {
+			lines = append(lines, fmt.Sprintf("%s %s %s", bad("✗"), step.name, latency), "  "+bad(strings.TrimSpace(step.err.Error())))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", good("✓"), step.name, latency))
+	}
+	back := m.keys.Back.Help()
+	lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key+" "+back.Desc))
+
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
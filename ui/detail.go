@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/ui/internal/reltime"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// pane renders content with the theme's padding, wrapped to the terminal's width once it is known.
+func (m mainModel) pane(content string) string {
+	if m.width <= 0 {
+		return m.theme.App.Render(content)
+	}
+	return m.theme.App.Copy().Width(m.width).Render(content)
+}
+
+// inputWidth is how wide the value of a text input with prompt can be in a pane before it scrolls.
+func (m mainModel) inputWidth(prompt string) int {
+	// one column is left for the cursor.
+	return max(m.width-m.theme.App.GetHorizontalFrameSize()-lipgloss.Width(prompt)-1, 0)
+}
+
+// outputSize is how big command output can be in a pane, below its header and above its footer, each followed or
+// preceded by a blank line.
+func (m mainModel) outputSize() (width, height int) {
+	h, v := m.theme.App.GetFrameSize()
+	return max(m.width-h, 0), max(m.height-v-4, 0)
+}
+
+// selectedDevice returns the device behind the selected device list item.
+func (m *mainModel) selectedDevice() (tailscale.Device, bool) {
+	item, ok := m.deviceList.Selected()
+	if !ok {
+		return tailscale.Device{}, false
+	}
+	for _, device := range m.devices {
+		if device.Hostname == item.Name && deviceAddress(device) == item.Address {
+			return device, true
+		}
+	}
+	return tailscale.Device{}, false
+}
+
+func (m mainModel) detailView() string {
+	d := m.detail
+	label := lipgloss.NewStyle().Foreground(m.theme.Muted).Width(12).Render
+	value := lipgloss.NewStyle().Foreground(m.theme.Text).Render
+
+	rows := [][2]string{
+		{"Name", d.Name},
+		{"Addresses", strings.Join(d.Addresses, ", ")},
+		{"OS", d.OS},
+		{"User", d.User},
+		{"Tags", strings.Join(d.Tags, ", ")},
+		{"Version", d.ClientVersion},
+		{"Last seen", lastSeen(d.LastSeen.Time, time.Now())},
+		{"Key expiry", keyExpiry(d)},
+		{"Exit node", m.exitNodeDetail()},
+		{"Routes", m.routesDetail()},
+		{"Connection", m.connectionDetail()},
+	}
+
+	lines := []string{lipgloss.NewStyle().Foreground(m.theme.Title).Bold(true).Render(d.Hostname), ""}
+	for _, row := range rows {
+		lines = append(lines, label(row[0])+value(row[1]))
+	}
+	help := m.keys.Back.Help()
+	lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(help.Key+" "+help.Desc))
+
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+// exitNodeDetail describes whether the device in detail is an exit node, or why that isn't known.
+func (m mainModel) exitNodeDetail() string {
+	r, ok := m.routes[m.detail.ID]
+	switch {
+	case !ok:
+		return "loading…"
+	case r.err != nil:
+		return "unavailable: " + r.err.Error()
+	case r.exitNode() == "":
+		return "no"
+	case r.exitNode() == "exit node":
+		return "yes"
+	default:
+		return "offered, not approved"
+	}
+}
+
+// routesDetail lists the subnet routes the device in detail advertises.
+func (m mainModel) routesDetail() string {
+	r, ok := m.routes[m.detail.ID]
+	switch {
+	case !ok:
+		return "loading…"
+	case r.err != nil:
+		return "unavailable"
+	case len(r.subnets()) == 0:
+		return "none"
+	default:
+		return strings.Join(r.subnets(), ", ")
+	}
+}
+
+func keyExpiry(d tailscale.Device) string {
+	if d.KeyExpiryDisabled {
+		return "disabled"
+	}
+	return formatTime(d.Expires.Time)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.RFC1123)
+}
+
+// lastSeen formats t in full followed by how long ago it was.
+func lastSeen(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s)", formatTime(t), reltime.LastSeen(t, now, tssh.OnlineThreshold))
+}
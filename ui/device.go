@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// keyExpiryWarning returns a warning marker for devices whose node key has expired or expires within the
+// given window, or an empty string if the key is fine or never expires.
+func keyExpiryWarning(device tailscale.Device, now time.Time, within time.Duration) string {
+	if device.KeyExpiryDisabled || device.Expires.IsZero() {
+		return ""
+	}
+
+	remaining := device.Expires.Sub(now)
+	switch {
+	case remaining <= 0:
+		return "⚠ key expired"
+	case remaining <= within:
+		return fmt.Sprintf("⚠ key expires in %dd", int(math.Ceil(remaining.Hours()/24)))
+	default:
+		return ""
+	}
+}
+
+// deviceAddress returns the device's first Tailscale address, which is its IPv4 address when it has one.
+func deviceAddress(device tailscale.Device) string {
+	if len(device.Addresses) == 0 {
+		return ""
+	}
+	return device.Addresses[0]
+}
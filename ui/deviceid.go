@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// deviceResolved is sent once the device given to WithDeviceID has been looked up.
+type deviceResolved struct {
+	id     string
+	device *tailscale.Device
+	err    error
+}
+
+// WithDeviceID opens a shell on the device with the given ID as soon as the UI starts, leaving the UI at the main
+// menu once the session ends. The device is reached by its Tailscale address rather than its hostname, which
+// may have changed or be shared with another device.
+func WithDeviceID(id string) Option {
+	return func(m *mainModel) {
+		m.deviceID = id
+	}
+}
+
+// WithHost opens a shell on host as soon as the UI starts, like WithDeviceID, for hosts that aren't in the device
+// list, such as those only reachable through a subnet router.
+func WithHost(host string) Option {
+	return func(m *mainModel) {
+		m.host = host
+	}
+}
+
+// resolveDevice returns a command that looks up the device with the given ID.
+func (m *mainModel) resolveDevice(id string) tea.Cmd {
+	m.retry = retryAction{what: "looking up device " + id, run: func() tea.Cmd { return m.resolveDevice(id) }}
+	ts, timeout := m.ts, m.cfg.APITimeout
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		device, err := ts.DeviceByID(ctx, id)
+		return deviceResolved{id: id, device: device, err: err}
+	}
+}
+
+func (m *mainModel) handleDeviceResolved(msg deviceResolved) (*mainModel, tea.Cmd) {
+	if msg.err == nil && deviceAddress(*msg.device) == "" {
+		msg.err = fmt.Errorf("device %s has no Tailscale address", msg.id)
+	}
+	if msg.err != nil {
+		m.logger.Error("looking up device failed", "action", "ssh", "device", msg.id, "error", msg.err)
+		m.err = msg.err
+		m.state = stateFailure
+		return m, nil
+	}
+	address := deviceAddress(*msg.device)
+	m.logger.Info("device looked up", "action", "ssh", "device", msg.id, "hostname", msg.device.Hostname, "addr", address)
+	return m, m.sshDevice(address)
+}
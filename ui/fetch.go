@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/acmacalister/tssh/ui/internal/reltime"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// errFetchTimeout is shown when no devices arrive within fetch_timeout.
+var errFetchTimeout = errors.New("device fetch timed out")
+
+type (
+	// deviceProgress carries the devices received since the previous update while fetching. msgs delivers the next
+	// update or, once the fetch is done, the Result.
+	deviceProgress struct {
+		fetch   int
+		devices []tailscale.Device
+		msgs    <-chan tea.Msg
+	}
+
+	// fetchState tracks the device fetch in flight so that it can be canceled.
+	fetchState struct {
+		id     int
+		cancel context.CancelFunc
+	}
+
+	// fetchTimedOut is sent by the fetch watchdog once fetch_timeout has passed.
+	fetchTimedOut struct {
+		fetch int
+	}
+
+	// fetchCanceled is sent instead of a Result by a fetch that was canceled.
+	fetchCanceled struct{}
+)
+
+// startFetch cancels any fetch in flight and starts fetching devices, along with a watchdog that fails the fetch
+// if no devices have arrived after fetch_timeout.
+func (m *mainModel) startFetch() tea.Cmd {
+	m.stopFetch()
+	m.fetch.id++
+	m.retry = retryAction{what: "fetching devices", run: m.startFetch}
+	m.state = stateLoading
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if m.cfg.APITimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), m.cfg.APITimeout)
+	}
+	m.fetch.cancel = cancel
+
+	cmds := []tea.Cmd{m.fetchDevices(ctx, m.fetch.id), m.fetchLocalStatus()}
+	if m.cfg.FetchTimeout > 0 {
+		id := m.fetch.id
+		cmds = append(cmds, tea.Tick(m.cfg.FetchTimeout, func(time.Time) tea.Msg {
+			return fetchTimedOut{fetch: id}
+		}))
+	}
+	return tea.Batch(cmds...)
+}
+
+// stopFetch cancels the fetch in flight, if any. Its watchdog is ignored from then on.
+func (m *mainModel) stopFetch() {
+	if m.fetch.cancel != nil {
+		m.fetch.cancel()
+		m.fetch.cancel = nil
+	}
+}
+
+// fetchDevices returns a command that streams the device list, sending deviceProgress messages with batches of
+// devices as they arrive and finishing with a Result[[]tailscale.Device] holding all of them.
+func (m *mainModel) fetchDevices(ctx context.Context, id int) tea.Cmd {
+	ts := m.ts
+	msgs := make(chan tea.Msg, 1)
+
+	go func() {
+		var devices, pending []tailscale.Device
+		err := ts.StreamDevices(ctx, func(device tailscale.Device) {
+			devices = append(devices, device)
+			pending = append(pending, device)
+			// batch devices up while the UI hasn't caught up with the last update.
+			select {
+			case msgs <- deviceProgress{fetch: id, devices: pending, msgs: msgs}:
+				pending = nil
+			default:
+			}
+		})
+		if errors.Is(ctx.Err(), context.Canceled) {
+			msgs <- fetchCanceled{}
+			return
+		}
+		if err != nil {
+			msgs <- Result[[]tailscale.Device]{Error: err, Fetch: id}
+			return
+		}
+		if len(pending) > 0 {
+			msgs <- deviceProgress{fetch: id, devices: pending, msgs: msgs}
+		}
+		msgs <- Result[[]tailscale.Device]{Success: devices, Fetch: id}
+	}()
+
+	return waitForDevices(msgs)
+}
+
+// handleFetchTimeout fails a fetch that is still waiting for its first devices when its watchdog fires.
+func (m *mainModel) handleFetchTimeout(msg fetchTimedOut) (*mainModel, tea.Cmd) {
+	if msg.fetch != m.fetch.id || m.fetch.cancel == nil || m.state != stateLoading {
+		return m, nil
+	}
+
+	m.stopFetch()
+	m.logger.Error("fetching devices timed out", "action", "fetch", "timeout", m.cfg.FetchTimeout)
+	if cmd, ok := m.showCached(errFetchTimeout); ok {
+		return m, cmd
+	}
+	m.err = errFetchTimeout
+	m.state = stateFailure
+	return m, nil
+}
+
+// waitForDevices waits for the next message of a fetch started by fetchDevices.
+func waitForDevices(msgs <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-msgs
+	}
+}
+
+// handleProgress adds a batch of fetched devices to the device list, showing the list as soon as the first batch
+// arrives so it can be browsed and filtered while the rest load.
+func (m *mainModel) handleProgress(msg deviceProgress) (*mainModel, tea.Cmd) {
+	if msg.fetch != m.fetch.id || m.fetch.cancel == nil {
+		// a canceled fetch; drain it so its goroutine can finish.
+		return m, waitForDevices(msg.msgs)
+	}
+	var cmds []tea.Cmd
+	if m.fetched == 0 {
+		m.devices = nil
+		cmds = append(cmds, m.deviceList.SetItems(), m.deviceList.StartSpinner())
+		m.state = stateDevice
+	}
+
+	m.fetched += len(msg.devices)
+	m.devices = append(m.devices, msg.devices...)
+	if m.grouping != groupNone {
+		// groups can gain devices anywhere in the list, so regroup everything received so far.
+		cmds = append(cmds, m.deviceList.SetItems(m.groupedItems(m.devices, time.Now())...))
+	} else if items := m.deviceItems(msg.devices, time.Now()); len(items) > 0 {
+		cmds = append(cmds, m.deviceList.AppendItems(items...))
+	}
+	cmds = append(cmds, waitForDevices(msg.msgs))
+	return m, tea.Batch(cmds...)
+}
+
+// deviceItems returns list items for the devices matching the configured tag filter.
+func (m *mainModel) deviceItems(devices []tailscale.Device, now time.Time) []components.ListItem {
+	var items []components.ListItem
+	for _, device := range devices {
+		if m.matchesTagFilter(device) {
+			items = append(items, m.deviceItem(device, now))
+		}
+	}
+	return items
+}
+
+func (m *mainModel) matchesTagFilter(device tailscale.Device) bool {
+	return m.tagFilter.Matches(device)
+}
+
+// deviceItem describes device with its owner, when it was last seen, its tags, any key expiry warning and, once
+// its routes are known, whether it is an exit node or subnet router. Laid out
+// in columns, it shows the owner, OS, client version and when it was last seen.
+func (m *mainModel) deviceItem(device tailscale.Device, now time.Time) components.ListItem {
+	lastSeen := reltime.LastSeen(device.LastSeen.Time, now, tssh.OnlineThreshold)
+	info := []string{device.User, lastSeen}
+	if len(device.Tags) > 0 {
+		info = append(info, strings.Join(device.Tags, ","))
+	}
+	if warning := keyExpiryWarning(device, now, m.cfg.KeyExpiryWarning()); warning != "" {
+		info = append(info, warning)
+	}
+	if indicator := m.routes[device.ID].indicator(); indicator != "" {
+		info = append(info, indicator)
+	}
+	if indicator := m.connectionIndicator(device); indicator != "" {
+		info = append(info, indicator)
+	}
+	// client versions carry a build suffix, as in 1.38.4-t8c6b2fd0-g3a9d2c0e3, that is only noise in a column.
+	version, _, _ := strings.Cut(device.ClientVersion, "-")
+	return components.ListItem{
+		Name:      device.Hostname,
+		Info:      strings.Join(info, " • "),
+		Address:   deviceAddress(device),
+		Addresses: device.Addresses,
+		Action:    tssh.ActionDeviceSSH,
+		Columns:   []string{device.Hostname, device.User, device.OS, version, lastSeen},
+		ID:        device.ID,
+	}
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestHandleResultIgnoresStaleFetches(t *testing.T) {
+	// the device cache is saved to the config directory.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	m := newTestModel(t, nil)
+	canceled := false
+	m.fetch = fetchState{id: 2, cancel: func() { canceled = true }}
+	m.state = stateLoading
+
+	m.handleResult(Result[[]tailscale.Device]{Success: testDevices("old"), Fetch: 1})
+	if canceled || m.state != stateLoading {
+		t.Fatalf("a result from an earlier fetch canceled the fetch in flight, state = %v", m.state)
+	}
+
+	m.handleResult(Result[[]tailscale.Device]{Success: testDevices("new"), Fetch: 2})
+	if !canceled || m.state != stateDevice {
+		t.Fatalf("state = %v, want the fetch in flight's result shown", m.state)
+	}
+	if len(m.devices) != 1 || m.devices[0].Hostname != "new" {
+		t.Errorf("devices = %v, want those of the fetch in flight", m.devices)
+	}
+}
@@ -0,0 +1,243 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type (
+	// portForward is a local port forwarded to a port on a device, like ssh -L.
+	portForward struct {
+		hostname string
+		input    textinput.Model
+		local    string
+		remote   string
+		listener net.Listener
+		conns    *atomic.Int64
+		err      error
+	}
+
+	// forwardStarted is sent once the local listener is up and the device is connected.
+	forwardStarted struct {
+		listener net.Listener
+		remote   string
+		target   sshTarget
+	}
+
+	// forwardStopped is sent when forwarding ends, with the error that ended it if it wasn't stopped on purpose.
+	forwardStopped struct {
+		listener net.Listener
+		err      error
+	}
+)
+
+// parseForwardSpec parses [local_port:]remote_port. The local port defaults to the remote port.
+func parseForwardSpec(spec string) (local, remote string, err error) {
+	spec = strings.TrimSpace(spec)
+	local, remote, ok := strings.Cut(spec, ":")
+	if !ok {
+		local, remote = spec, spec
+	}
+	for _, port := range []string{local, remote} {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return local, remote, nil
+}
+
+// startForwardPrompt asks which port of hostname to forward.
+func (m *mainModel) startForwardPrompt(hostname string) (*mainModel, tea.Cmd) {
+	input := textinput.New()
+	input.Prompt = "forward to " + hostname + " "
+	input.PromptStyle = lipgloss.NewStyle().Foreground(m.theme.Accent)
+	input.Placeholder = "[local_port:]remote_port"
+	input.Width = m.inputWidth(input.Prompt)
+
+	m.forward = portForward{hostname: hostname, input: input}
+	m.state = stateForwardPrompt
+	return m, m.forward.input.Focus()
+}
+
+func (m *mainModel) handleForwardPromptKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	f := &m.forward
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.state = stateActions
+		return m, nil
+	case key.Matches(msg, m.keys.Choose):
+		local, remote, err := parseForwardSpec(f.input.Value())
+		if err != nil {
+			f.err = err
+			return m, nil
+		}
+		f.local, f.remote, f.err = local, remote, nil
+		f.conns = new(atomic.Int64)
+		m.state = stateForwarding
+		return m, m.startForward(f.hostname, local, remote)
+	}
+
+	f.input, cmd = f.input.Update(msg)
+	return m, cmd
+}
+
+// startForward returns a command that listens on local and connects to hostname, reporting forwardStarted. The
+// connection is left in the pool for the forwarded connections to use.
+func (m *mainModel) startForward(hostname, local, remote string) tea.Cmd {
+	t, err := m.target(hostname)
+	if err != nil {
+		return func() tea.Msg { return forwardStopped{err: err} }
+	}
+	return func() tea.Msg {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", local))
+		if err != nil {
+			return forwardStopped{err: fmt.Errorf("%v failed to listen on port %s", err, local)}
+		}
+		_, release, err := m.connect(t, hostname, "forward")
+		if err != nil {
+			listener.Close()
+			return forwardStopped{err: err}
+		}
+		release()
+		return forwardStarted{listener: listener, remote: remote, target: t}
+	}
+}
+
+// serveForward accepts connections on listener until it is closed, tunnelling each to remote on hostname, reached as
+// t says.
+func (m *mainModel) serveForward(t sshTarget, hostname string, listener net.Listener, remote string, conns *atomic.Int64) tea.Cmd {
+	return func() tea.Msg {
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					err = nil
+				}
+				return forwardStopped{listener: listener, err: err}
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				conns.Add(1)
+				defer conns.Add(-1)
+				if err := m.forwardConn(t, hostname, conn, remote); err != nil {
+					m.logger.Warn("forwarded connection failed", "action", "forward", "host", hostname, "port", remote, "error", err)
+				}
+			}()
+		}
+	}
+}
+
+// forwardConn copies conn to and from remote on hostname until either side closes.
+func (m *mainModel) forwardConn(t sshTarget, hostname string, conn net.Conn, remote string) error {
+	client, release, err := m.connect(t, hostname, "forward")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	target, err := client.Dial("tcp", net.JoinHostPort("127.0.0.1", remote))
+	if err != nil {
+		return fmt.Errorf("%v failed to connect to port %s", err, remote)
+	}
+	defer target.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
+
+func (m *mainModel) handleForwardStarted(msg forwardStarted) (*mainModel, tea.Cmd) {
+	if m.state != stateForwarding {
+		// stopped while connecting.
+		msg.listener.Close()
+		return m, nil
+	}
+	m.logger.Info("forwarding", "action", "forward", "host", m.forward.hostname, "local", m.forward.local, "remote", msg.remote)
+	m.forward.listener = msg.listener
+	m.active++
+	return m, m.serveForward(msg.target, m.forward.hostname, msg.listener, msg.remote, m.forward.conns)
+}
+
+func (m *mainModel) handleForwardStopped(msg forwardStopped) (*mainModel, tea.Cmd) {
+	if msg.listener != nil && msg.listener != m.forward.listener {
+		return m, nil
+	}
+	if m.forward.listener != nil {
+		m.forward.listener = nil
+		m.active--
+	}
+	if msg.err != nil {
+		m.logger.Error("forwarding failed", "action", "forward", "host", m.forward.hostname, "error", msg.err)
+		m.err = msg.err
+		m.retry = retryAction{}
+		m.state = stateFailure
+	}
+	return m, nil
+}
+
+// stopForward closes the forwarding listener, which ends serveForward.
+func (m *mainModel) stopForward() {
+	if m.forward.listener != nil {
+		m.forward.listener.Close()
+		m.forward.listener = nil
+		m.active--
+	}
+}
+
+func (m *mainModel) handleForwardingKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	if key.Matches(msg, m.keys.Back) {
+		m.stopForward()
+		m.state = stateActions
+	}
+	return m, nil
+}
+
+func (m mainModel) forwardPromptView() string {
+	f := m.forward
+	lines := []string{f.input.View()}
+	if f.err != nil {
+		lines = append(lines, "", m.textStyle(f.err.Error()))
+	}
+	choose, back := m.keys.Choose.Help(), m.keys.Back.Help()
+	help := fmt.Sprintf("%s forward • %s back", choose.Key, back.Key)
+	lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(help))
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (m mainModel) forwardingView() string {
+	f := m.forward
+	status := lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), m.textStyle(" Connecting..."))
+	if f.listener != nil {
+		status = m.textStyle(fmt.Sprintf("Forwarding localhost:%s to %s:%s", f.local, f.hostname, f.remote))
+	}
+	conns := lipgloss.NewStyle().Foreground(m.theme.Muted).Render(fmt.Sprintf("%d open connections", f.conns.Load()))
+
+	back := m.keys.Back.Help()
+	footer := lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key + " stop")
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, status, conns, "", footer))
+}
@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	components "github.com/acmacalister/tssh/ui/components"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const (
+	// untagged is the group heading for devices without tags.
+	untagged = "untagged"
+	// taggedDevices is the owner group heading for tagged devices, which belong to their tags rather than a user,
+	// and noOwner the one for devices the API gives no owner.
+	taggedDevices = "tagged devices"
+	noOwner       = "no owner"
+	// ownerGroupPrefix starts the IDs of owner group headers, which are followed by the owner.
+	ownerGroupPrefix = "owner:"
+)
+
+// grouping is how the device list is grouped.
+type grouping int
+
+const (
+	groupNone grouping = iota
+	groupTag
+	groupOwner
+)
+
+// groupedItems returns the matching devices grouped as the device list is, by tag or by owner.
+func (m *mainModel) groupedItems(devices []tailscale.Device, now time.Time) []components.ListItem {
+	if m.grouping == groupOwner {
+		return m.ownerGroupItems(devices, now)
+	}
+	return m.tagGroupItems(devices, now)
+}
+
+// tagGroupItems returns the matching devices grouped by tag, each group headed by a section header item. Devices
+// with several tags are listed under each of them.
+func (m *mainModel) tagGroupItems(devices []tailscale.Device, now time.Time) []components.ListItem {
+	groups := map[string][]tailscale.Device{}
+	for _, device := range devices {
+		if !m.matchesTagFilter(device) {
+			continue
+		}
+		if len(device.Tags) == 0 {
+			groups[untagged] = append(groups[untagged], device)
+		}
+		for _, tag := range device.Tags {
+			groups[tag] = append(groups[tag], device)
+		}
+	}
+
+	tags := make([]string, 0, len(groups))
+	for tag := range groups {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var items []components.ListItem
+	for _, tag := range tags {
+		items = append(items, components.ListItem{Name: "── " + tag + " ──", Info: fmt.Sprintf("%d devices", len(groups[tag])), Action: tssh.ActionNone})
+		for _, device := range groups[tag] {
+			items = append(items, m.deviceItem(device, now))
+		}
+	}
+	return items
+}
+
+// ownerGroupItems returns the matching devices grouped by owner, in the order of devices within each group. The
+// owners are sorted, then come tagged devices, whatever user tagged them, and devices with no owner. Each group is
+// headed by a header item that collapses it when chosen.
+func (m *mainModel) ownerGroupItems(devices []tailscale.Device, now time.Time) []components.ListItem {
+	groups := map[string][]tailscale.Device{}
+	var owners []string
+	for _, device := range devices {
+		if !m.matchesTagFilter(device) {
+			continue
+		}
+		owner := deviceOwner(device)
+		if _, ok := groups[owner]; !ok && owner != taggedDevices && owner != noOwner {
+			owners = append(owners, owner)
+		}
+		groups[owner] = append(groups[owner], device)
+	}
+	sort.Strings(owners)
+	owners = append(owners, taggedDevices, noOwner)
+
+	var items []components.ListItem
+	for _, owner := range owners {
+		group := groups[owner]
+		if len(group) == 0 {
+			continue
+		}
+		marker := "▾"
+		if m.collapsed[owner] {
+			marker = "▸"
+		}
+		items = append(items, components.ListItem{Name: marker + " " + owner, Info: fmt.Sprintf("%d devices", len(group)), Action: tssh.ActionToggleGroup, ID: ownerGroupPrefix + owner})
+		if m.collapsed[owner] {
+			continue
+		}
+		for _, device := range group {
+			items = append(items, m.deviceItem(device, now))
+		}
+	}
+	return items
+}
+
+// deviceOwner returns the owner group device is listed in.
+func deviceOwner(device tailscale.Device) string {
+	switch {
+	case len(device.Tags) > 0:
+		return taggedDevices
+	case device.User == "":
+		return noOwner
+	default:
+		return device.User
+	}
+}
+
+// toggleCollapsed collapses the owner group headed by item, or expands it if it is collapsed.
+func (m *mainModel) toggleCollapsed(item components.ListItem) tea.Cmd {
+	owner := strings.TrimPrefix(item.ID, ownerGroupPrefix)
+	m.collapsed[owner] = !m.collapsed[owner]
+	return m.relistDevices()
+}
+
+// toggleGrouping switches the device list to grouping by g, or back to a flat list if it is already grouped so.
+func (m *mainModel) toggleGrouping(g grouping) tea.Cmd {
+	if m.grouping == g {
+		m.grouping = groupNone
+	} else {
+		m.grouping = g
+	}
+	return m.relistDevices()
+}
+
+// relistDevices brings the device list up to date with m.devices, grouped or not, keeping the selected device
+// selected.
+func (m *mainModel) relistDevices() tea.Cmd {
+	if m.grouping != groupNone {
+		return m.deviceList.UpdateItems(m.groupedItems(m.devices, time.Now())...)
+	}
+	return m.deviceList.UpdateItems(m.deviceItems(m.devices, time.Now())...)
+}
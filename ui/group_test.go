@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/acmacalister/tssh/config"
+)
+
+func TestGroupByOwner(t *testing.T) {
+	cfg := config.Default()
+	cfg.TagFilter = ""
+	m := newTestModel(t, cfg)
+	m.state = stateDevice
+	m.devices = testDevices("web-1", "db-1", "ci-1", "web-2", "laptop")
+	m.devices[1].User = "bob@example.com"
+	m.devices[2].Tags = []string{"tag:ci"}
+	m.devices[4].User = ""
+	m.relistDevices()
+
+	names := func() []string {
+		var names []string
+		for _, item := range m.deviceList.Items() {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	m.handleKeyPress(keyPress("O"))
+	if m.grouping != groupOwner {
+		t.Fatalf("grouping = %v, want by owner", m.grouping)
+	}
+	want := []string{
+		"▾ alice@example.com", "web-1", "web-2",
+		"▾ bob@example.com", "db-1",
+		"▾ tagged devices", "ci-1",
+		"▾ no owner", "laptop",
+	}
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("device list = %q, want %q", got, want)
+	}
+
+	header := m.deviceList.Items()[0]
+	m.handleAction(header)
+	want = []string{
+		"▸ alice@example.com",
+		"▾ bob@example.com", "db-1",
+		"▾ tagged devices", "ci-1",
+		"▾ no owner", "laptop",
+	}
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("with alice collapsed, device list = %q, want %q", got, want)
+	}
+	m.handleAction(m.deviceList.Items()[0])
+	if got := names(); len(got) != 9 {
+		t.Errorf("with alice expanded again, device list = %q, want every device", got)
+	}
+
+	// T switches to grouping by tag, and O again back to a flat list.
+	m.handleKeyPress(keyPress("T"))
+	if m.grouping != groupTag {
+		t.Errorf("after T, grouping = %v, want by tag", m.grouping)
+	}
+	m.handleKeyPress(keyPress("O"))
+	m.handleKeyPress(keyPress("O"))
+	if got := names(); m.grouping != groupNone || len(got) != 5 {
+		t.Errorf("after O twice, grouping = %v listing %q, want a flat list", m.grouping, got)
+	}
+}
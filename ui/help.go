@@ -0,0 +1,49 @@
+package ui
+
+import (
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type helpSection struct {
+	title    string
+	bindings []key.Binding
+}
+
+// helpSections describes every action, built from the configured keymap so the help always matches the keys.
+func (m mainModel) helpSections() []helpSection {
+	actions := key.NewBinding(key.WithKeys(m.keys.Choose.Keys()...), key.WithHelp(m.keys.Choose.Help().Key, "device actions"))
+	return []helpSection{
+		{title: "Navigation", bindings: append(components.NavigationKeys(!m.cfg.DisableFilter), m.keys.Choose, m.keys.Back)},
+		{title: "Devices", bindings: []key.Binding{actions, m.keys.Detail, m.keys.Copy, m.keys.Test, m.keys.Command, m.keys.Select, m.keys.SystemSSH, m.keys.Admin, m.keys.Group, m.keys.GroupOwner, m.keys.Compact, m.keys.Refresh}},
+		{title: "General", bindings: []key.Binding{m.keys.Help, m.keys.Quit}},
+	}
+}
+
+// helpView renders the full help overlay, shown over the current view until the help key is pressed again.
+func (m mainModel) helpView() string {
+	title := lipgloss.NewStyle().Foreground(m.theme.Title).Bold(true).Render
+	keyStyle := lipgloss.NewStyle().Foreground(m.theme.Accent).Width(16).Render
+	desc := lipgloss.NewStyle().Foreground(m.theme.Text).Render
+
+	lines := []string{}
+	for _, section := range m.helpSections() {
+		lines = append(lines, title(section.title))
+		for _, b := range section.bindings {
+			if !b.Enabled() {
+				continue
+			}
+			lines = append(lines, keyStyle(b.Help().Key)+desc(b.Help().Desc))
+		}
+		lines = append(lines, "")
+	}
+	help := m.keys.Help.Help()
+	lines = append(lines, lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(help.Key+" or "+m.keys.Back.Help().Key+" to close"))
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(m.theme.Accent).
+		Padding(1, 2).
+		Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
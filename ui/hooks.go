@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// hookedSession runs the pre and post connect hooks configured for hostname around session. Hooks run on the
+	// terminal bubbletea hands over for the session, so they can print to it and read from it.
+	hookedSession struct {
+		m        *mainModel
+		hostname string
+		session  tea.ExecCommand
+		stdin    io.Reader
+		stdout   io.Writer
+		stderr   io.Writer
+	}
+
+	// processCommand is a local process run on the terminal bubbletea hands over, as tea.ExecProcess runs one.
+	processCommand struct {
+		*exec.Cmd
+	}
+)
+
+func (c processCommand) SetStdin(r io.Reader) {
+	if c.Stdin == nil {
+		c.Stdin = r
+	}
+}
+
+func (c processCommand) SetStdout(w io.Writer) {
+	if c.Stdout == nil {
+		c.Stdout = w
+	}
+}
+
+func (c processCommand) SetStderr(w io.Writer) {
+	if c.Stderr == nil {
+		c.Stderr = w
+	}
+}
+
+// withHooks wraps session on hostname in its connection hooks, if it has any.
+func (m *mainModel) withHooks(hostname string, session tea.ExecCommand) tea.ExecCommand {
+	if m.cfg.PreConnectCommand(hostname) == "" && m.cfg.PostConnectCommand(hostname) == "" {
+		return session
+	}
+	return &hookedSession{m: m, hostname: hostname, session: session}
+}
+
+func (h *hookedSession) SetStdin(r io.Reader) {
+	h.stdin = r
+	h.session.SetStdin(r)
+}
+
+func (h *hookedSession) SetStdout(w io.Writer) {
+	h.stdout = w
+	h.session.SetStdout(w)
+}
+
+func (h *hookedSession) SetStderr(w io.Writer) {
+	h.stderr = w
+	h.session.SetStderr(w)
+}
+
+// Run runs the pre connect hook, then the session, then the post connect hook. A failing pre connect hook stops
+// the session if pre_connect_required is set; a failing post connect hook is only logged, as the session is over.
+func (h *hookedSession) Run() error {
+	if command := h.m.cfg.PreConnectCommand(h.hostname); command != "" {
+		if err := h.run("pre_connect", command, nil); err != nil {
+			if h.m.cfg.PreConnectRequired {
+				return fmt.Errorf("%v failed to run pre_connect hook %q", err, command)
+			}
+			h.m.logger.Warn("pre_connect hook failed, connecting anyway", "host", h.hostname, "command", command, "error", err)
+			fmt.Fprintf(h.stderr, "pre_connect hook failed (%v), connecting anyway\n", err)
+		}
+	}
+
+	err := h.session.Run()
+
+	if command := h.m.cfg.PostConnectCommand(h.hostname); command != "" {
+		if err := h.run("post_connect", command, err); err != nil {
+			h.m.logger.Warn("post_connect hook failed", "host", h.hostname, "command", command, "error", err)
+		}
+	}
+	return err
+}
+
+// run runs the hook command for event with sh, telling it about the connection in TSSH_HOOK_* environment
+// variables. Post connect hooks also get the error that ended the session, if any, in TSSH_HOOK_ERROR.
+func (h *hookedSession) run(event, command string, sessionErr error) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = h.stdin, h.stdout, h.stderr
+	cmd.Env = append(os.Environ(),
+		"TSSH_HOOK_EVENT="+event,
+		"TSSH_HOOK_HOST="+h.hostname,
+		"TSSH_HOOK_USER="+h.m.sshUser(h.hostname),
+	)
+	if sessionErr != nil {
+		cmd.Env = append(cmd.Env, "TSSH_HOOK_ERROR="+sessionErr.Error())
+	}
+	h.m.logger.Info("running hook", "action", event, "host", h.hostname, "command", command)
+	return cmd.Run()
+}
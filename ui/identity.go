@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/acmacalister/tssh"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxKeySize is the most read of each file in ~/.ssh when looking for private keys; keys are far smaller.
+const maxKeySize = 64 << 10
+
+// privateKeys returns the paths of the private keys in ~/.ssh, sorted by name.
+func privateKeys() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(home, ".ssh")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) == ".pub" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if isPrivateKey(path) {
+			keys = append(keys, path)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// isPrivateKey reports whether the file at path holds a PEM encoded private key.
+func isPrivateKey(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxKeySize))
+	return err == nil && bytes.Contains(b, []byte("PRIVATE KEY-----"))
+}
+
+// openIdentityPicker lists the private keys in ~/.ssh for choosing the one to open a shell on hostname with.
+func (m *mainModel) openIdentityPicker(hostname string) (*mainModel, tea.Cmd) {
+	paths, err := privateKeys()
+	if err != nil {
+		m.logger.Warn("listing identity files failed", "host", hostname, "error", err)
+	}
+
+	var items []components.ListItem
+	for _, path := range paths {
+		item := components.ListItem{Name: filepath.Base(path), Info: path, Address: path, Action: tssh.ActionSelectIdentity}
+		_, err := loadIdentity(path)
+		var passphraseErr *ssh.PassphraseMissingError
+		switch {
+		case errors.As(err, &passphraseErr):
+			// there is no way to ask for the passphrase while connecting.
+			item.Info += " • passphrase protected, can't be used"
+			item.Action = tssh.ActionNone
+		case err != nil:
+			item.Info += " • " + err.Error()
+			item.Action = tssh.ActionNone
+		case m.identities[hostname] == path:
+			item.Info += " • last used"
+		}
+		items = append(items, item)
+	}
+
+	m.identityList = components.NewList("Identity for "+hostname, m.theme, m.keys, items...)
+	m.identityList.SetFilteringEnabled(!m.cfg.DisableFilter)
+	m.identityList.SetHelpKeys(m.keys.Back, m.keys.Help)
+
+	var cmd tea.Cmd
+	if m.width > 0 {
+		m.identityList, cmd = m.identityList.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+	}
+	m.state = stateIdentities
+	return m, cmd
+}
+
+func (m *mainModel) handleIdentitiesKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) && !m.identityList.IsFiltering() {
+		if m.identityList.IsFiltered() {
+			m.identityList.ResetFilter()
+			return m, nil
+		}
+		m.state = stateActions
+		return m, nil
+	}
+	m.identityList, cmd = m.identityList.Update(msg)
+	return m, cmd
+}
+
+// useIdentity remembers path as the identity file for m.actionHost and opens a shell with it.
+func (m *mainModel) useIdentity(path string) (*mainModel, tea.Cmd) {
+	m.logger.Info("identity chosen", "action", "identity", "host", m.actionHost, "path", path)
+	m.identities[m.actionHost] = path
+	if err := m.identities.Save(); err != nil {
+		m.logger.Warn("saving identities failed", "error", err)
+	}
+	hostname := m.actionHost
+	return m.checkAccess(hostname, stateIdentities, func() tea.Cmd { return m.sshDevice(hostname) })
+}
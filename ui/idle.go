@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// idleWatcher closes a session that has had no keypress for a while, counting down in the terminal for the last
+// part of the wait so that it doesn't come as a surprise. It sits between the terminal and the session's stdin,
+// where every keypress passes through.
+type idleWatcher struct {
+	r        io.Reader
+	w        io.Writer
+	timeout  time.Duration
+	warning  time.Duration
+	last     atomic.Int64
+	warned   atomic.Bool
+	timedOut atomic.Bool
+}
+
+// newIdleWatcher returns a watcher reading keys from r and writing its countdown to w.
+func newIdleWatcher(r io.Reader, w io.Writer, timeout, warning time.Duration) *idleWatcher {
+	i := &idleWatcher{r: r, w: w, timeout: timeout, warning: min(warning, timeout)}
+	i.last.Store(time.Now().UnixNano())
+	return i
+}
+
+// Read passes keys through to the session, starting the wait over and clearing any countdown.
+func (i *idleWatcher) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	if n > 0 {
+		i.last.Store(time.Now().UnixNano())
+		if i.warned.Swap(false) {
+			fmt.Fprint(i.w, "\r\x1b[K")
+		}
+	}
+	return n, err
+}
+
+// watch checks every second how long the session has been idle until done is closed, counting down once the
+// warning starts and calling close once the timeout is up.
+func (i *idleWatcher) watch(done <-chan struct{}, close func()) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			idle := now.Sub(time.Unix(0, i.last.Load()))
+			if idle >= i.timeout {
+				i.timedOut.Store(true)
+				fmt.Fprintf(i.w, "\r\x1b[Kno keypress for %s, disconnecting\r\n", i.timeout)
+				close()
+				return
+			}
+			if idle >= i.timeout-i.warning {
+				left := (i.timeout - idle + time.Second - 1).Truncate(time.Second)
+				fmt.Fprintf(i.w, "\r\x1b[Kidle, disconnecting in %s, press any key to stay connected", left)
+				i.warned.Store(true)
+			}
+		}
+	}
+}
+
+// err returns why the session ended if the watcher closed it, or nil.
+func (i *idleWatcher) err() error {
+	if !i.timedOut.Load() {
+		return nil
+	}
+	return fmt.Errorf("session closed after no keypress for %s", i.timeout)
+}
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to write from the watcher and the session's reads at once.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestIdleWatcherCountdown(t *testing.T) {
+	t.Parallel()
+	var out lockedBuffer
+	idle := newIdleWatcher(strings.NewReader(""), &out, 2*time.Second, time.Second)
+	closed := make(chan struct{})
+	go idle.watch(make(chan struct{}), func() { close(closed) })
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle session was never closed")
+	}
+	if !strings.Contains(out.String(), "idle, disconnecting in 1s, press any key to stay connected") {
+		t.Errorf("output = %q, want a countdown before disconnecting", out.String())
+	}
+	if !strings.Contains(out.String(), "no keypress for 2s, disconnecting") {
+		t.Errorf("output = %q, want the disconnect explained", out.String())
+	}
+	if idle.err() == nil {
+		t.Error("err = nil, want the session's end put down to the idle timeout")
+	}
+}
+
+func TestIdleWatcherKeypressResets(t *testing.T) {
+	t.Parallel()
+	var out lockedBuffer
+	keys, typed := io.Pipe()
+	// the warning covers the whole wait, so every tick counts down.
+	idle := newIdleWatcher(keys, &out, 2*time.Second, 2*time.Second)
+	done := make(chan struct{})
+	closed := make(chan struct{})
+	go idle.watch(done, func() { close(closed) })
+	go io.Copy(io.Discard, idle)
+
+	deadline := time.After(3500 * time.Millisecond)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+typing:
+	for {
+		select {
+		case <-closed:
+			t.Fatal("the session was closed while keys were being pressed")
+		case <-ticker.C:
+			typed.Write([]byte("x"))
+		case <-deadline:
+			break typing
+		}
+	}
+	close(done)
+	typed.Close()
+
+	if !strings.Contains(out.String(), "idle, disconnecting in") {
+		t.Errorf("output = %q, want a countdown", out.String())
+	}
+	if !strings.Contains(out.String(), "stay connected\r\x1b[K") {
+		t.Errorf("output = %q, want a keypress to clear the countdown", out.String())
+	}
+	if idle.err() != nil {
+		t.Errorf("err = %v, want nil for a session that wasn't idle", idle.err())
+	}
+}
@@ -0,0 +1,53 @@
+// Package reltime formats times relative to now for display, such as "3m ago" or "2 days ago".
+package reltime
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	day   = 24 * time.Hour
+	month = 30 * day
+	year  = 365 * day
+)
+
+// Ago formats how long before now t was. Times less than a minute ago, or in the future, are "just now". Minutes
+// and hours are abbreviated, longer spans are spelled out: "5m ago", "3h ago", "1 day ago", "2 months ago".
+func Ago(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < day:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	case d < month:
+		return plural(int(d/day), "day") + " ago"
+	case d < year:
+		return plural(int(d/month), "month") + " ago"
+	default:
+		return plural(int(d/year), "year") + " ago"
+	}
+}
+
+// LastSeen formats when a device was last seen: "online" if that was no more than threshold before now, "never"
+// if it has never been seen, and otherwise as Ago.
+func LastSeen(t, now time.Time, threshold time.Duration) string {
+	switch {
+	case t.IsZero():
+		return "never"
+	case now.Sub(t) <= threshold:
+		return "online"
+	default:
+		return Ago(t, now)
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,55 @@
+package reltime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		ago  time.Duration
+		want string
+	}{
+		{ago: -time.Hour, want: "just now"},
+		{ago: 0, want: "just now"},
+		{ago: 59 * time.Second, want: "just now"},
+		{ago: time.Minute, want: "1m ago"},
+		{ago: 59*time.Minute + 59*time.Second, want: "59m ago"},
+		{ago: time.Hour, want: "1h ago"},
+		{ago: 23 * time.Hour, want: "23h ago"},
+		{ago: day, want: "1 day ago"},
+		{ago: 2*day - time.Second, want: "1 day ago"},
+		{ago: 2 * day, want: "2 days ago"},
+		{ago: 29 * day, want: "29 days ago"},
+		{ago: month, want: "1 month ago"},
+		{ago: 2 * month, want: "2 months ago"},
+		{ago: 364 * day, want: "12 months ago"},
+		{ago: year, want: "1 year ago"},
+		{ago: 3 * year, want: "3 years ago"},
+	} {
+		if got := Ago(now.Add(-test.ago), now); got != test.want {
+			t.Errorf("Ago(%v before now) = %q, want %q", test.ago, got, test.want)
+		}
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	threshold := 5 * time.Minute
+	for _, test := range []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{name: "never seen", want: "never"},
+		{name: "just seen", t: now, want: "online"},
+		{name: "at threshold", t: now.Add(-threshold), want: "online"},
+		{name: "past threshold", t: now.Add(-threshold - time.Second), want: "5m ago"},
+		{name: "days ago", t: now.Add(-3 * day), want: "3 days ago"},
+	} {
+		if got := LastSeen(test.t, now, threshold); got != test.want {
+			t.Errorf("%s: LastSeen = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
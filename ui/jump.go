@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpHost is one hop of a ProxyJump chain.
+type jumpHost struct {
+	user string
+	addr string
+}
+
+// parseJumpSpec parses a ProxyJump-style chain of comma separated [user@]host[:port] hops, in the order they are
+// dialled. Hops without a user connect as defaultUser, and hops without a port use 22.
+func parseJumpSpec(spec, defaultUser string) ([]jumpHost, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var hops []jumpHost
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimSpace(hop)
+		user, host := defaultUser, hop
+		if i := strings.LastIndex(hop, "@"); i >= 0 {
+			user, host = hop[:i], hop[i+1:]
+		}
+		if user == "" || host == "" {
+			return nil, fmt.Errorf("invalid jump host %q", hop)
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "22")
+		}
+		hops = append(hops, jumpHost{user: user, addr: host})
+	}
+	return hops, nil
+}
+
+// dialer opens the connection to the first host of a chain.
+type dialer func(addr string) (net.Conn, error)
+
+// directDialer dials addr over TCP, giving up after timeout.
+func directDialer(timeout time.Duration) dialer {
+	return func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+}
+
+// dialChain connects to addr through each of hops in turn, reaching the first with dial and tunnelling every hop
+// after it over a direct-tcpip channel of the one before. The returned close func closes the target client first
+// and then the hops in reverse order.
+func dialChain(dial dialer, hops []jumpHost, addr string, config *ssh.ClientConfig) (*ssh.Client, func() error, error) {
+	var clients []*ssh.Client
+	closeAll := func() error {
+		var firstErr error
+		for i := len(clients) - 1; i >= 0; i-- {
+			if err := clients[i].Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	var client *ssh.Client
+	for _, hop := range append(hops, jumpHost{user: config.User, addr: addr}) {
+		hopConfig := *config
+		hopConfig.User = hop.user
+
+		var conn net.Conn
+		var err error
+		if client == nil {
+			conn, err = dial(hop.addr)
+		} else {
+			conn, err = client.Dial("tcp", hop.addr)
+		}
+		if err == nil {
+			client, err = newClient(conn, hop.addr, &hopConfig)
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("%v failed to connect to %s", err, hop.addr)
+		}
+		clients = append(clients, client)
+	}
+	return client, closeAll, nil
+}
+
+// newClient runs the ssh handshake over conn, closing it if the handshake fails.
+func newClient(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		// a proxy command that failed usually says why, which beats the handshake's EOF.
+		if pc, ok := conn.(*proxyCommandConn); ok && pc.Err() != nil {
+			return nil, pc.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
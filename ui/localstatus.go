@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/acmacalister/tssh/localapi"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// localStatusFetched is sent once tailscaled's status has been read, or couldn't be.
+	localStatusFetched struct {
+		status *localapi.Status
+		err    error
+	}
+
+	// peerPinged is sent once the device with the given ID has been pinged through tailscaled.
+	peerPinged struct {
+		id string
+		peerLatency
+	}
+
+	// peerLatency is the round trip to a device, or why it couldn't be measured.
+	peerLatency struct {
+		latency time.Duration
+		err     error
+	}
+)
+
+// WithLocalAPI adds what client's tailscaled knows of each device to the device list and details: whether the
+// connection to it is direct or relayed, and the round trip to it. Devices are listed from the control API alone
+// when this option is not provided or tailscaled isn't running.
+func WithLocalAPI(client *localapi.Client) Option {
+	return func(m *mainModel) {
+		m.local = client
+	}
+}
+
+// fetchLocalStatus returns a command that reads tailscaled's status, or nil without the LocalAPI.
+func (m *mainModel) fetchLocalStatus() tea.Cmd {
+	if m.local == nil {
+		return nil
+	}
+	local, timeout := m.local, m.cfg.APITimeout
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		status, err := local.LocalStatus(ctx)
+		return localStatusFetched{status: status, err: err}
+	}
+}
+
+// handleLocalStatusFetched indexes the peers tailscaled knows by their Tailscale addresses, which the control API
+// lists too, and relists the devices with them. Without tailscaled the devices are listed without them.
+func (m *mainModel) handleLocalStatusFetched(msg localStatusFetched) (*mainModel, tea.Cmd) {
+	m.localErr = msg.err
+	if msg.err != nil {
+		if m.peers == nil {
+			return m, nil
+		}
+		m.peers = nil
+		return m, m.relistDevices()
+	}
+	m.peers = make(map[string]localapi.Peer)
+	for _, peer := range msg.status.Peer {
+		for _, ip := range peer.TailscaleIPs {
+			m.peers[ip] = *peer
+		}
+	}
+	return m, m.relistDevices()
+}
+
+// peer returns what tailscaled knows of device, if anything.
+func (m *mainModel) peer(device tailscale.Device) (localapi.Peer, bool) {
+	for _, addr := range device.Addresses {
+		if peer, ok := m.peers[addr]; ok {
+			return peer, true
+		}
+	}
+	return localapi.Peer{}, false
+}
+
+// pingPeer returns a command that measures the round trip to device through tailscaled, or nil if tailscaled
+// doesn't have it online.
+func (m *mainModel) pingPeer(device tailscale.Device) tea.Cmd {
+	peer, ok := m.peer(device)
+	if !ok || !peer.Online || len(peer.TailscaleIPs) == 0 {
+		return nil
+	}
+	local, timeout, ip := m.local, m.cfg.ConnectTimeout, peer.TailscaleIPs[0]
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		latency, err := local.Ping(ctx, ip)
+		return peerPinged{id: device.ID, peerLatency: peerLatency{latency: latency, err: err}}
+	}
+}
+
+// handlePeerPinged records the round trip to a device, and relists the devices for it to show.
+func (m *mainModel) handlePeerPinged(msg peerPinged) (*mainModel, tea.Cmd) {
+	m.latencies[msg.id] = msg.peerLatency
+	if msg.err != nil {
+		return m, nil
+	}
+	return m, m.relistDevices()
+}
+
+// connectionIndicator summarises how tailscaled reaches device for the device list, such as "direct 12ms" or
+// "relayed via fra", or returns "" if it isn't connected to it.
+func (m *mainModel) connectionIndicator(device tailscale.Device) string {
+	peer, ok := m.peer(device)
+	if !ok || !peer.Online {
+		return ""
+	}
+	indicator := connectionPath(peer)
+	if l, ok := m.latencies[device.ID]; ok && l.err == nil {
+		indicator += " " + l.latency.Round(time.Millisecond).String()
+	}
+	return "↔ " + indicator
+}
+
+// connectionDetail describes how tailscaled reaches the device in detail, or why that isn't known.
+func (m mainModel) connectionDetail() string {
+	if m.local == nil {
+		return "unknown, local_api is off"
+	}
+	switch {
+	case errors.Is(m.localErr, localapi.ErrNotRunning):
+		return "unknown, tailscaled is not running"
+	case m.localErr != nil:
+		return "unavailable: " + m.localErr.Error()
+	case m.peers == nil:
+		return "loading…"
+	}
+	peer, ok := m.peer(m.detail)
+	switch {
+	case !ok:
+		return "not a peer of this machine"
+	case !peer.Online:
+		return "offline"
+	}
+	path := connectionPath(peer)
+	if peer.CurAddr != "" {
+		path += " to " + peer.CurAddr
+	}
+	l, ok := m.latencies[m.detail.ID]
+	switch {
+	case !ok:
+		return path + ", pinging…"
+	case errors.Is(l.err, localapi.ErrNotRunning):
+		return path
+	case l.err != nil:
+		return fmt.Sprintf("%s, ping failed: %v", path, l.err)
+	default:
+		return fmt.Sprintf("%s, %s round trip", path, l.latency.Round(time.Millisecond))
+	}
+}
+
+// connectionPath says whether peer is reached directly or through a DERP relay.
+func connectionPath(peer localapi.Peer) string {
+	switch {
+	case peer.CurAddr != "":
+		return "direct"
+	case peer.Relay != "":
+		return "relayed via " + peer.Relay
+	default:
+		return "not connected"
+	}
+}
@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh/localapi"
+)
+
+func TestLocalStatusMerged(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.local = localapi.New()
+	devices := testDevices("web-1", "db-1", "laptop")
+	m.devices = devices
+
+	m.handleLocalStatusFetched(localStatusFetched{status: &localapi.Status{Peer: map[string]*localapi.Peer{
+		"nodekey:1": {TailscaleIPs: devices[0].Addresses, Online: true, CurAddr: "192.0.2.1:41641"},
+		"nodekey:2": {TailscaleIPs: devices[1].Addresses, Online: true, Relay: "fra"},
+	}}})
+	m.handlePeerPinged(peerPinged{id: devices[0].ID, peerLatency: peerLatency{latency: 12 * time.Millisecond}})
+	for i, want := range []string{"↔ direct 12ms", "↔ relayed via fra", ""} {
+		if got := m.connectionIndicator(devices[i]); got != want {
+			t.Errorf("%s: indicator = %q, want %q", devices[i].Hostname, got, want)
+		}
+	}
+
+	// without tailscaled, devices are listed from the control API alone.
+	m.handleLocalStatusFetched(localStatusFetched{err: fmt.Errorf("%w: dial failed", localapi.ErrNotRunning)})
+	if got := m.connectionIndicator(devices[0]); got != "" {
+		t.Errorf("indicator = %q without tailscaled, want none", got)
+	}
+	m.detail = devices[0]
+	if got, want := m.connectionDetail(), "unknown, tailscaled is not running"; got != want {
+		t.Errorf("detail = %q, want %q", got, want)
+	}
+}
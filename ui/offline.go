@@ -0,0 +1,44 @@
+package ui
+
+import (
+	"errors"
+	"time"
+
+	"github.com/acmacalister/tssh/config"
+	tsservice "github.com/acmacalister/tssh/tailscale"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const deviceListTitle = "Devices"
+
+// cacheDevices remembers devices as the current profile's device list, for showCached to fall back to, and marks
+// the list as up to date.
+func (m *mainModel) cacheDevices(devices []tailscale.Device, now time.Time) {
+	m.offline = time.Time{}
+	m.cache[m.profile] = config.CachedDevices{FetchedAt: now, Devices: devices}
+	if err := m.cache.Save(); err != nil {
+		m.logger.Warn("saving device cache failed", "error", err)
+	}
+}
+
+// showCached shows the current profile's cached device list in place of a fetch that failed with err, if err means
+// the API couldn't be reached and there is a cached list. It reports whether it did.
+func (m *mainModel) showCached(err error) (tea.Cmd, bool) {
+	if !errors.Is(err, tsservice.ErrNetwork) && !errors.Is(err, errFetchTimeout) {
+		return nil, false
+	}
+	cached, ok := m.cache[m.profile]
+	if !ok {
+		return nil, false
+	}
+
+	m.logger.Warn("showing cached devices", "action", "fetch", "fetched_at", cached.FetchedAt, "error", err)
+	m.offline = cached.FetchedAt
+	m.devices = cached.Devices
+	m.state = stateDevice
+	if m.grouping != groupNone {
+		return m.deviceList.SetItems(m.groupedItems(cached.Devices, time.Now())...), true
+	}
+	return m.deviceList.SetItems(m.deviceItems(cached.Devices, time.Now())...), true
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialFunc connects a new client, returning a func that closes it along with any jump hosts.
+type dialFunc func() (*ssh.Client, func() error, error)
+
+type (
+	// connPool keeps authenticated clients open for a while after their last session ends, so that further
+	// sessions to the same host skip the handshake.
+	connPool struct {
+		mu    sync.Mutex
+		idle  time.Duration
+		conns map[string]*pooledConn
+	}
+
+	pooledConn struct {
+		client *ssh.Client
+		close  func() error
+		inUse  int
+		timer  *time.Timer
+		closed bool
+	}
+)
+
+// newConnPool returns a pool that closes clients once they have been unused for idle. A zero idle disables
+// reuse, closing clients as soon as they are released.
+func newConnPool(idle time.Duration) *connPool {
+	return &connPool{idle: idle, conns: make(map[string]*pooledConn)}
+}
+
+// get returns the pooled client for key, dialling a new one if there is none or the pooled one has gone away.
+// release must be called once the caller is done with the client.
+func (p *connPool) get(key string, dial dialFunc) (client *ssh.Client, release func(), err error) {
+	p.mu.Lock()
+	pc, ok := p.conns[key]
+	if ok {
+		if pc.timer != nil {
+			pc.timer.Stop()
+			pc.timer = nil
+		}
+		pc.inUse++
+	}
+	p.mu.Unlock()
+
+	if ok && alive(pc.client) {
+		return pc.client, func() { p.release(key, pc) }, nil
+	}
+	if ok {
+		p.remove(key, pc)
+	}
+
+	client, closeClient, err := dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pc = &pooledConn{client: client, close: closeClient, inUse: 1}
+	p.mu.Lock()
+	if old, ok := p.conns[key]; ok && old.inUse == 0 {
+		// another dial raced us; keep the new client and drop the idle one.
+		p.evictLocked(key, old)
+	}
+	if _, ok := p.conns[key]; !ok {
+		p.conns[key] = pc
+	}
+	p.mu.Unlock()
+
+	return client, func() { p.release(key, pc) }, nil
+}
+
+func (p *connPool) release(key string, pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.inUse--
+	if pc.inUse > 0 {
+		return
+	}
+	if p.conns[key] != pc || p.idle <= 0 {
+		p.evictLocked(key, pc)
+		return
+	}
+	pc.timer = time.AfterFunc(p.idle, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if pc.inUse == 0 {
+			p.evictLocked(key, pc)
+		}
+	})
+}
+
+func (p *connPool) remove(key string, pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc.inUse--
+	p.evictLocked(key, pc)
+}
+
+// evictLocked closes pc and removes it from the pool if it is still the pooled client for key.
+func (p *connPool) evictLocked(key string, pc *pooledConn) {
+	if p.conns[key] == pc {
+		delete(p.conns, key)
+	}
+	if pc.timer != nil {
+		pc.timer.Stop()
+	}
+	if !pc.closed {
+		pc.closed = true
+		go pc.close()
+	}
+}
+
+// closeAll closes every pooled client, in use or not.
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, pc := range p.conns {
+		delete(p.conns, key)
+		if pc.timer != nil {
+			pc.timer.Stop()
+		}
+		if !pc.closed {
+			pc.closed = true
+			pc.close()
+		}
+	}
+}
+
+// alive checks the client's connection is still usable with a keepalive request.
+func alive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
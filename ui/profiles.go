@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ServiceFactory creates the TailscaleService for a profile when switching tailnets.
+type ServiceFactory func(profile config.Profile) (tssh.TailscaleService, error)
+
+// WithProfiles enables switching between the given profiles at runtime. current names the profile ts was created from.
+func WithProfiles(profiles []config.Profile, current string, newService ServiceFactory) Option {
+	return func(m *mainModel) {
+		m.profiles = profiles
+		m.profile = current
+		m.newService = newService
+	}
+}
+
+func (m *mainModel) profileItems() []components.ListItem {
+	items := make([]components.ListItem, 0, len(m.profiles))
+	for _, p := range m.profiles {
+		info := p.Tailnet
+		if p.Name == m.profile {
+			info += " (active)"
+		}
+		items = append(items, components.ListItem{Name: p.Name, Info: info, Action: tssh.ActionSelectProfile})
+	}
+	return items
+}
+
+// switchProfile replaces the TailscaleService with one for the named profile and reloads the device list.
+// Failures leave the UI in the failure state rather than exiting, so another profile can be picked.
+func (m *mainModel) switchProfile(name string) (*mainModel, tea.Cmd) {
+	var profile config.Profile
+	found := false
+	for _, p := range m.profiles {
+		if p.Name == name {
+			profile, found = p, true
+			break
+		}
+	}
+	if !found {
+		m.err = fmt.Errorf("unknown profile %q", name)
+		m.retry = retryAction{}
+		m.state = stateFailure
+		return m, nil
+	}
+
+	ts, err := m.newService(profile)
+	if err != nil {
+		m.err = fmt.Errorf("profile %s: %w", name, err)
+		m.logger.Error("switching tailnet failed", "action", "switch_profile", "profile", name, "error", err)
+		m.retry = retryAction{}
+		m.state = stateFailure
+		return m, nil
+	}
+
+	m.ts = ts
+	m.profile = name
+	m.logger.Info("switched tailnet", "action", "switch_profile", "profile", name, "tailnet", profile.Tailnet)
+	// remembering the profile is a convenience; failing to do so shouldn't block switching.
+	_ = config.SaveLastProfile(name)
+
+	return m, tea.Batch(m.profileList.SetItems(m.profileItems()...), m.startFetch())
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// proxyCommandConn is a connection over the stdin and stdout of a ProxyCommand, such as tailscale nc %h %p.
+type proxyCommandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	// stderr collects what the command prints, for the error when the connection fails. It is only safe to read
+	// once the command has exited.
+	stderr *bytes.Buffer
+	addr   proxyCommandAddr
+}
+
+// proxyCommandAddr stands in for the address of either end of a proxyCommandConn.
+type proxyCommandAddr string
+
+func (a proxyCommandAddr) Network() string { return "proxy-command" }
+func (a proxyCommandAddr) String() string  { return string(a) }
+
+// proxyCommandDialer starts command for each connection, connecting as user. The %h, %p, %r and %% tokens in
+// command expand as they do in ssh_config's ProxyCommand.
+func proxyCommandDialer(command, user string) dialer {
+	return func(addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		command := strings.NewReplacer("%h", host, "%p", port, "%r", user, "%%", "%").Replace(command)
+		return startProxyCommand(command)
+	}
+}
+
+// startProxyCommand runs command with sh, as ssh does, and returns a connection over its stdio.
+func startProxyCommand(command string) (*proxyCommandConn, error) {
+	cmd := exec.Command("/bin/sh", "-c", "exec "+command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	// don't wait forever on stderr if the command leaves a child behind holding it open.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%v failed to start proxy command %q", err, command)
+	}
+	return &proxyCommandConn{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr, addr: proxyCommandAddr(command)}, nil
+}
+
+func (c *proxyCommandConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *proxyCommandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close stops the command and waits for it to exit.
+func (c *proxyCommandConn) Close() error {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+// Err returns what the command printed to stderr, for explaining a failed connection. It must only be called
+// after Close.
+func (c *proxyCommandConn) Err() error {
+	if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+		return fmt.Errorf("proxy command %q: %s", c.addr, msg)
+	}
+	return nil
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr  { return c.addr }
+func (c *proxyCommandConn) RemoteAddr() net.Addr { return c.addr }
+
+// Deadlines aren't supported. The ssh client doesn't set any, relying on the connection being closed instead.
+func (c *proxyCommandConn) SetDeadline(time.Time) error      { return errors.ErrUnsupported }
+func (c *proxyCommandConn) SetReadDeadline(time.Time) error  { return errors.ErrUnsupported }
+func (c *proxyCommandConn) SetWriteDeadline(time.Time) error { return errors.ErrUnsupported }
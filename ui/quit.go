@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	quitConfirm = key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "cancel and quit"))
+	quitCancel  = key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "keep going"))
+)
+
+// quit quits straight away when nothing is running in the background, and otherwise asks first, since quitting
+// would cut short the commands and port forwards in progress.
+func (m *mainModel) quit() (*mainModel, tea.Cmd) {
+	if m.active == 0 {
+		return m, tea.Quit
+	}
+	m.confirmQuit = true
+	return m, nil
+}
+
+func (m *mainModel) handleQuitConfirmKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	switch {
+	// a second ctrl+c doesn't wait for an answer.
+	case key.Matches(msg, quitConfirm) || msg.String() == "ctrl+c":
+		m.logger.Info("quitting with work in progress", "active", m.active)
+		m.stopBroadcast()
+		m.stopForward()
+		m.sessions.closeAll()
+		return m, tea.Quit
+	case key.Matches(msg, quitCancel, m.keys.Back):
+		m.confirmQuit = false
+	}
+	return m, nil
+}
+
+// quitConfirmView renders the quit prompt, shown over the current view until it is answered.
+func (m mainModel) quitConfirmView() string {
+	tasks := "1 task is"
+	if m.active != 1 {
+		tasks = fmt.Sprintf("%d tasks are", m.active)
+	}
+	yes, no, back := quitConfirm.Help(), quitCancel.Help(), m.keys.Back.Help()
+	keys := fmt.Sprintf("%s %s • %s/%s %s", yes.Key, yes.Desc, no.Key, back.Key, no.Desc)
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(m.theme.Accent).
+		Padding(1, 2).
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			m.textStyle(tasks+" still running. Cancel and quit?"),
+			"",
+			lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(keys)))
+}
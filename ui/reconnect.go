@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+)
+
+const maxReconnectBackoff = 30 * time.Second
+
+type (
+	// reconnectState tracks an attempt to get back to a device after its session dropped.
+	reconnectState struct {
+		hostname string
+		attempt  int
+		err      error
+	}
+
+	// reconnectMsg fires once the backoff before the next reconnect attempt has passed.
+	reconnectMsg struct {
+		hostname string
+		attempt  int
+	}
+)
+
+// isDisconnect reports whether err ended a session because the connection dropped, rather than because the remote
+// shell exited, which is how leaving with exit or ctrl+d ends a session.
+func isDisconnect(err error) bool {
+	if isRemoteExit(err) {
+		return false
+	}
+	var missingErr *ssh.ExitMissingError
+	var netErr net.Error
+	return errors.As(err, &missingErr) || errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// isRemoteExit reports whether err carries the exit status of the remote shell.
+func isRemoteExit(err error) bool {
+	var exitErr *ssh.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// reconnectBackoff doubles the wait after each failed attempt, starting at one second.
+func reconnectBackoff(attempt int) time.Duration {
+	backoff := time.Second << (attempt - 1)
+	if backoff <= 0 || backoff > maxReconnectBackoff {
+		return maxReconnectBackoff
+	}
+	return backoff
+}
+
+// scheduleReconnect waits out the backoff for the next attempt, or gives up once reconnect_attempts is used up.
+func (m *mainModel) scheduleReconnect(hostname string, err error) (*mainModel, tea.Cmd) {
+	attempt := 1
+	if m.reconnect.hostname == hostname {
+		attempt = m.reconnect.attempt + 1
+	}
+	if attempt > m.cfg.ReconnectAttempts {
+		m.reconnect = reconnectState{}
+		m.err = fmt.Errorf("%v: gave up reconnecting to %s", err, hostname)
+		m.state = stateFailure
+		return m, nil
+	}
+
+	m.logger.Warn("session dropped, reconnecting", "action", "reconnect", "host", hostname, "attempt", attempt, "error", err)
+	m.reconnect = reconnectState{hostname: hostname, attempt: attempt, err: err}
+	m.state = stateReconnecting
+	return m, tea.Tick(reconnectBackoff(attempt), func(time.Time) tea.Msg {
+		return reconnectMsg{hostname: hostname, attempt: attempt}
+	})
+}
+
+// handleReconnect starts the next session attempt, unless reconnecting was cancelled in the meantime.
+func (m *mainModel) handleReconnect(msg reconnectMsg) (*mainModel, tea.Cmd) {
+	if m.state != stateReconnecting || m.reconnect.hostname != msg.hostname || m.reconnect.attempt != msg.attempt {
+		return m, nil
+	}
+	return m, m.sshDevice(msg.hostname)
+}
+
+func (m mainModel) reconnectView() string {
+	r := m.reconnect
+	back := m.keys.Back.Help()
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(),
+			m.textStyle(fmt.Sprintf(" Reconnecting to %s (attempt %d of %d)...", r.hostname, r.attempt, m.cfg.ReconnectAttempts))),
+		lipgloss.NewStyle().Foreground(m.theme.Muted).Render("Connection lost: "+r.err.Error()),
+		lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key+" cancel"),
+	)
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"context"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// refreshTick is sent every refresh_interval to refresh the device list in the background.
+	refreshTick struct{}
+
+	// devicesRefreshed is sent once a background refresh of profile's devices has finished.
+	devicesRefreshed struct {
+		profile string
+		fetch   int
+		devices []tailscale.Device
+		err     error
+	}
+)
+
+// scheduleRefresh returns a command that sends the next refreshTick after refresh_interval, or nil if refreshing is
+// turned off. Only one tick is ever pending: each either starts a refresh, whose result schedules the next tick, or
+// schedules the next tick itself.
+func (m *mainModel) scheduleRefresh() tea.Cmd {
+	if m.cfg.RefreshInterval <= 0 {
+		return nil
+	}
+	return tea.Tick(m.cfg.RefreshInterval, func(time.Time) tea.Msg { return refreshTick{} })
+}
+
+// handleRefreshTick refreshes the device list, once it has loaded and unless a fetch is already in flight.
+func (m *mainModel) handleRefreshTick() (*mainModel, tea.Cmd) {
+	if m.devices == nil || m.fetch.cancel != nil {
+		return m, m.scheduleRefresh()
+	}
+	return m, tea.Batch(m.refreshDevices(), m.fetchLocalStatus())
+}
+
+// refreshDevices returns a command that fetches the devices without showing the loading screen.
+func (m *mainModel) refreshDevices() tea.Cmd {
+	ts, timeout, profile, fetch := m.ts, m.cfg.APITimeout, m.profile, m.fetch.id
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		var devices []tailscale.Device
+		err := ts.StreamDevices(ctx, func(device tailscale.Device) {
+			devices = append(devices, device)
+		})
+		return devicesRefreshed{profile: profile, fetch: fetch, devices: devices, err: err}
+	}
+}
+
+// handleDevicesRefreshed replaces the listed devices with refreshed ones, keeping the selection and filter. Failed
+// refreshes leave the list as it was. Refreshes overtaken by a fetch or a switch of tailnet are dropped.
+func (m *mainModel) handleDevicesRefreshed(msg devicesRefreshed) (*mainModel, tea.Cmd) {
+	if msg.err != nil {
+		m.logger.Warn("refreshing devices failed", "action", "refresh", "error", msg.err)
+		return m, m.scheduleRefresh()
+	}
+	if msg.profile != m.profile || msg.fetch != m.fetch.id || m.fetch.cancel != nil {
+		return m, m.scheduleRefresh()
+	}
+	m.logger.Debug("refreshed devices", "action", "refresh", "count", len(msg.devices))
+	m.cacheDevices(msg.devices, time.Now())
+	m.devices = msg.devices
+	return m, tea.Batch(m.relistDevices(), m.scheduleRefresh())
+}
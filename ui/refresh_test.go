@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh/config"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestRefreshKeepsSelection(t *testing.T) {
+	// the device cache is saved to the config directory.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Default()
+	cfg.TagFilter = ""
+	cfg.RefreshInterval = time.Minute
+	m := newTestModel(t, cfg)
+	m.fetch = fetchState{id: 1, cancel: func() {}}
+	m.handleResult(Result[[]tailscale.Device]{Success: testDevices("web-1", "db-1", "web-2"), Fetch: 1})
+	if m.state != stateDevice {
+		t.Fatalf("state = %v, want the device list", m.state)
+	}
+	selected := func() string {
+		item, _ := m.deviceList.Selected()
+		return item.Name
+	}
+	for i := 0; i < 5 && selected() != "db-1"; i++ {
+		m.handleKeyPress(keyPress("down"))
+	}
+	if selected() != "db-1" {
+		t.Fatalf("selected %q, want db-1", selected())
+	}
+
+	refreshed := testDevices("cache-1", "web-1", "db-1", "web-2")
+	refreshed[2].LastSeen = tailscale.Time{Time: time.Now()}
+	m.handleDevicesRefreshed(devicesRefreshed{profile: m.profile, fetch: m.fetch.id, devices: refreshed})
+	if len(m.devices) != 4 {
+		t.Fatalf("%d devices after the refresh, want 4", len(m.devices))
+	}
+	if selected() != "db-1" {
+		t.Errorf("selected %q after the refresh, want db-1 still", selected())
+	}
+
+	// failed refreshes, and those overtaken by another fetch, leave the list alone.
+	m.handleDevicesRefreshed(devicesRefreshed{profile: m.profile, fetch: m.fetch.id, err: errors.New("timeout")})
+	m.handleDevicesRefreshed(devicesRefreshed{profile: m.profile, fetch: m.fetch.id - 1, devices: testDevices("stale")})
+	m.fetch.cancel = func() {}
+	m.handleDevicesRefreshed(devicesRefreshed{profile: m.profile, fetch: m.fetch.id, devices: testDevices("overtaken")})
+	if len(m.devices) != 4 || selected() != "db-1" {
+		t.Errorf("%d devices selecting %q, want the refreshed list left alone", len(m.devices), selected())
+	}
+}
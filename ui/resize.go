@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"golang.org/x/term"
+)
+
+// termSize is the size of a terminal in cells.
+type termSize struct {
+	width, height int
+}
+
+// sizeChanges reads the size of the terminal fd each time check fires, sending it on the returned channel when it
+// has changed. Once done is closed it calls stop and closes the channel.
+func sizeChanges[T any](fd int, check <-chan T, done <-chan struct{}, stop func()) <-chan termSize {
+	changes := make(chan termSize)
+	go func() {
+		defer close(changes)
+		defer stop()
+		last, _ := getTermSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-check:
+			}
+			size, ok := getTermSize(fd)
+			if !ok || size == last {
+				continue
+			}
+			last = size
+			select {
+			case changes <- size:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// getTermSize returns the size of the terminal fd, if it is one.
+func getTermSize(fd int) (termSize, bool) {
+	width, height, err := term.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		return termSize{}, false
+	}
+	return termSize{width: width, height: height}, true
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package ui
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchTerminalSize sends the size of the terminal fd each time it changes, as the SIGWINCH it gets then says,
+// until done is closed.
+func watchTerminalSize(fd int, done <-chan struct{}) <-chan termSize {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+	return sizeChanges(fd, sigs, done, func() { signal.Stop(sigs) })
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package ui
+
+import (
+	"time"
+)
+
+// resizePollInterval is how often the terminal size is checked on Windows, which has no SIGWINCH.
+const resizePollInterval = 250 * time.Millisecond
+
+// watchTerminalSize sends the size of the terminal fd each time it changes, checking it every
+// resizePollInterval, until done is closed.
+func watchTerminalSize(fd int, done <-chan struct{}) <-chan termSize {
+	ticker := time.NewTicker(resizePollInterval)
+	return sizeChanges(fd, ticker.C, done, ticker.Stop)
+}
@@ -0,0 +1,26 @@
+package ui
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// retryAction is the last action started that can end in the failure view, which the failure view offers to
+// redo.
+type retryAction struct {
+	// what describes the action, as in "retry connecting to web-1".
+	what string
+	run  func() tea.Cmd
+}
+
+// handleFailureKeyPress redoes the action that failed, or goes back to the main menu.
+func (m *mainModel) handleFailureKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Refresh, m.keys.Choose) && m.retry.run != nil:
+		m.logger.Info("retrying", "action", m.retry.what, "error", m.err)
+		return m, m.retry.run()
+	case key.Matches(msg, m.keys.Back):
+		m.state = stateMenu
+	}
+	return m, nil
+}
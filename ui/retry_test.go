@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/acmacalister/tssh"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// failingDevices is a TailscaleService whose device list can't be fetched. Its other methods aren't implemented.
+type failingDevices struct {
+	tssh.TailscaleService
+	err error
+}
+
+func (f failingDevices) StreamDevices(context.Context, func(tailscale.Device)) error { return f.err }
+
+func TestRetryFetch(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.ts = failingDevices{err: errors.New("503 service unavailable")}
+	m.startFetch()
+	fetch := m.fetch.id
+	m.handleResult(Result[[]tailscale.Device]{Error: errors.New("503 service unavailable"), Fetch: fetch})
+	if m.state != stateFailure {
+		t.Fatalf("state = %v, want the failure view", m.state)
+	}
+	if view := m.View(); !strings.Contains(view, "retry fetching devices") {
+		t.Errorf("view = %q, want retrying offered", view)
+	}
+
+	if _, cmd := m.handleKeyPress(keyPress("r")); cmd == nil {
+		t.Fatal("retrying started nothing")
+	}
+	if m.state != stateLoading || m.fetch.id != fetch+1 || m.fetch.cancel == nil {
+		t.Errorf("state = %v with fetch %d, want a new fetch loading", m.state, m.fetch.id)
+	}
+	m.stopFetch()
+}
+
+func TestRetrySession(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.sshDevice("web-1")
+	m.handleSessionFinished(sessionFinished{hostname: "web-1", err: errors.New("connection refused")})
+	if m.state != stateFailure {
+		t.Fatalf("state = %v, want the failure view", m.state)
+	}
+	if m.retry.what != "connecting to web-1" {
+		t.Errorf("retry = %q, want the connection", m.retry.what)
+	}
+	if _, cmd := m.handleKeyPress(keyPress("enter")); cmd == nil {
+		t.Error("retrying started nothing, want the session started again")
+	}
+}
+
+func TestFailureWithoutRetry(t *testing.T) {
+	m := newTestModel(t, nil)
+	m.err = errors.New("no tailnet")
+	m.state = stateFailure
+	if view := m.View(); strings.Contains(view, "retry") {
+		t.Errorf("view = %q, want no retry offered with nothing to retry", view)
+	}
+	if _, cmd := m.handleKeyPress(keyPress("r")); cmd != nil || m.state != stateFailure {
+		t.Errorf("r with nothing to retry left state %v, want the failure view", m.state)
+	}
+	m.handleKeyPress(keyPress("esc"))
+	if m.state != stateMenu {
+		t.Errorf("state = %v, want back to the menu", m.state)
+	}
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// deviceRoutes is what is known of a device's subnet routes: the routes once fetched, or why they couldn't be.
+	deviceRoutes struct {
+		routes *tailscale.DeviceRoutes
+		err    error
+	}
+
+	// routesFetched is sent once a device's routes have been fetched.
+	routesFetched struct {
+		id string
+		deviceRoutes
+	}
+)
+
+// exitRoutes are the routes a device advertises to offer itself as an exit node.
+var exitRoutes = []string{"0.0.0.0/0", "::/0"}
+
+// fetchRoutes returns a command that fetches device's subnet routes, which the device list doesn't include.
+func (m *mainModel) fetchRoutes(device tailscale.Device) tea.Cmd {
+	ts, timeout := m.ts, m.cfg.APITimeout
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		defer cancel()
+		routes, err := ts.DeviceRoutes(ctx, device.ID)
+		return routesFetched{id: device.ID, deviceRoutes: deviceRoutes{routes: routes, err: err}}
+	}
+}
+
+// showDetail shows device's details, fetching its routes the first time and pinging it through tailscaled each
+// time.
+func (m *mainModel) showDetail(device tailscale.Device) tea.Cmd {
+	m.detail = device
+	m.state = stateDetail
+	delete(m.latencies, device.ID)
+	ping := m.pingPeer(device)
+	if r, ok := m.routes[device.ID]; ok && r.err == nil {
+		return ping
+	}
+	delete(m.routes, device.ID)
+	return tea.Batch(m.fetchRoutes(device), ping)
+}
+
+// handleRoutesFetched records a device's routes, and relists the devices for the indicator to show.
+func (m *mainModel) handleRoutesFetched(msg routesFetched) (*mainModel, tea.Cmd) {
+	if msg.err != nil {
+		m.logger.Warn("fetching device routes failed", "device", msg.id, "error", msg.err)
+	}
+	m.routes[msg.id] = msg.deviceRoutes
+	if msg.err != nil {
+		return m, nil
+	}
+	return m, m.relistDevices()
+}
+
+// exitNode describes whether r offers the device as an exit node, and whether that has been approved.
+func (r deviceRoutes) exitNode() string {
+	switch {
+	case r.routes == nil:
+		return ""
+	case enablesAny(r.routes.Enabled, exitRoutes):
+		return "exit node"
+	case enablesAny(r.routes.Advertised, exitRoutes):
+		return "exit node (not approved)"
+	default:
+		return ""
+	}
+}
+
+// subnets returns the subnet routes r advertises, other than those of an exit node, each marked if it hasn't been
+// approved.
+func (r deviceRoutes) subnets() []string {
+	if r.routes == nil {
+		return nil
+	}
+	var subnets []string
+	for _, route := range r.routes.Advertised {
+		if slices.Contains(exitRoutes, route) {
+			continue
+		}
+		if !slices.Contains(r.routes.Enabled, route) {
+			route += " (not approved)"
+		}
+		subnets = append(subnets, route)
+	}
+	return subnets
+}
+
+// indicator summarises r for the device list: whether the device is an exit node and whether it routes subnets.
+func (r deviceRoutes) indicator() string {
+	var parts []string
+	if exit := r.exitNode(); exit != "" {
+		parts = append(parts, "⇄ "+exit)
+	}
+	if len(r.subnets()) > 0 {
+		parts = append(parts, "⇄ subnet router")
+	}
+	return strings.Join(parts, " • ")
+}
+
+func enablesAny(routes, of []string) bool {
+	for _, route := range routes {
+		if slices.Contains(of, route) {
+			return true
+		}
+	}
+	return false
+}
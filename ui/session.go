@@ -0,0 +1,302 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/asciicast"
+	"github.com/acmacalister/tssh/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const (
+	// quickExit is how soon an on connect command has to fail for tssh to fall back to a shell.
+	quickExit = 2 * time.Second
+
+	// ptyWidth and ptyHeight size the pty of sessions whose output isn't a terminal to read the size of.
+	ptyTerm   = "xterm"
+	ptyWidth  = 80
+	ptyHeight = 40
+)
+
+// errPTYRefused is returned when a device that refused a pty also failed to start a session without one.
+var errPTYRefused = errors.New("remote refused PTY allocation")
+
+type (
+	// sshSession is an interactive shell on a device, run through tea.Exec so that bubbletea hands the terminal
+	// over for the length of the session and takes it back afterwards.
+	sshSession struct {
+		m        *mainModel
+		hostname string
+		stdin    io.Reader
+		stdout   io.Writer
+		stderr   io.Writer
+		// id identifies the session in the log and its recording's name.
+		id string
+		// stats counts the session's traffic if session_stats is set, and is nil otherwise.
+		stats *sessionStats
+	}
+
+	// sessionFinished is sent once an ssh session ends, with the error that ended it if any, and its stats if
+	// they were counted.
+	sessionFinished struct {
+		hostname string
+		session  string
+		err      error
+		stats    *sessionStats
+	}
+)
+
+func (s *sshSession) SetStdin(r io.Reader)  { s.stdin = r }
+func (s *sshSession) SetStdout(w io.Writer) { s.stdout = w }
+func (s *sshSession) SetStderr(w io.Writer) { s.stderr = w }
+
+// connect returns a client for hostname, reached as t says, from the connection pool, dialling through any proxy
+// command and jump hosts if there is no pooled client. release must be called once the client is no longer needed.
+// t is resolved with target on the UI goroutine, as it reads the model, so that connect can run off it.
+func (m *mainModel) connect(t sshTarget, hostname, action string) (*ssh.Client, func(), error) {
+	m.logger.Info("connecting", "action", action, "host", hostname, "user", t.user, "addr", t.addr, "jump_hosts", len(t.hops), "proxy_command", t.proxyCommand)
+	return m.pool.get(t.user+"@"+t.addr, func() (*ssh.Client, func() error, error) {
+		hops, err := t.jumpHosts()
+		if err != nil {
+			return nil, nil, err
+		}
+		return dialChain(t.dialer(m.cfg.ConnectTimeout), hops, t.addr, t.clientConfig(m.cfg.ConnectTimeout))
+	})
+}
+
+func (s *sshSession) Run() error {
+	t, err := s.m.target(s.hostname)
+	if err != nil {
+		return err
+	}
+	client, release, err := s.m.connect(t, s.hostname, "ssh")
+	if err != nil {
+		return err
+	}
+	defer release()
+	if s.stats != nil {
+		s.stats.start = time.Now()
+		defer func() { s.stats.end = time.Now() }()
+	}
+
+	command := s.m.cfg.OnConnectCommand(s.hostname)
+	if command == "" {
+		return s.shell(client, s.m.remoteCommand(s.hostname, ""))
+	}
+
+	start := time.Now()
+	err = s.shell(client, s.m.remoteCommand(s.hostname, command))
+	if isRemoteExit(err) && time.Since(start) < quickExit {
+		// the command failed straight away, e.g. tmux attach with no session to attach to, so rather than
+		// dropping the user back to the device list, open a shell.
+		s.m.logger.Warn("on connect command exited immediately", "action", "ssh", "session", s.id, "host", s.hostname, "command", command, "error", err)
+		fmt.Fprintf(s.stderr, "\r\n%s exited immediately (%v), opening a shell\r\n", command, err)
+		return s.shell(client, s.m.remoteCommand(s.hostname, ""))
+	}
+	return err
+}
+
+// remoteCommand returns what to run on hostname for a session running command, or a shell if command is "". A
+// shell request already starts the user's login shell, so "" is returned for that; otherwise sshd runs the
+// command with "$SHELL -c", which is neither a login nor an interactive shell, so it is wrapped to get the one
+// configured.
+func (m *mainModel) remoteCommand(hostname, command string) string {
+	login := m.cfg.UseLoginShell(hostname)
+	switch {
+	case command == "" && login:
+		return ""
+	case command == "":
+		return `exec "$SHELL"`
+	case login:
+		return `exec "$SHELL" -l -c ` + shellQuote(command)
+	}
+	return command
+}
+
+// shellQuote quotes s as a single argument for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shell runs an interactive session with a pty, starting command in it instead of the login shell if one is given.
+func (s *sshSession) shell(client *ssh.Client, command string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("%v failed to open session", err)
+	}
+	defer session.Close()
+
+	session.Stdin, session.Stdout, session.Stderr = s.stdin, s.stdout, s.stderr
+	size := termSize{width: ptyWidth, height: ptyHeight}
+	fd, isTerminal := s.terminal()
+	if isTerminal {
+		if current, ok := getTermSize(fd); ok {
+			size = current
+		}
+	}
+	var idle *idleWatcher
+	if timeout := s.m.cfg.IdleTimeout; timeout > 0 {
+		idle = newIdleWatcher(s.stdin, s.stdout, timeout, s.m.cfg.IdleWarning)
+		session.Stdin = idle
+	}
+	var recorder *asciicast.Recorder
+	if dir := s.m.cfg.RecordDir; dir != "" {
+		recorder, err = startRecording(dir, s.hostname, s.id, size)
+		if err != nil {
+			return fmt.Errorf("%v failed to start recording", err)
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				s.m.logger.Warn("recording failed", "action", "ssh", "session", s.id, "host", s.hostname, "path", recorder.Path(), "error", err)
+			}
+		}()
+		s.m.logger.Info("recording session", "action", "ssh", "session", s.id, "host", s.hostname, "path", recorder.Path())
+		// with a pty the remote sends everything on stdout, so that is all there is to record.
+		session.Stdout = io.MultiWriter(s.stdout, recorder)
+	}
+	if s.stats != nil {
+		session.Stdin = countingReader{r: session.Stdin, n: &s.stats.sent}
+		session.Stdout = countingWriter{w: session.Stdout, n: &s.stats.received}
+		session.Stderr = countingWriter{w: session.Stderr, n: &s.stats.received}
+	}
+	// network gear and minimal containers often refuse to allocate a pty. Rather than fail, carry on without one,
+	// which works for line based shells and CLIs.
+	pty := true
+	if err := session.RequestPty(ptyTerm, size.height, size.width, ssh.TerminalModes{}); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%v failed to request pty", err)
+		}
+		s.m.logger.Warn("remote refused pty allocation", "action", "ssh", "session", s.id, "host", s.hostname, "error", err)
+		fmt.Fprintf(s.stderr, "%s, continuing without a terminal\r\n", errPTYRefused)
+		pty = false
+	}
+
+	// the terminal is handed over as bubbletea left it, in cooked mode; put it in raw mode so that keys such as
+	// ctrl+c reach the remote rather than signalling tssh, and restore it however the session ends. Without a pty
+	// the remote doesn't echo or edit lines, so the terminal is left to do that.
+	if f, ok := s.stdin.(*os.File); ok && pty && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return fmt.Errorf("%v failed to put terminal in raw mode", err)
+		}
+		defer term.Restore(int(f.Fd()), state)
+	}
+	defer s.m.sessions.add(func() { session.Close() })()
+
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil && !pty {
+		return fmt.Errorf("%w: %v", errPTYRefused, err)
+	}
+	if err != nil {
+		return err
+	}
+	if pty && isTerminal {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.forwardResizes(session, watchTerminalSize(fd, stop), recorder)
+	}
+	if idle == nil {
+		return session.Wait()
+	}
+
+	done := make(chan struct{})
+	go idle.watch(done, func() {
+		s.m.logger.Info("closing idle session", "action", "ssh", "session", s.id, "host", s.hostname, "idle_timeout", s.m.cfg.IdleTimeout)
+		session.Close()
+	})
+	err = session.Wait()
+	close(done)
+	if idleErr := idle.err(); idleErr != nil {
+		return idleErr
+	}
+	return err
+}
+
+// terminal returns the file descriptor of the terminal the session is shown on, if its output is one.
+func (s *sshSession) terminal() (int, bool) {
+	if f, ok := s.stdout.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return int(f.Fd()), true
+	}
+	return 0, false
+}
+
+// forwardResizes tells the remote each time the local terminal changes size, with a window-change request, so
+// that full screen programs such as vim redraw to fit, and records the new size if the session is being recorded.
+func (s *sshSession) forwardResizes(session *ssh.Session, changes <-chan termSize, recorder *asciicast.Recorder) {
+	for size := range changes {
+		if err := session.WindowChange(size.height, size.width); err != nil {
+			s.m.logger.Debug("sending window change failed", "action", "ssh", "session", s.id, "host", s.hostname, "error", err)
+			continue
+		}
+		if recorder != nil {
+			recorder.Resize(size.width, size.height)
+		}
+	}
+}
+
+// startRecording creates a recording for session id on hostname in dir, named after the host, start time and id,
+// of a terminal starting out at size.
+func startRecording(dir, hostname, id string, size termSize) (*asciicast.Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s-%s.cast", hostname, time.Now().Format("20060102-150405.000"), id)
+	return asciicast.Create(filepath.Join(dir, name), asciicast.Header{Width: size.width, Height: size.height, Title: hostname, Term: ptyTerm})
+}
+
+// sshDevice returns a command that runs an interactive session on hostname, with the client chosen by ssh_client
+// and between any connection hooks, and reports how it ended with a sessionFinished message.
+func (m *mainModel) sshDevice(hostname string) tea.Cmd {
+	if m.cfg.SSHClient == config.SSHClientSystem {
+		return m.systemSSH(hostname)
+	}
+	m.retry = retryAction{what: "connecting to " + hostname, run: func() tea.Cmd { return m.sshDevice(hostname) }}
+	id := tssh.NewSessionID()
+	m.logger.Info("starting session", "action", "ssh", "session", id, "host", hostname)
+	session := &sshSession{m: m, hostname: hostname, id: id}
+	if m.cfg.SessionStats {
+		session.stats = &sessionStats{hostname: hostname}
+	}
+	return tea.Exec(m.withHooks(hostname, session), func(err error) tea.Msg {
+		return sessionFinished{hostname: hostname, session: id, err: err, stats: session.stats}
+	})
+}
+
+// handleSessionFinished returns to the main menu after a session, or shows why the session failed. Sessions that
+// drop unexpectedly, and failed attempts to get them back, are retried while reconnect attempts remain.
+func (m *mainModel) handleSessionFinished(msg sessionFinished) (*mainModel, tea.Cmd) {
+	reconnecting := m.state == stateReconnecting && m.reconnect.hostname == msg.hostname
+	if msg.err != nil && m.cfg.ReconnectAttempts > 0 && !isRemoteExit(msg.err) && (reconnecting || isDisconnect(msg.err)) {
+		return m.scheduleReconnect(msg.hostname, msg.err)
+	}
+
+	m.reconnect = reconnectState{}
+	next := stateMenu
+	if msg.err != nil {
+		m.logger.Error("ssh session failed", "action", "ssh", "session", msg.session, "host", msg.hostname, "error", msg.err)
+		m.err = msg.err
+		next = stateFailure
+	}
+	// sessions that never got as far as connecting have no stats worth showing.
+	if msg.stats != nil && !msg.stats.start.IsZero() {
+		m.sessionSummary = msg.stats.summary(msg.err, next)
+		m.state = stateSessionStats
+		return m, nil
+	}
+	m.state = next
+	return m, nil
+}
@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+	gliderssh "github.com/gliderlabs/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestServer serves srv on a local port for the length of the test, with a fresh host key and no
+// authentication, and returns a client logged in to it.
+func startTestServer(t *testing.T, srv *gliderssh.Server) *ssh.Client {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestShellWithoutPTY(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		allowPTY   bool
+		wantOutput string
+		wantStderr string
+	}{
+		{name: "pty", allowPTY: true, wantOutput: "pty"},
+		{name: "refused", allowPTY: false, wantOutput: "no pty", wantStderr: errPTYRefused.Error()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := startTestServer(t, &gliderssh.Server{
+				Handler: func(s gliderssh.Session) {
+					if _, _, isPty := s.Pty(); isPty {
+						io.WriteString(s, "pty\n")
+					} else {
+						io.WriteString(s, "no pty\n")
+					}
+				},
+				PtyCallback: func(gliderssh.Context, gliderssh.Pty) bool { return test.allowPTY },
+			})
+
+			var stdout, stderr bytes.Buffer
+			session := &sshSession{m: newTestModel(t, nil), hostname: "web-1", id: "test", stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr}
+			if err := session.shell(client, ""); err != nil {
+				t.Fatalf("shell: %v", err)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != test.wantOutput {
+				t.Errorf("output = %q, want %q", got, test.wantOutput)
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), test.wantStderr)
+			}
+			if test.wantStderr == "" && stderr.Len() > 0 {
+				t.Errorf("stderr = %q, want nothing", stderr.String())
+			}
+		})
+	}
+}
+
+func TestForwardResizes(t *testing.T) {
+	client := startTestServer(t, &gliderssh.Server{
+		Handler: func(s gliderssh.Session) {
+			// the pty's size comes first, then every window change.
+			_, windows, _ := s.Pty()
+			for w := range windows {
+				fmt.Fprintf(s, "%dx%d\n", w.Width, w.Height)
+				if w.Width == 120 {
+					return
+				}
+			}
+		},
+	})
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty(ptyTerm, ptyHeight, ptyWidth, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	recorder, err := startRecording(dir, "web-1", "test", termSize{width: ptyWidth, height: ptyHeight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan termSize, 1)
+	changes <- termSize{width: 120, height: 50}
+	close(changes)
+	s := &sshSession{m: newTestModel(t, nil), hostname: "web-1", id: "test"}
+	s.forwardResizes(session, changes, recorder)
+
+	lines := bufio.NewScanner(stdout)
+	for _, want := range []string{"80x40", "120x50"} {
+		if !lines.Scan() {
+			t.Fatalf("output ended before %s: %v", want, lines.Err())
+		}
+		if got := strings.TrimSpace(lines.Text()); got != want {
+			t.Errorf("remote saw %q, want %q", got, want)
+		}
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(recorder.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"r","120x50"`) {
+		t.Errorf("recording = %s, want the resize recorded", b)
+	}
+}
+
+func TestSessionReturnsToMenu(t *testing.T) {
+	cfg := config.Default()
+	cfg.TagFilter = ""
+	m := newTestModel(t, cfg)
+	m.devices = testDevices("web-1")
+	m.relistDevices()
+	m.state = stateDevice
+
+	m.handleAction(components.ListItem{Name: "web-1", Action: tssh.ActionDeviceSSH})
+	if m.state != stateActions {
+		t.Fatalf("state = %v, want the device menu", m.state)
+	}
+	_, cmd := m.handleAction(components.ListItem{Name: "Shell", Action: tssh.ActionShell})
+	if cmd == nil {
+		t.Fatal("choosing Shell returned no command to run the session")
+	}
+
+	// the session is run by the program, which reports its end as a message rather than the model updating
+	// itself.
+	model, cmd := m.Update(sessionFinished{hostname: "web-1", session: "test"})
+	if model != m || cmd != nil {
+		t.Errorf("Update = %v, %v, want the same model and nothing more to do", model, cmd)
+	}
+	if m.state != stateMenu {
+		t.Fatalf("state = %v after the session, want the main menu", m.state)
+	}
+	if m.err != nil {
+		t.Errorf("err = %v, want none after a clean exit", m.err)
+	}
+	if !strings.Contains(m.View(), "What do you want to do?") {
+		t.Errorf("view = %q, want the main menu", m.View())
+	}
+}
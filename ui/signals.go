@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// activeSessions tracks the sessions that currently own the terminal, so that a signal can end them. bubbletea
+// ignores signals while a session runs, leaving nothing to stop it.
+type activeSessions struct {
+	mu     sync.Mutex
+	next   int
+	closes map[int]func()
+}
+
+// add registers close as the way to end a session, returning a func to call once the session is over.
+func (a *activeSessions) add(close func()) (done func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closes == nil {
+		a.closes = make(map[int]func())
+	}
+	id := a.next
+	a.next++
+	a.closes[id] = close
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.closes, id)
+	}
+}
+
+// closeAll ends every active session.
+func (a *activeSessions) closeAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, close := range a.closes {
+		close()
+	}
+}
+
+// handleSignals quits p on SIGINT or SIGTERM, first ending any session in progress so that bubbletea gets the
+// terminal back and can restore it. The returned func stops handling signals.
+func (m *mainModel) handleSignals(p *tea.Program) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			m.logger.Info("shutting down", "signal", sig.String())
+			m.sessions.closeAll()
+			p.Quit()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
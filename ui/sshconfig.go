@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/acmacalister/tssh/config"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTarget is everything needed to dial a device. tssh's own settings win, and ~/.ssh/config fills in whatever
+// they leave unset.
+type sshTarget struct {
+	user string
+	addr string
+	hops []jumpHost
+	// subnet, when set, looks up the subnet router the target is reached through, in place of hops.
+	subnet *subnetLookup
+	auth   []ssh.AuthMethod
+	// proxyCommand, when set, is run to reach the first hop in place of dialling it, with its stdio as the
+	// connection.
+	proxyCommand string
+	// algorithms restricts the ciphers, MACs and key exchanges offered, leaving x/crypto's defaults where empty.
+	algorithms ssh.Config
+}
+
+// dialer returns how to open the connection to the target's first hop.
+func (t sshTarget) dialer(timeout time.Duration) dialer {
+	if t.proxyCommand != "" {
+		return proxyCommandDialer(t.proxyCommand, t.user)
+	}
+	return directDialer(timeout)
+}
+
+// jumpHosts returns the hops to dial the target through, looking up its subnet router if it is reached through one.
+func (t sshTarget) jumpHosts() ([]jumpHost, error) {
+	if t.subnet == nil {
+		return t.hops, nil
+	}
+	hop, err := t.subnet.hop()
+	if err != nil {
+		return nil, err
+	}
+	return []jumpHost{hop}, nil
+}
+
+// clientConfig returns the ssh client config for the target.
+func (t sshTarget) clientConfig(timeout time.Duration) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            t.auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+		Config:          t.algorithms,
+	}
+}
+
+// target resolves how to reach hostname. The user is the one last picked for the host in the UI, then tssh's user,
+// then ssh_config's User, then the one user_from_owner works out from the device's owner, then config.DefaultUser. The port and identity files come from
+// ssh_config, and its ProxyJump and ProxyCommand are used when tssh sets no jump chain or proxy command for the host.
+// IP addresses outside the tailnet are reached through the subnet router that routes them when nothing else says how.
+// An identity file chosen for the host in the UI is tried before ssh_config's, and identities with a certificate are
+// tried with it first, see certificates. Hosts without a matching ssh_config entry get ssh's defaults.
+func (m *mainModel) target(hostname string) (sshTarget, error) {
+	get := func(key string) string {
+		val, err := ssh_config.GetStrict(hostname, key)
+		if err != nil {
+			m.logger.Warn("failed to read ssh config", "host", hostname, "key", key, "error", err)
+			return ssh_config.Default(key)
+		}
+		return val
+	}
+
+	t := sshTarget{
+		user: m.rememberedUser(hostname),
+		algorithms: ssh.Config{
+			Ciphers:      m.cfg.Ciphers,
+			MACs:         m.cfg.MACs,
+			KeyExchanges: m.cfg.KeyExchanges,
+		},
+	}
+	if t.user == "" {
+		t.user = m.cfg.User
+	}
+	if t.user == "" {
+		t.user = get("User")
+	}
+	if t.user == "" {
+		t.user = m.ownerUser(hostname)
+	}
+	if t.user == "" {
+		t.user = config.DefaultUser
+	}
+
+	port := get("Port")
+	if port == "" {
+		port = "22"
+	}
+	t.addr = net.JoinHostPort(hostname, port)
+
+	spec, ok := m.cfg.JumpHosts[hostname]
+	if !ok {
+		spec = m.cfg.Jump
+	}
+	if proxyJump := get("ProxyJump"); !ok && spec == "" && proxyJump != "none" {
+		spec = proxyJump
+	}
+	hops, err := parseJumpSpec(spec, t.user)
+	if err != nil {
+		return sshTarget{}, err
+	}
+	t.hops = hops
+
+	command, ok := m.cfg.ProxyCommandHosts[hostname]
+	if !ok {
+		command = m.cfg.ProxyCommand
+	}
+	if proxyCommand := get("ProxyCommand"); !ok && command == "" && proxyCommand != "none" {
+		command = proxyCommand
+	}
+	t.proxyCommand = command
+
+	// addresses outside the tailnet are reached through a subnet router, unless a way to reach them is configured.
+	if addr, ok := subnetAddr(hostname); ok && len(t.hops) == 0 && t.proxyCommand == "" {
+		if _, configured := m.cfg.JumpHosts[hostname]; !configured {
+			t.subnet = m.subnetLookup(addr)
+		}
+	}
+
+	var signers []ssh.Signer
+	var paths []string
+	for _, path := range m.identityPaths(hostname, t.user) {
+		signer, err := loadIdentity(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && path != m.identities[hostname]:
+			m.logger.Debug("identity file not found", "host", hostname, "path", path)
+		case err != nil:
+			m.logger.Warn("skipping identity file", "host", hostname, "path", path, "error", err)
+		default:
+			signers = append(signers, signer)
+			paths = append(paths, path)
+		}
+	}
+	signers = withCertificates(m.certificates(hostname, t.user, paths), signers)
+	if len(signers) > 0 {
+		t.auth = []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+	}
+	return t, nil
+}
+
+// identityPaths returns the identity files to try for hostname, the one chosen for it in the UI first and then
+// ssh_config's IdentityFiles.
+func (m *mainModel) identityPaths(hostname, user string) []string {
+	var paths []string
+	if path, ok := m.identities[hostname]; ok {
+		paths = append(paths, path)
+	}
+	files, err := ssh_config.GetAllStrict(hostname, "IdentityFile")
+	if err != nil {
+		m.logger.Warn("failed to read ssh config", "host", hostname, "key", "IdentityFile", "error", err)
+	}
+	for _, file := range files {
+		paths = append(paths, expandSSHPath(file, hostname, user))
+	}
+	return paths
+}
+
+// loadIdentity reads the private key at path. Keys protected by a passphrase can't be used, as there is no way to
+// ask for it while connecting.
+func loadIdentity(path string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(b)
+}
+
+// expandSSHPath expands a leading ~ and the %d, %h, %r and %% tokens ssh_config allows in IdentityFile paths.
+func expandSSHPath(path, hostname, user string) string {
+	home, _ := os.UserHomeDir()
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(home, path[1:])
+	}
+	return strings.NewReplacer("%d", home, "%h", hostname, "%r", user, "%%", "%").Replace(path)
+}
+
+// ownerUser returns the user user_from_owner works out from the owner of the device named hostname, or "" if there
+// is none.
+func (m *mainModel) ownerUser(hostname string) string {
+	for _, device := range m.devices {
+		if device.Hostname == hostname {
+			return m.cfg.OwnerUser(device.User)
+		}
+	}
+	return ""
+}
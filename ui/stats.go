@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// sessionStats is what the built in client counts of a session, shown after it ends if session_stats is set.
+	sessionStats struct {
+		hostname string
+		start    time.Time
+		end      time.Time
+		sent     atomic.Int64
+		received atomic.Int64
+	}
+
+	// sessionSummary is the session's stats shown once it has ended, and the state to go on to from them.
+	sessionSummary struct {
+		hostname string
+		duration time.Duration
+		sent     int64
+		received int64
+		err      error
+		next     state
+	}
+
+	// countingReader counts the bytes read through it into n.
+	countingReader struct {
+		r io.Reader
+		n *atomic.Int64
+	}
+
+	// countingWriter counts the bytes written through it into n.
+	countingWriter struct {
+		w io.Writer
+		n *atomic.Int64
+	}
+)
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// summary returns the stats of the session ended by err, to go on to next once they have been seen.
+func (s *sessionStats) summary(err error, next state) sessionSummary {
+	return sessionSummary{
+		hostname: s.hostname,
+		duration: s.end.Sub(s.start),
+		sent:     s.sent.Load(),
+		received: s.received.Load(),
+		err:      err,
+		next:     next,
+	}
+}
+
+// exitStatus describes how the remote shell exited, or that it didn't report it because the session was cut off.
+func (s sessionSummary) exitStatus() string {
+	var exitErr *ssh.ExitError
+	switch {
+	case s.err == nil:
+		return "0"
+	case errors.As(s.err, &exitErr) && exitErr.Signal() != "":
+		return fmt.Sprintf("killed by SIG%s", exitErr.Signal())
+	case errors.As(s.err, &exitErr):
+		return fmt.Sprint(exitErr.ExitStatus())
+	default:
+		return "none, " + s.err.Error()
+	}
+}
+
+// formatBytes formats n bytes in the largest binary unit that keeps it at least 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func (m mainModel) sessionStatsView() string {
+	s := m.sessionSummary
+	label := lipgloss.NewStyle().Foreground(m.theme.Muted).Width(12).Render
+	value := lipgloss.NewStyle().Foreground(m.theme.Text).Render
+	status := value
+	if s.err != nil {
+		status = lipgloss.NewStyle().Foreground(m.theme.Accent).Render
+	}
+
+	lines := []string{
+		lipgloss.NewStyle().Foreground(m.theme.Title).Bold(true).Render("Session on " + s.hostname + " ended"),
+		"",
+		label("Duration") + value(s.duration.Round(time.Second).String()),
+		label("Sent") + value(formatBytes(s.sent)),
+		label("Received") + value(formatBytes(s.received)),
+		label("Exit status") + status(s.exitStatus()),
+		"",
+		lipgloss.NewStyle().Foreground(m.theme.Subdued).Render("press any key to continue"),
+	}
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh/config"
+	gliderssh "github.com/gliderlabs/ssh"
+)
+
+func TestSessionStats(t *testing.T) {
+	client := startTestServer(t, &gliderssh.Server{
+		Handler: func(s gliderssh.Session) {
+			line, _ := bufio.NewReader(s).ReadString('\n')
+			io.WriteString(s, "you said "+line)
+			s.Exit(3)
+		},
+	})
+
+	var stdout bytes.Buffer
+	stats := &sessionStats{hostname: "web-1", start: time.Now()}
+	session := &sshSession{m: newTestModel(t, nil), hostname: "web-1", id: "test", stdin: strings.NewReader("hello\n"), stdout: &stdout, stderr: io.Discard, stats: stats}
+	err := session.shell(client, "")
+	stats.end = stats.start.Add(90 * time.Second)
+
+	summary := stats.summary(err, stateMenu)
+	if summary.sent != int64(len("hello\n")) {
+		t.Errorf("sent = %d, want %d", summary.sent, len("hello\n"))
+	}
+	if summary.received != int64(stdout.Len()) || !strings.HasPrefix(stdout.String(), "you said hello") {
+		t.Errorf("received = %d of %q, want every byte of the output counted", summary.received, stdout.String())
+	}
+	if summary.duration != 90*time.Second {
+		t.Errorf("duration = %v, want 1m30s", summary.duration)
+	}
+	if got := summary.exitStatus(); got != "3" {
+		t.Errorf("exit status = %q, want 3", got)
+	}
+}
+
+func TestSessionStatsShown(t *testing.T) {
+	cfg := config.Default()
+	cfg.SessionStats = true
+	start := time.Now()
+	ended := func() *sessionStats {
+		return &sessionStats{hostname: "web-1", start: start, end: start.Add(time.Minute)}
+	}
+	for _, test := range []struct {
+		name  string
+		stats *sessionStats
+		err   error
+		want  state
+		next  state
+	}{
+		{name: "ended", stats: ended(), want: stateSessionStats, next: stateMenu},
+		{name: "failed", stats: ended(), err: errors.New("connection reset"), want: stateSessionStats, next: stateFailure},
+		{name: "never connected", stats: &sessionStats{hostname: "web-1"}, err: errors.New("dial failed"), want: stateFailure},
+		{name: "not counted", want: stateMenu},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestModel(t, cfg)
+			m.handleSessionFinished(sessionFinished{hostname: "web-1", err: test.err, stats: test.stats})
+			if m.state != test.want {
+				t.Fatalf("state = %v, want %v", m.state, test.want)
+			}
+			if m.state != stateSessionStats {
+				return
+			}
+			if !strings.Contains(m.View(), "Session on web-1 ended") {
+				t.Errorf("view = %q, want the session's stats", m.View())
+			}
+			m.handleKeyPress(keyPress("x"))
+			if m.state != test.next {
+				t.Errorf("after a key, state = %v, want %v", m.state, test.next)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 1536: "1.5 KiB", 5 << 20: "5.0 MiB", 3 << 30: "3.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
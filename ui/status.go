@@ -0,0 +1,53 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acmacalister/tssh"
+)
+
+// deviceListStatus returns the device list's title, followed by the tailnet, the user the selected device would be
+// logged in to as, and how many devices the filter leaves showing, so the list says where it is without taking any
+// more lines. Cached lists say how old they are.
+func (m *mainModel) deviceListStatus() string {
+	parts := []string{deviceListTitle}
+	if tailnet := m.tailnet(); tailnet != "" {
+		parts = append(parts, tailnet)
+	}
+	if selected, ok := m.deviceList.Selected(); ok && selected.Action != tssh.ActionNone {
+		parts = append(parts, m.sshUser(selected.Name))
+	}
+	if visible, total := m.deviceList.Count(); visible < total {
+		parts = append(parts, fmt.Sprintf("%d/%d", visible, total))
+	} else {
+		parts = append(parts, fmt.Sprint(total))
+	}
+
+	title := strings.Join(parts, " • ")
+	if !m.offline.IsZero() {
+		title += fmt.Sprintf(" (offline — showing cached data from %s)", m.offline.Local().Format("Jan 2 15:04"))
+	}
+	return title
+}
+
+// tailnet returns the tailnet of the active profile, or the one given on its own when there are no profiles.
+func (m *mainModel) tailnet() string {
+	for _, p := range m.profiles {
+		if p.Name == m.profile {
+			return p.Tailnet
+		}
+	}
+	if m.cfg.Tailnet != "" {
+		return m.cfg.Tailnet
+	}
+	return m.profile
+}
+
+// sshUser returns the user hostname is logged in to as, chosen as target chooses it.
+func (m *mainModel) sshUser(hostname string) string {
+	if user := m.rememberedUser(hostname); user != "" {
+		return user
+	}
+	return m.defaultUser(hostname)
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// errNoSubnetRoute is returned for addresses outside the tailnet that no online device routes to.
+var errNoSubnetRoute = errors.New("no online subnet router has an approved route")
+
+// tailnetPrefixes are the ranges Tailscale gives devices their addresses from. Addresses in them are devices, which
+// are reached directly.
+var tailnetPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("fd7a:115c:a1e0::/48"),
+}
+
+// subnetAddr returns host as an address if it is an IP address outside the tailnet, which can only be reached
+// through a subnet router.
+func subnetAddr(host string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	for _, prefix := range tailnetPrefixes {
+		if prefix.Contains(addr) {
+			return netip.Addr{}, false
+		}
+	}
+	return addr, true
+}
+
+// subnetLookup finds the subnet router to reach addr through while connecting, which takes an API call per online
+// device. It holds a snapshot of what it needs of the model, taken on the UI goroutine, as it runs off it.
+type subnetLookup struct {
+	addr    netip.Addr
+	ts      tssh.TailscaleService
+	devices []tailscale.Device
+	// users are the users last picked for hosts in the UI, by hostname.
+	users  map[string]string
+	cfg    *config.Config
+	logger *slog.Logger
+}
+
+// subnetLookup returns a lookup of the subnet router for addr, using the device list if there is one.
+func (m *mainModel) subnetLookup(addr netip.Addr) *subnetLookup {
+	users := make(map[string]string, len(m.users))
+	for hostname := range m.users {
+		users[hostname] = m.rememberedUser(hostname)
+	}
+	return &subnetLookup{addr: addr, ts: m.ts, devices: slices.Clone(m.devices), users: users, cfg: m.cfg, logger: m.logger}
+}
+
+// hop returns the jump host to reach the address through, logged in to as sshUser would.
+func (l *subnetLookup) hop() (jumpHost, error) {
+	router, err := l.router()
+	if err != nil {
+		return jumpHost{}, fmt.Errorf("%s: %w", l.addr, err)
+	}
+	l.logger.Info("jumping through subnet router", "host", l.addr, "router", router.Hostname)
+	user := l.users[router.Hostname]
+	if user == "" {
+		user = defaultUserFor(l.cfg, router.Hostname, l.cfg.OwnerUser(router.User))
+	}
+	return jumpHost{user: user, addr: net.JoinHostPort(deviceAddress(router), "22")}, nil
+}
+
+// router returns the online device with the most specific approved subnet route containing the address, looking up
+// every online device's routes, as the device list doesn't include them. Exit nodes route everything, so their
+// routes are left out.
+func (l *subnetLookup) router() (tailscale.Device, error) {
+	devices := l.devices
+	if devices == nil {
+		var err error
+		if devices, err = l.ts.Devices(); err != nil {
+			return tailscale.Device{}, fmt.Errorf("%v failed to list devices", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if l.cfg.APITimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), l.cfg.APITimeout)
+	}
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		best tailscale.Device
+		bits = -1
+	)
+	sem := make(chan struct{}, l.cfg.CommandConcurrency)
+	now := time.Now()
+	for _, device := range devices {
+		if !tssh.IsOnline(device, now) {
+			continue
+		}
+		device := device
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			routes, err := l.ts.DeviceRoutes(ctx, device.ID)
+			if err != nil {
+				l.logger.Debug("fetching device routes failed", "device", device.Hostname, "error", err)
+				return
+			}
+			for _, route := range routes.Enabled {
+				prefix, err := netip.ParsePrefix(route)
+				if err != nil || slices.Contains(exitRoutes, route) || !prefix.Contains(l.addr) {
+					continue
+				}
+				mu.Lock()
+				// ties go to the first hostname, so the same router is picked every time.
+				if prefix.Bits() > bits || (prefix.Bits() == bits && device.Hostname < best.Hostname) {
+					best, bits = device, prefix.Bits()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if bits < 0 {
+		return tailscale.Device{}, errNoSubnetRoute
+	}
+	return best, nil
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// fakeRoutes is a TailscaleService listing devices and the routes enabled for them, by device ID. Its other methods
+// aren't implemented.
+type fakeRoutes struct {
+	tssh.TailscaleService
+	devices []tailscale.Device
+	routes  map[string][]string
+}
+
+func (f fakeRoutes) Devices() ([]tailscale.Device, error) { return f.devices, nil }
+
+func (f fakeRoutes) DeviceRoutes(_ context.Context, id string) (*tailscale.DeviceRoutes, error) {
+	return &tailscale.DeviceRoutes{Advertised: f.routes[id], Enabled: f.routes[id]}, nil
+}
+
+func TestSubnetRouter(t *testing.T) {
+	devices := testDevices("wide", "narrow", "narrow-too", "exit", "offline")
+	for i := range devices {
+		devices[i].LastSeen = tailscale.Time{Time: time.Now()}
+	}
+	devices[4].LastSeen = tailscale.Time{Time: time.Now().Add(-time.Hour)}
+	ts := fakeRoutes{devices: devices, routes: map[string][]string{
+		"id-wide":       {"10.0.0.0/8"},
+		"id-narrow":     {"10.1.0.0/16"},
+		"id-narrow-too": {"10.1.0.0/16"},
+		"id-exit":       {"0.0.0.0/0", "::/0"},
+		"id-offline":    {"10.1.2.0/24"},
+	}}
+
+	for _, test := range []struct {
+		addr, want string
+	}{
+		// the most specific route wins, with ties going to the first hostname; offline devices are left out.
+		{addr: "10.1.2.3", want: "narrow"},
+		{addr: "10.2.0.1", want: "wide"},
+		// exit nodes route everything, but aren't subnet routers.
+		{addr: "192.168.1.1"},
+	} {
+		t.Run(test.addr, func(t *testing.T) {
+			m := newTestModel(t, nil)
+			m.ts = ts
+			m.devices = devices
+			router, err := m.subnetLookup(netip.MustParseAddr(test.addr)).router()
+			if test.want == "" {
+				if !errors.Is(err, errNoSubnetRoute) {
+					t.Fatalf("router = %s, %v, want errNoSubnetRoute", router.Hostname, err)
+				}
+				return
+			}
+			if err != nil || router.Hostname != test.want {
+				t.Fatalf("router = %s, %v, want %s", router.Hostname, err, test.want)
+			}
+		})
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		m := newTestModel(t, nil)
+		m.ts = ts
+		m.devices = devices
+		m.users["narrow"] = []string{"admin"}
+		target, err := m.target("10.1.2.3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target.subnet == nil {
+			t.Fatal("no subnet router is looked up for an address outside the tailnet")
+		}
+		// the lookup runs while connecting, after the model may have moved on.
+		m.devices = nil
+		m.users = nil
+		hops, err := target.jumpHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hops) != 1 || hops[0].user != "admin" || hops[0].addr != "100.64.0.2:22" {
+			t.Errorf("hops = %+v, want narrow as admin", hops)
+		}
+	})
+
+	t.Run("no device list", func(t *testing.T) {
+		m := newTestModel(t, nil)
+		m.ts = ts
+		router, err := m.subnetLookup(netip.MustParseAddr("10.1.2.3")).router()
+		if err != nil || router.Hostname != "narrow" {
+			t.Errorf("router = %s, %v, want narrow from the devices listed for the lookup", router.Hostname, err)
+		}
+	})
+}
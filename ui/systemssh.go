@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/acmacalister/tssh/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kevinburke/ssh_config"
+)
+
+// systemSSH returns a command that hands the terminal to the system ssh binary for hostname, so that
+// ~/.ssh/config, ProxyCommand, agents and everything else ssh supports apply. The session ends with a
+// sessionFinished message like the embedded client's.
+func (m *mainModel) systemSSH(hostname string) tea.Cmd {
+	args := m.systemArgs(hostname)
+	if command := m.remoteCommand(hostname, m.cfg.OnConnectCommand(hostname)); command != "" {
+		// -t keeps the pty that ssh only allocates for a shell by default.
+		args = append([]string{"-t"}, append(args, command)...)
+	}
+	m.logger.Info("connecting", "action", "system_ssh", "host", hostname, "args", args)
+	m.retry = retryAction{what: "connecting to " + hostname, run: func() tea.Cmd { return m.systemSSH(hostname) }}
+	return m.execProcess(hostname, m.cfg.SSHBinary, args...)
+}
+
+// fileTransfer returns a command that hands the terminal to the system sftp binary for hostname, ending with a
+// sessionFinished message.
+func (m *mainModel) fileTransfer(hostname string) tea.Cmd {
+	args := m.systemArgs(hostname)
+	m.logger.Info("connecting", "action", "sftp", "host", hostname, "args", args)
+	m.retry = retryAction{what: "transferring files with " + hostname, run: func() tea.Cmd { return m.fileTransfer(hostname) }}
+	return m.execProcess(hostname, m.cfg.SFTPBinary, args...)
+}
+
+// execProcess hands the terminal to the program name, between any connection hooks for hostname, reporting how it
+// ended with a sessionFinished message. The process is killed if tssh is told to quit while it runs.
+func (m *mainModel) execProcess(hostname, name string, args ...string) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := m.sessions.add(cancel)
+	return tea.Exec(m.withHooks(hostname, processCommand{exec.CommandContext(ctx, name, args...)}), func(err error) tea.Msg {
+		done()
+		cancel()
+		return sessionFinished{hostname: hostname, err: err}
+	})
+}
+
+// systemArgs returns the arguments for the OpenSSH tools to reach hostname: tssh's jump chain, the identity file
+// chosen for it, proxy command and algorithms, and the destination.
+func (m *mainModel) systemArgs(hostname string) []string {
+	var args []string
+	if spec, ok := m.cfg.JumpHosts[hostname]; ok {
+		if spec != "" {
+			args = append(args, "-J", spec)
+		}
+	} else if m.cfg.Jump != "" {
+		args = append(args, "-J", m.cfg.Jump)
+	}
+	if path, ok := m.identities[hostname]; ok {
+		args = append(args, "-i", path)
+	}
+	if path, ok := m.cfg.CertificateHosts[hostname]; ok {
+		if path != "" {
+			args = append(args, "-o", "CertificateFile="+path)
+		}
+	} else if m.cfg.Certificate != "" {
+		args = append(args, "-o", "CertificateFile="+m.cfg.Certificate)
+	}
+	if command, ok := m.cfg.ProxyCommandHosts[hostname]; ok {
+		if command != "" {
+			args = append(args, "-o", "ProxyCommand="+command)
+		}
+	} else if m.cfg.ProxyCommand != "" {
+		args = append(args, "-o", "ProxyCommand="+m.cfg.ProxyCommand)
+	}
+	for _, option := range []struct {
+		name       string
+		algorithms []string
+	}{
+		{"Ciphers", m.cfg.Ciphers},
+		{"MACs", m.cfg.MACs},
+		{"KexAlgorithms", m.cfg.KeyExchanges},
+	} {
+		if len(option.algorithms) > 0 {
+			args = append(args, "-o", option.name+"="+strings.Join(option.algorithms, ","))
+		}
+	}
+	// ssh reads ~/.ssh/config itself, so the user is only given when tssh picks or sets one or ssh_config doesn't.
+	user := m.rememberedUser(hostname)
+	if user == "" {
+		user = m.cfg.User
+	}
+	if user == "" && ssh_config.Get(hostname, "User") == "" {
+		user = m.ownerUser(hostname)
+		if user == "" {
+			user = config.DefaultUser
+		}
+	}
+	destination := hostname
+	if user != "" {
+		destination = user + "@" + hostname
+	}
+	return append(args, destination)
+}
@@ -1,16 +1,22 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	"github.com/acmacalister/tssh/localapi"
+	tsservice "github.com/acmacalister/tssh/tailscale"
 	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	sshclient "github.com/helloyi/go-sshclient"
 	"github.com/tailscale/tailscale-client-go/tailscale"
-	"golang.org/x/crypto/ssh"
 )
 
 type (
@@ -21,18 +27,92 @@ type (
 	Result[T success] struct {
 		Success T
 		Error   error
+		// Fetch is the ID of the fetch the result is from, so results of fetches since replaced can be ignored.
+		Fetch int
 	}
 
 	mainModel struct {
-		loading    spinner.Model
-		deviceList *components.ListModel
-		mainMenu   *components.ListModel
-		state      state
-		err        error
-		ts         tssh.TailscaleService
+		loading     spinner.Model
+		deviceList  *components.ListModel
+		mainMenu    *components.ListModel
+		state       state
+		err         error
+		ts          tssh.TailscaleService
+		cfg         *config.Config
+		tagFilter   tssh.TagFilter
+		profileList *components.ListModel
+		profiles    []config.Profile
+		profile     string
+		newService  ServiceFactory
+		theme       components.Theme
+		keys        components.KeyMap
+		devices     []tailscale.Device
+		detail      tailscale.Device
+		showHelp    bool
+		width       int
+		height      int
+		fetched     int
+		fetch       fetchState
+		pool        *connPool
+		sessions    *activeSessions
+		connTest    connTestResult
+		logger      *slog.Logger
+		reconnect   reconnectState
+		history     config.History
+		cache       config.DeviceCache
+		// grouping is how the device list is grouped, and collapsed the owner groups collapsed in it.
+		grouping  grouping
+		collapsed map[string]bool
+		command   commandPrompt
+		// commandResult and commandOutput hold the last one-shot command's result and its scrollable output.
+		commandResult commandResult
+		commandOutput viewport.Model
+		broadcast     broadcastState
+		// actionHost is the device the action menu was opened for.
+		actionHost string
+		actionMenu *components.ListModel
+		forward    portForward
+		// offline is when the device list being shown was fetched, if it came from the cache because the API
+		// couldn't be reached.
+		offline time.Time
+		// active counts the commands, broadcasts and port forwards in progress, which quitting asks to confirm.
+		active      int
+		confirmQuit bool
+		// identities are the identity files chosen for devices, and identityList the picker they are chosen in.
+		identities   config.Identities
+		identityList *components.ListModel
+		// users are the usernames devices have been logged in to as, userList the picker they are chosen in and
+		// userPrompt where a new one is typed in.
+		users      config.Users
+		userList   *components.ListModel
+		userPrompt userPrompt
+		// admin is the admin menu of the device it was last opened for.
+		admin adminState
+		// routes holds the subnet routes of the devices whose details have been looked at, keyed by device ID.
+		routes map[string]deviceRoutes
+		// acl is the tailnet's policy file, if the API key can read it, which connections are checked against.
+		acl    *tailscale.ACL
+		access accessWarning
+		// deviceID and host are the device to open a shell on at start, see WithDeviceID and WithHost.
+		deviceID string
+		host     string
+		// local is the machine's tailscaled, if the LocalAPI is used. peers is what it knows of each device, keyed
+		// by Tailscale address, or localErr why that couldn't be read, and latencies the round trips to the devices
+		// pinged, keyed by device ID.
+		local     *localapi.Client
+		peers     map[string]localapi.Peer
+		localErr  error
+		latencies map[string]peerLatency
+		// retry is the last action started that can fail, for the failure view to redo.
+		retry retryAction
+		// sessionSummary is the last session's stats, shown after it ends if session_stats is set.
+		sessionSummary sessionSummary
 	}
 
 	state int
+
+	// Option configures optional behaviour of the UI.
+	Option func(*mainModel)
 )
 
 const (
@@ -40,18 +120,46 @@ const (
 	stateLoading
 	stateFailure
 	stateDevice
-)
-
-var (
-	textStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("69")).Render
-	spinnerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("69"))
+	stateProfiles
+	stateDetail
+	stateTesting
+	stateConnTest
+	stateReconnecting
+	stateCommand
+	stateCommandRunning
+	stateCommandOutput
+	stateActions
+	stateForwardPrompt
+	stateForwarding
+	stateBroadcastOutput
+	stateBroadcastHost
+	stateIdentities
+	stateAccessWarning
+	stateSessionStats
+	stateUsers
+	stateUserPrompt
+	stateAdmin
+	stateAdminConfirm
 )
 
 func (m *mainModel) Init() tea.Cmd {
-	return tea.Batch(m.loading.Tick)
+	if m.deviceID != "" {
+		return tea.Batch(m.loading.Tick, m.scheduleRefresh(), m.resolveDevice(m.deviceID))
+	}
+	if m.host != "" {
+		return tea.Batch(m.loading.Tick, m.scheduleRefresh(), m.sshDevice(m.host))
+	}
+	return tea.Batch(m.loading.Tick, m.scheduleRefresh())
 }
 
 func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.update(msg)
+	// the title shows the selection's user and the filter's count, either of which any message may have changed.
+	m.deviceList.SetTitle(m.deviceListStatus())
+	return model, cmd
+}
+
+func (m *mainModel) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		return m.handleWindow(msg)
@@ -59,10 +167,47 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleKeyPress(msg)
 	case spinner.TickMsg:
 		return m.handleTick(msg)
+	case deviceProgress:
+		return m.handleProgress(msg)
 	case Result[[]tailscale.Device]:
 		return m.handleResult(msg)
+	case fetchTimedOut:
+		return m.handleFetchTimeout(msg)
+	case fetchCanceled:
+		return m, nil
 	case components.ListItem:
 		return m.handleAction(msg)
+	case sessionFinished:
+		return m.handleSessionFinished(msg)
+	case reconnectMsg:
+		return m.handleReconnect(msg)
+	case commandResult:
+		return m.handleCommandResult(msg)
+	case broadcastResult:
+		return m.handleBroadcastResult(msg)
+	case forwardStarted:
+		return m.handleForwardStarted(msg)
+	case forwardStopped:
+		return m.handleForwardStopped(msg)
+	case routesFetched:
+		return m.handleRoutesFetched(msg)
+	case localStatusFetched:
+		return m.handleLocalStatusFetched(msg)
+	case peerPinged:
+		return m.handlePeerPinged(msg)
+	case aclFetched:
+		return m.handleACLFetched(msg)
+	case deviceResolved:
+		return m.handleDeviceResolved(msg)
+	case refreshTick:
+		return m.handleRefreshTick()
+	case devicesRefreshed:
+		return m.handleDevicesRefreshed(msg)
+	case connTestResult:
+		m.logger.Info("connection test finished", "action", "test", "host", msg.hostname, "ok", msg.ok())
+		m.connTest = msg
+		m.state = stateConnTest
+		return m, nil
 	default:
 		return m.handleDefault(msg)
 	}
@@ -70,73 +215,284 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *mainModel) handleKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
 	var cmd tea.Cmd
-	keypress := msg.String()
-	switch keypress {
-	case "ctrl+c", "q":
-		return m, tea.Quit
+	if m.confirmQuit {
+		return m.handleQuitConfirmKeyPress(msg)
+	}
+	// ctrl+c always quits, the quit keys only when they aren't being typed into a filter.
+	if msg.String() == "ctrl+c" || (key.Matches(msg, m.keys.Quit) && !m.filtering()) {
+		return m.quit()
 	}
 
-	if m.state == stateMenu {
-		m.mainMenu, cmd = m.mainMenu.Update(msg)
-		return m, cmd
+	if m.showHelp {
+		if key.Matches(msg, m.keys.Help, m.keys.Back) {
+			m.showHelp = false
+		}
+		return m, nil
+	}
+	if key.Matches(msg, m.keys.Help) && !m.filtering() {
+		m.showHelp = true
+		return m, nil
 	}
 
-	if m.state == stateDevice {
-		m.deviceList, cmd = m.deviceList.Update(msg)
-		return m, cmd
+	switch m.state {
+	case stateMenu:
+		m.mainMenu, cmd = m.mainMenu.Update(msg)
+	case stateDevice:
+		return m.handleDeviceKeyPress(msg)
+	case stateDetail, stateConnTest:
+		if key.Matches(msg, m.keys.Back) {
+			m.state = stateDevice
+		}
+	case stateSessionStats:
+		m.state = m.sessionSummary.next
+	case stateActions:
+		return m.handleActionsKeyPress(msg)
+	case stateIdentities:
+		return m.handleIdentitiesKeyPress(msg)
+	case stateUsers:
+		return m.handleUsersKeyPress(msg)
+	case stateUserPrompt:
+		return m.handleUserPromptKeyPress(msg)
+	case stateAdmin:
+		return m.handleAdminKeyPress(msg)
+	case stateAdminConfirm:
+		return m.handleAdminConfirmKeyPress(msg)
+	case stateAccessWarning:
+		return m.handleAccessWarningKeyPress(msg)
+	case stateForwardPrompt:
+		return m.handleForwardPromptKeyPress(msg)
+	case stateForwarding:
+		return m.handleForwardingKeyPress(msg)
+	case stateCommand:
+		return m.handleCommandKeyPress(msg)
+	case stateCommandOutput:
+		return m.handleCommandOutputKeyPress(msg)
+	case stateBroadcastOutput:
+		return m.handleBroadcastOutputKeyPress(msg)
+	case stateBroadcastHost:
+		return m.handleBroadcastHostKeyPress(msg)
+	case stateCommandRunning:
+		if key.Matches(msg, m.keys.Back) && len(m.command.hosts) > 0 {
+			m.stopBroadcast()
+			m.state = stateDevice
+		}
+	case stateLoading:
+		if key.Matches(msg, m.keys.Back) {
+			m.stopFetch()
+			m.state = stateMenu
+		}
+	case stateFailure:
+		return m.handleFailureKeyPress(msg)
+	case stateReconnecting:
+		if key.Matches(msg, m.keys.Back) {
+			m.reconnect = reconnectState{}
+			m.state = stateDevice
+		}
+	case stateProfiles:
+		if key.Matches(msg, m.keys.Back) && !m.profileList.IsFiltering() {
+			if !m.profileList.IsFiltered() {
+				m.state = stateMenu
+			}
+			m.profileList.ResetFilter()
+			return m, nil
+		}
+		m.profileList, cmd = m.profileList.Update(msg)
 	}
 
 	return m, cmd
 }
 
-func (m *mainModel) handleWindow(msg tea.WindowSizeMsg) (*mainModel, tea.Cmd) {
+func (m *mainModel) handleDeviceKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
 	var cmd tea.Cmd
+	if !m.deviceList.IsFiltering() {
+		switch {
+		case key.Matches(msg, m.keys.Copy):
+			return m, m.copySelectedDevice()
+		case key.Matches(msg, m.keys.SystemSSH):
+			if item, ok := m.deviceList.Selected(); ok {
+				return m.checkAccess(item.Name, stateDevice, func() tea.Cmd { return m.systemSSH(item.Name) })
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Group):
+			return m, m.toggleGrouping(groupTag)
+		case key.Matches(msg, m.keys.GroupOwner):
+			return m, m.toggleGrouping(groupOwner)
+		case key.Matches(msg, m.keys.Compact):
+			m.deviceList.SetCompact(!m.deviceList.IsCompact())
+			if m.deviceList.IsCompact() {
+				return m, m.deviceList.StatusMessage("compact view")
+			}
+			return m, m.deviceList.StatusMessage("expanded view")
+		case key.Matches(msg, m.keys.Select):
+			m.deviceList.ToggleMarked()
+			return m, m.deviceList.StatusMessage(fmt.Sprintf("%d selected", len(m.deviceList.Marked())))
+		case key.Matches(msg, m.keys.Command):
+			// with devices selected the command runs on all of them.
+			if marked := m.deviceList.Marked(); len(marked) > 0 {
+				hostnames := make([]string, len(marked))
+				for i, item := range marked {
+					hostnames[i] = item.Name
+				}
+				return m.startBroadcast(hostnames)
+			}
+			if item, ok := m.deviceList.Selected(); ok {
+				return m.startCommand(item.Name)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Admin):
+			if item, ok := m.deviceList.Selected(); ok {
+				return m.openAdminMenu(item.Name, stateDevice)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Test):
+			if item, ok := m.deviceList.Selected(); ok {
+				item.Action = tssh.ActionTestConnection
+				return m.handleAction(item)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Refresh):
+			return m, m.startFetch()
+		case key.Matches(msg, m.keys.Detail):
+			if device, ok := m.selectedDevice(); ok {
+				return m, m.showDetail(device)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Back):
+			// back first clears an applied filter, then the selection, then leaves the list.
+			switch {
+			case m.deviceList.IsFiltered():
+				m.deviceList.ResetFilter()
+			case len(m.deviceList.Marked()) > 0:
+				m.deviceList.ClearMarked()
+			default:
+				m.state = stateMenu
+			}
+			return m, nil
+		}
+	}
+
 	m.deviceList, cmd = m.deviceList.Update(msg)
 	return m, cmd
 }
 
+// filtering reports whether the list in view is taking filter input.
+func (m *mainModel) filtering() bool {
+	switch m.state {
+	case stateMenu:
+		return m.mainMenu.IsFiltering()
+	case stateDevice:
+		return m.deviceList.IsFiltering()
+	case stateProfiles:
+		return m.profileList.IsFiltering()
+	case stateBroadcastOutput:
+		return m.broadcast.list.IsFiltering()
+	case stateIdentities:
+		return m.identityList.IsFiltering()
+	case stateUsers:
+		return m.userList.IsFiltering()
+	case stateAdmin:
+		return m.admin.list.IsFiltering()
+	case stateCommand, stateForwardPrompt, stateUserPrompt:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleWindow lays every view out for the new size, whichever is showing, so that none is left at the old size
+// to be found broken when navigated back to.
+func (m *mainModel) handleWindow(msg tea.WindowSizeMsg) (*mainModel, tea.Cmd) {
+	m.width, m.height = msg.Width, msg.Height
+	m.commandOutput.Width, m.commandOutput.Height = m.outputSize()
+	m.command.input.Width = m.inputWidth(m.command.input.Prompt)
+	m.forward.input.Width = m.inputWidth(m.forward.input.Prompt)
+	m.userPrompt.input.Width = m.inputWidth(m.userPrompt.input.Prompt)
+
+	var cmds []tea.Cmd
+	// lists built on demand are nil until first shown.
+	for _, l := range []**components.ListModel{&m.mainMenu, &m.deviceList, &m.profileList, &m.actionMenu, &m.broadcast.list, &m.identityList, &m.userList, &m.admin.list} {
+		if *l != nil {
+			var cmd tea.Cmd
+			*l, cmd = (*l).Update(msg)
+			cmds = append(cmds, cmd)
+		}
+	}
+	return m, tea.Batch(cmds...)
+}
+
 func (m *mainModel) handleTick(msg spinner.TickMsg) (*mainModel, tea.Cmd) {
-	var cmd tea.Cmd
-	m.loading, cmd = m.loading.Update(msg)
-	return m, cmd
+	var loadingCmd, listCmd tea.Cmd
+	m.loading, loadingCmd = m.loading.Update(msg)
+	// the device list has its own spinner while devices are streaming in.
+	m.deviceList, listCmd = m.deviceList.Update(msg)
+	return m, tea.Batch(loadingCmd, listCmd)
 }
 
 func (m *mainModel) handleResult(result Result[[]tailscale.Device]) (*mainModel, tea.Cmd) {
+	if result.Fetch != m.fetch.id || m.fetch.cancel == nil {
+		// a fetch that was canceled or replaced, whose result would stop the one in flight.
+		return m, nil
+	}
 	var cmd tea.Cmd
+	streamed := m.fetched
+	m.fetched = 0
+	m.stopFetch()
+	m.deviceList.StopSpinner()
 	if result.Error != nil {
+		m.logger.Error("fetching devices failed", "action", "fetch", "error", result.Error)
+		if cmd, ok := m.showCached(result.Error); ok {
+			return m, cmd
+		}
 		m.state = stateFailure
 		m.err = result.Error
 		return m, cmd
 	}
 
-	listItems := make([]components.ListItem, 0, len(result.Success))
-	for _, device := range result.Success {
-		for _, tag := range device.Tags {
-			if tag == "tag:e2e" {
-				listItems = append(listItems, components.ListItem{Name: device.Hostname, Info: device.User, Action: tssh.ActionDeviceSSH})
-			}
+	m.cacheDevices(result.Success, time.Now())
+	// the list is normally built up batch by batch as devices stream in; rebuild it if any were missed.
+	if streamed != len(result.Success) {
+		m.devices = result.Success
+		if m.grouping != groupNone {
+			cmd = m.deviceList.SetItems(m.groupedItems(result.Success, time.Now())...)
+		} else {
+			cmd = m.deviceList.SetItems(m.deviceItems(result.Success, time.Now())...)
 		}
 	}
-	cmd = m.deviceList.SetItems(listItems...)
 	m.state = stateDevice
 
-	return m, cmd
+	// the policy file can change along with the devices, so it is fetched again with them.
+	m.acl = nil
+	return m, tea.Batch(cmd, m.fetchACL())
 }
 
 func (m *mainModel) handleAction(item components.ListItem) (*mainModel, tea.Cmd) {
 	switch item.Action {
 	case tssh.ActionSSH:
-		m.state = stateLoading
-		go m.fetchDevices()
+		return m, m.startFetch()
+	case tssh.ActionSwitchTailnet:
+		m.state = stateProfiles
+	case tssh.ActionSelectProfile:
+		return m.switchProfile(item.Name)
+	case tssh.ActionTestConnection:
+		m.connTest = connTestResult{hostname: item.Name}
+		m.state = stateTesting
+		return m, m.testConnection(item.Name)
 	case tssh.ActionDeviceSSH:
-		m.state = stateLoading
-		if err := m.sshDevice(item.Name); err != nil {
-			m.err = err
-			m.state = stateFailure
-			return m, nil
-		}
-		m.state = stateMenu
-		m.Update(nil)
+		return m.openDeviceMenu(item)
+	case tssh.ActionCommandResult:
+		return m.showBroadcastHost(item.Name)
+	case tssh.ActionSelectIdentity:
+		return m.useIdentity(item.Address)
+	case tssh.ActionSelectUser:
+		return m.useUser(item.Name)
+	case tssh.ActionOtherUser:
+		return m.startUserPrompt()
+	case tssh.ActionRunAdmin:
+		return m.confirmAdmin(item.Name)
+	case tssh.ActionToggleGroup:
+		return m, m.toggleCollapsed(item)
+	case tssh.ActionShell, tssh.ActionFileTransfer, tssh.ActionPortForward, tssh.ActionDeviceDetail, tssh.ActionCopyAddress, tssh.ActionIdentity, tssh.ActionUser, tssh.ActionAdmin:
+		return m.handleDeviceAction(item.Action)
 	}
 	return m, nil
 }
@@ -148,6 +504,18 @@ func (m *mainModel) handleDefault(msg tea.Msg) (*mainModel, tea.Cmd) {
 		m.mainMenu, cmd = m.mainMenu.Update(msg)
 	case stateDevice:
 		m.deviceList, cmd = m.deviceList.Update(msg)
+	case stateProfiles:
+		m.profileList, cmd = m.profileList.Update(msg)
+	case stateActions:
+		m.actionMenu, cmd = m.actionMenu.Update(msg)
+	case stateBroadcastOutput:
+		m.broadcast.list, cmd = m.broadcast.list.Update(msg)
+	case stateIdentities:
+		m.identityList, cmd = m.identityList.Update(msg)
+	case stateUsers:
+		m.userList, cmd = m.userList.Update(msg)
+	case stateAdmin:
+		m.admin.list, cmd = m.admin.list.Update(msg)
 	case stateLoading:
 		m.loading, cmd = m.loading.Update(msg)
 	}
@@ -156,61 +524,239 @@ func (m *mainModel) handleDefault(msg tea.Msg) (*mainModel, tea.Cmd) {
 }
 
 func (m mainModel) View() string {
+	if m.confirmQuit {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.quitConfirmView())
+	}
+	if m.showHelp {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.helpView())
+	}
+
 	switch m.state {
 	case stateMenu:
 		return m.mainMenu.View()
 	case stateLoading:
-		return lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), textStyle(" Fetching Devices..."))
+		status := " Fetching Devices..."
+		if m.fetched > 0 {
+			status = fmt.Sprintf(" Fetched %d devices...", m.fetched)
+		}
+		return lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), m.textStyle(status))
 	case stateDevice:
+		if m.deviceList.Len() == 0 && m.fetched == 0 {
+			return m.emptyDevicesView()
+		}
 		return m.deviceList.View()
+	case stateProfiles:
+		return m.profileList.View()
+	case stateDetail:
+		return m.detailView()
+	case stateTesting:
+		return lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), m.textStyle(fmt.Sprintf(" Testing %s...", m.connTest.hostname)))
+	case stateConnTest:
+		return m.connTestView()
+	case stateSessionStats:
+		return m.sessionStatsView()
+	case stateReconnecting:
+		return m.reconnectView()
+	case stateActions:
+		return m.actionMenu.View()
+	case stateIdentities:
+		return m.identityList.View()
+	case stateUsers:
+		return m.userList.View()
+	case stateUserPrompt:
+		return m.userPromptView()
+	case stateAdmin:
+		return m.admin.list.View()
+	case stateAdminConfirm:
+		return m.adminConfirmView()
+	case stateAccessWarning:
+		return m.accessWarningView()
+	case stateForwardPrompt:
+		return m.forwardPromptView()
+	case stateForwarding:
+		return m.forwardingView()
+	case stateCommand:
+		return m.commandView()
+	case stateCommandRunning:
+		if len(m.command.hosts) > 0 {
+			back := m.keys.Back.Help()
+			return lipgloss.JoinVertical(lipgloss.Left,
+				lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), m.textStyle(fmt.Sprintf(" Running on %d devices...", len(m.command.hosts)))),
+				"",
+				lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(back.Key+" cancel"))
+		}
+		return lipgloss.JoinHorizontal(lipgloss.Top, m.loading.View(), m.textStyle(fmt.Sprintf(" Running on %s...", m.command.hostname)))
+	case stateCommandOutput:
+		return m.commandOutputView()
+	case stateBroadcastOutput:
+		return m.broadcast.list.View()
+	case stateBroadcastHost:
+		return m.broadcastHostView()
 	case stateFailure:
-		return lipgloss.JoinHorizontal(lipgloss.Top, textStyle(fmt.Sprintf("Failure: %s", m.err.Error())))
+		lines := []string{m.textStyle(fmt.Sprintf("Failure: %s", m.err.Error()))}
+		if hint := failureHint(m.err); hint != "" {
+			lines = append(lines, m.textStyle(hint))
+		}
+		back := m.keys.Back.Help()
+		keys := fmt.Sprintf("%s back", back.Key)
+		if m.retry.run != nil {
+			refresh, choose := m.keys.Refresh.Help(), m.keys.Choose.Help()
+			keys = fmt.Sprintf("%s/%s retry %s • %s", refresh.Key, choose.Key, m.retry.what, keys)
+		}
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(keys))
+		return lipgloss.JoinVertical(lipgloss.Left, lines...)
 
 	}
 
 	return ""
 }
 
-func (m *mainModel) fetchDevices() {
-	devices, err := m.ts.Devices()
-	m.Update(Result[[]tailscale.Device]{Success: devices, Error: err})
+// textStyle renders informational text in the theme's accent color.
+func (m mainModel) textStyle(s string) string {
+	return lipgloss.NewStyle().Foreground(m.theme.Accent).Render(s)
+}
+
+// emptyDevicesView explains why no devices are listed and how to change that, rather than showing an empty list.
+func (m mainModel) emptyDevicesView() string {
+	var reason string
+	if len(m.devices) == 0 {
+		reason = "The tailnet has no devices."
+	} else {
+		reason = fmt.Sprintf("None of the %d devices in the tailnet match the tag filter %q.", len(m.devices), m.cfg.TagFilter)
+	}
+
+	refresh, back := m.keys.Refresh.Help(), m.keys.Back.Help()
+	return m.theme.App.Render(lipgloss.JoinVertical(lipgloss.Left,
+		m.textStyle("No devices found"),
+		"",
+		reason,
+		"Change the filter with the -tag flag, the TSSH_TAG_FILTER environment variable or tag_filter in the config file.",
+		"",
+		lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(fmt.Sprintf("%s refresh • %s back", refresh.Key, back.Key)),
+	))
+}
+
+// failureHint suggests how to recover from err when it is a failure we know the cause of.
+func failureHint(err error) string {
+	switch {
+	case errors.Is(err, tsservice.ErrUnauthorized):
+		return "Check that TAILSCALE_API_KEY is valid and has not expired."
+	case errors.Is(err, tsservice.ErrTailnetNotFound):
+		return "Check that TAILSCALE_TAILNET names a tailnet the API key has access to."
+	case errors.Is(err, errPTYRefused):
+		return "The device doesn't give SSH sessions a terminal, as network gear and containers often don't. Run one-shot commands on it from the device list instead."
+	case errors.Is(err, errNoSubnetRoute):
+		return "Approve a subnet route covering the address in the admin console, or set jump_hosts for it."
+	case errors.Is(err, tsservice.ErrDeviceNotFound):
+		return "Check the device ID, which tssh devices -json lists for every device."
+	case errors.Is(err, tsservice.ErrRateLimited):
+		return "The Tailscale API is rate limiting requests, wait a moment and try again."
+	case errors.Is(err, errFetchTimeout):
+		return "The Tailscale API did not respond in time, check your network connection or raise fetch_timeout."
+	case errors.Is(err, tsservice.ErrNetwork):
+		return "Could not reach the Tailscale API, check your network connection."
+	default:
+		return ""
+	}
 }
 
-func (m *mainModel) sshDevice(hostname string) error {
-	config := &ssh.ClientConfig{
-		User:            "ubuntu",
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+// WithLogger sets the logger the UI records connections and failures to. slog.Default is used when this option
+// is not provided.
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *mainModel) {
+		if logger != nil {
+			m.logger = logger
+		}
 	}
+}
 
-	client, err := sshclient.Dial("tcp", hostname+":22", config)
+func New(ts tssh.TailscaleService, cfg *config.Config, opts ...Option) error {
+	profile := setColorProfile(cfg)
+	theme, err := components.LoadTheme(cfg.Theme, cfg.Colors, cfg.Padding)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
 
-	termConfig := &sshclient.TerminalConfig{
-		Term:   "xterm",
-		Height: 40,
-		Weight: 80,
+	spin, err := components.LoadSpinner(cfg.SpinnerStyle)
+	if err != nil {
+		return err
 	}
 
-	if err := client.Terminal(termConfig).Start(); err != nil {
+	keys := components.LoadKeyMap(cfg.Keys)
+	keys.Admin.SetEnabled(len(cfg.AdminCommands) > 0)
+
+	tagFilter, err := tssh.ParseTagFilter(cfg.TagFilter)
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func New(ts tssh.TailscaleService) error {
-	mm := components.NewList("What do you want to do?", components.ListItem{Name: "SSH to Tailscale Device", Info: "Jump on a device", Action: tssh.ActionSSH})
+	// bubbletea owns the terminal from here on, so anything written with the log package must go to the log file.
+	logPath, err := cfg.LogPath()
+	if err != nil {
+		return err
+	}
+	logFile, err := tea.LogToFile(logPath, "tssh")
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
 
 	m := mainModel{state: stateMenu,
-		mainMenu:   mm,
-		deviceList: components.NewList("Devices"),
-		loading:    spinner.New(spinner.WithSpinner(spinner.Points), spinner.WithStyle(spinnerStyle)),
-		ts:         ts}
+		deviceList:  components.NewList(deviceListTitle, theme, keys),
+		profileList: components.NewList("Tailnets", theme, keys),
+		loading:     spinner.New(spinner.WithSpinner(spin), spinner.WithStyle(lipgloss.NewStyle().Foreground(theme.Accent))),
+		ts:          ts,
+		cfg:         cfg,
+		tagFilter:   tagFilter,
+		theme:       theme,
+		keys:        keys,
+		pool:        newConnPool(cfg.PoolIdleTimeout),
+		sessions:    &activeSessions{},
+		routes:      map[string]deviceRoutes{},
+		latencies:   map[string]peerLatency{},
+		collapsed:   map[string]bool{},
+		logger:      slog.Default()}
+	defer m.pool.closeAll()
+	m.deviceList.SetSpinner(spin)
+	m.deviceList.SetFilteringEnabled(!cfg.DisableFilter)
+	m.deviceList.SetColumns(cfg.DeviceColumns)
+	m.profileList.SetFilteringEnabled(!cfg.DisableFilter)
+	m.deviceList.SetHelpKeys(keys.Refresh, keys.Detail, keys.Copy, keys.Test, keys.Command, keys.Select, keys.SystemSSH, keys.Admin, keys.Group, keys.GroupOwner, keys.Compact, keys.Back, keys.Help)
+	m.profileList.SetHelpKeys(keys.Back, keys.Help)
+
+	for _, opt := range opts {
+		opt(&m)
+	}
+	m.logger.Info("rendering", "color_profile", colorProfileName(profile))
+
+	if m.history, err = config.LoadHistory(); err != nil {
+		m.logger.Warn("loading command history failed", "error", err)
+		m.history = config.History{}
+	}
+	if m.identities, err = config.LoadIdentities(); err != nil {
+		m.logger.Warn("loading identities failed", "error", err)
+		m.identities = config.Identities{}
+	}
+	if m.users, err = config.LoadUsers(); err != nil {
+		m.logger.Warn("loading users failed", "error", err)
+		m.users = config.Users{}
+	}
+	if m.cache, err = config.LoadDeviceCache(); err != nil {
+		m.logger.Warn("loading device cache failed", "error", err)
+		m.cache = config.DeviceCache{}
+	}
+
+	menuItems := []components.ListItem{{Name: "SSH to Tailscale Device", Info: "Jump on a device", Action: tssh.ActionSSH}}
+	if len(m.profiles) > 1 {
+		menuItems = append(menuItems, components.ListItem{Name: "Switch Tailnet", Info: "Use a different profile", Action: tssh.ActionSwitchTailnet})
+		m.profileList.SetItems(m.profileItems()...)
+	}
+	m.mainMenu = components.NewList("What do you want to do?", m.theme, m.keys, menuItems...)
+	m.mainMenu.SetFilteringEnabled(!cfg.DisableFilter)
+	m.mainMenu.SetHelpKeys(keys.Help)
 
 	p := tea.NewProgram(&m)
+	defer m.handleSignals(p)()
 	if _, err := p.Run(); err != nil {
 		return err
 	}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// newTestModel returns a model set up as New sets it up, without a program to run it in, a log file or anything
+// read from the config directory.
+func newTestModel(t *testing.T, cfg *config.Config) *mainModel {
+	t.Helper()
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	theme, err := components.LoadTheme(cfg.Theme, cfg.Colors, cfg.Padding)
+	if err != nil {
+		t.Fatalf("LoadTheme: %v", err)
+	}
+	keys := components.LoadKeyMap(cfg.Keys)
+	keys.Admin.SetEnabled(len(cfg.AdminCommands) > 0)
+	tagFilter, err := tssh.ParseTagFilter(cfg.TagFilter)
+	if err != nil {
+		t.Fatalf("ParseTagFilter: %v", err)
+	}
+
+	m := &mainModel{state: stateMenu,
+		deviceList:  components.NewList(deviceListTitle, theme, keys),
+		profileList: components.NewList("Tailnets", theme, keys),
+		mainMenu:    components.NewList("What do you want to do?", theme, keys, components.ListItem{Name: "SSH to Tailscale Device", Action: tssh.ActionSSH}),
+		loading:     spinner.New(),
+		cfg:         cfg,
+		tagFilter:   tagFilter,
+		theme:       theme,
+		keys:        keys,
+		pool:        newConnPool(cfg.PoolIdleTimeout),
+		sessions:    &activeSessions{},
+		routes:      map[string]deviceRoutes{},
+		latencies:   map[string]peerLatency{},
+		collapsed:   map[string]bool{},
+		history:     config.History{},
+		identities:  config.Identities{},
+		users:       config.Users{},
+		cache:       config.DeviceCache{},
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil))}
+	t.Cleanup(m.pool.closeAll)
+	m.handleWindow(tea.WindowSizeMsg{Width: 100, Height: 40})
+	return m
+}
+
+// keyPress returns the message for pressing k, named as in key bindings.
+func keyPress(k string) tea.KeyMsg {
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+// testDevices returns devices with the given hostnames, each with a distinct ID and address.
+func testDevices(hostnames ...string) []tailscale.Device {
+	devices := make([]tailscale.Device, len(hostnames))
+	for i, hostname := range hostnames {
+		devices[i] = tailscale.Device{
+			ID:        "id-" + hostname,
+			Hostname:  hostname,
+			Name:      hostname + ".example.ts.net",
+			Addresses: []string{"100.64.0." + string(rune('1'+i))},
+			User:      "alice@example.com",
+		}
+	}
+	return devices
+}
+
+func TestResizeEachState(t *testing.T) {
+	cfg := config.Default()
+	cfg.TagFilter = ""
+	cfg.AdminCommands = []config.AdminCommand{{Name: "Reboot", Command: "sudo reboot"}}
+	long := strings.Repeat("a long line of output that wraps ", 10)
+	for _, test := range []struct {
+		name  string
+		setup func(m *mainModel)
+	}{
+		{name: "menu", setup: func(m *mainModel) {}},
+		{name: "loading", setup: func(m *mainModel) { m.state = stateLoading }},
+		{name: "failure", setup: func(m *mainModel) { m.state, m.err = stateFailure, errors.New("fetching devices failed") }},
+		{name: "devices", setup: func(m *mainModel) { m.state = stateDevice }},
+		{name: "device menu", setup: func(m *mainModel) {
+			m.handleAction(components.ListItem{Name: "web-1", Action: tssh.ActionDeviceSSH})
+		}},
+		{name: "detail", setup: func(m *mainModel) { m.detail, m.state = m.devices[0], stateDetail }},
+		{name: "command", setup: func(m *mainModel) { m.startCommand("web-1") }},
+		{name: "command output", setup: func(m *mainModel) {
+			m.startCommand("web-1")
+			m.handleCommandResult(commandResult{hostname: "web-1", command: "cat log", output: strings.Repeat(long+"\n", 50)})
+		}},
+		{name: "forward prompt", setup: func(m *mainModel) { m.startForwardPrompt("web-1") }},
+		{name: "user prompt", setup: func(m *mainModel) { m.actionHost = "web-1"; m.startUserPrompt() }},
+		{name: "admin", setup: func(m *mainModel) { m.openAdminMenu("web-1", stateActions) }},
+		{name: "admin confirm", setup: func(m *mainModel) {
+			m.openAdminMenu("web-1", stateActions)
+			m.confirmAdmin("Reboot")
+		}},
+		{name: "session stats", setup: func(m *mainModel) {
+			now := time.Now()
+			m.handleSessionFinished(sessionFinished{hostname: "web-1", stats: &sessionStats{hostname: "web-1", start: now, end: now}})
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestModel(t, cfg)
+			m.devices = testDevices("web-1", "db-1")
+			m.relistDevices()
+			test.setup(m)
+			want := m.state
+
+			for _, size := range []tea.WindowSizeMsg{{Width: 60, Height: 20}, {Width: 140, Height: 50}, {Width: 80, Height: 24}} {
+				m.Update(size)
+				if m.state != want {
+					t.Fatalf("state = %v after resizing, want %v", m.state, want)
+				}
+				view := m.View()
+				if view == "" {
+					t.Fatalf("%dx%d: view is empty", size.Width, size.Height)
+				}
+				if h := lipgloss.Height(view); h > size.Height {
+					t.Errorf("%dx%d: view is %d high, want it laid out for the new height", size.Width, size.Height, h)
+				}
+				for _, line := range strings.Split(view, "\n") {
+					if w := lipgloss.Width(line); w > size.Width {
+						t.Errorf("%dx%d: line %q is %d wide, want it laid out for the new width", size.Width, size.Height, line, w)
+						break
+					}
+				}
+			}
+		})
+	}
+}
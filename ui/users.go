@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+	components "github.com/acmacalister/tssh/ui/components"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/kevinburke/ssh_config"
+)
+
+// userPrompt is the username being typed in for a device, for logging in as a user it hasn't been before.
+type userPrompt struct {
+	input textinput.Model
+	err   error
+}
+
+// rememberedUser returns the user hostname was last logged in to as through the user picker, or "" if it never was.
+func (m *mainModel) rememberedUser(hostname string) string {
+	if users := m.users[hostname]; len(users) > 0 {
+		return users[0]
+	}
+	return ""
+}
+
+// defaultUser returns the user hostname is logged in to as when none has been picked for it: tssh's user, then
+// ssh_config's User, then the one user_from_owner works out, then config.DefaultUser.
+func (m *mainModel) defaultUser(hostname string) string {
+	return defaultUserFor(m.cfg, hostname, m.ownerUser(hostname))
+}
+
+// defaultUserFor is defaultUser for callers off the UI goroutine, given the user user_from_owner works out for
+// hostname, if any.
+func defaultUserFor(cfg *config.Config, hostname, ownerUser string) string {
+	if cfg.User != "" {
+		return cfg.User
+	}
+	if user := ssh_config.Get(hostname, "User"); user != "" {
+		return user
+	}
+	if ownerUser != "" {
+		return ownerUser
+	}
+	return config.DefaultUser
+}
+
+// openUserPicker lists the users hostname has been logged in to as, most recent first, then its default user if it
+// isn't one of them, and a choice of typing in another, for opening a shell on hostname as one of them.
+func (m *mainModel) openUserPicker(hostname string) (*mainModel, tea.Cmd) {
+	var items []components.ListItem
+	for i, user := range m.users[hostname] {
+		info := "used before"
+		if i == 0 {
+			info = "last used"
+		}
+		items = append(items, components.ListItem{Name: user, Info: info, Action: tssh.ActionSelectUser})
+	}
+	if user := m.defaultUser(hostname); !containsItem(items, user) {
+		items = append(items, components.ListItem{Name: user, Info: "default", Action: tssh.ActionSelectUser})
+	}
+	items = append(items, components.ListItem{Name: "Other user", Info: "Type in a username", Action: tssh.ActionOtherUser})
+
+	m.userList = components.NewList("Log in to "+hostname+" as", m.theme, m.keys, items...)
+	m.userList.SetFilteringEnabled(!m.cfg.DisableFilter)
+	m.userList.SetHelpKeys(m.keys.Back, m.keys.Help)
+
+	var cmd tea.Cmd
+	if m.width > 0 {
+		m.userList, cmd = m.userList.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+	}
+	m.state = stateUsers
+	return m, cmd
+}
+
+// containsItem reports whether one of items is named name.
+func containsItem(items []components.ListItem, name string) bool {
+	for _, item := range items {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mainModel) handleUsersKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key.Matches(msg, m.keys.Back) && !m.userList.IsFiltering() {
+		if m.userList.IsFiltered() {
+			m.userList.ResetFilter()
+			return m, nil
+		}
+		m.state = stateActions
+		return m, nil
+	}
+	m.userList, cmd = m.userList.Update(msg)
+	return m, cmd
+}
+
+// startUserPrompt asks for the username to log in to m.actionHost as.
+func (m *mainModel) startUserPrompt() (*mainModel, tea.Cmd) {
+	input := textinput.New()
+	input.Prompt = "log in to " + m.actionHost + " as "
+	input.PromptStyle = lipgloss.NewStyle().Foreground(m.theme.Accent)
+	input.Placeholder = "username"
+	input.Width = m.inputWidth(input.Prompt)
+
+	m.userPrompt = userPrompt{input: input}
+	m.state = stateUserPrompt
+	return m, m.userPrompt.input.Focus()
+}
+
+func (m *mainModel) handleUserPromptKeyPress(msg tea.KeyMsg) (*mainModel, tea.Cmd) {
+	var cmd tea.Cmd
+	p := &m.userPrompt
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.state = stateUsers
+		return m, nil
+	case key.Matches(msg, m.keys.Choose):
+		user := strings.TrimSpace(p.input.Value())
+		if err := validUser(user); err != nil {
+			p.err = err
+			return m, nil
+		}
+		return m.useUser(user)
+	}
+
+	p.input, cmd = p.input.Update(msg)
+	return m, cmd
+}
+
+// validUser reports why user can't be logged in as, if it can't.
+func validUser(user string) error {
+	switch {
+	case user == "":
+		return errors.New("enter a username")
+	case strings.ContainsAny(user, " \t@"):
+		return fmt.Errorf("invalid username %q", user)
+	}
+	return nil
+}
+
+// useUser remembers user as the most recent one m.actionHost was logged in to as and opens a shell as them.
+func (m *mainModel) useUser(user string) (*mainModel, tea.Cmd) {
+	m.logger.Info("user chosen", "action", "user", "host", m.actionHost, "user", user)
+	m.users.Add(m.actionHost, user)
+	if err := m.users.Save(); err != nil {
+		m.logger.Warn("saving users failed", "error", err)
+	}
+	hostname := m.actionHost
+	return m.checkAccess(hostname, stateUsers, func() tea.Cmd { return m.sshDevice(hostname) })
+}
+
+func (m mainModel) userPromptView() string {
+	p := m.userPrompt
+	lines := []string{p.input.View()}
+	if p.err != nil {
+		lines = append(lines, "", m.textStyle(p.err.Error()))
+	}
+	choose, back := m.keys.Choose.Help(), m.keys.Back.Help()
+	help := fmt.Sprintf("%s connect • %s back", choose.Key, back.Key)
+	lines = append(lines, "", lipgloss.NewStyle().Foreground(m.theme.Subdued).Render(help))
+	return m.pane(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
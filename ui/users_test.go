@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/acmacalister/tssh"
+	"github.com/acmacalister/tssh/config"
+)
+
+func TestUserPicker(t *testing.T) {
+	cfg := config.Default()
+	cfg.User = "ubuntu"
+	m := newTestModel(t, cfg)
+	m.actionHost = "web-1"
+
+	// hosts no user has been picked for go by the default.
+	if got := m.sshUser("web-1"); got != "ubuntu" {
+		t.Errorf("sshUser with none picked = %q, want the default ubuntu", got)
+	}
+
+	m.users.Add("web-1", "root")
+	m.users.Add("web-1", "deploy")
+	m.openUserPicker("web-1")
+	if m.state != stateUsers {
+		t.Fatalf("state = %v, want the user picker", m.state)
+	}
+	var names []string
+	for _, item := range m.userList.Items() {
+		names = append(names, item.Name)
+	}
+	want := []string{"deploy", "root", "ubuntu", "Other user"}
+	if len(names) != len(want) {
+		t.Fatalf("picker lists %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("picker lists %q, want %q", names, want)
+		}
+	}
+	if item, ok := m.userList.Selected(); !ok || item.Name != "deploy" || item.Action != tssh.ActionSelectUser {
+		t.Errorf("selected = %+v, want the last used user", item)
+	}
+
+	if got := m.sshUser("web-1"); got != "deploy" {
+		t.Errorf("sshUser = %q, want the last picked user deploy", got)
+	}
+	if got := m.sshUser("web-2"); got != "ubuntu" {
+		t.Errorf("sshUser for another host = %q, want the default ubuntu", got)
+	}
+}
+
+func TestValidUser(t *testing.T) {
+	for user, ok := range map[string]bool{"deploy": true, "": false, "two words": false, "me@host": false} {
+		if err := validUser(user); (err == nil) != ok {
+			t.Errorf("validUser(%q) = %v, want ok %v", user, err, ok)
+		}
+	}
+}